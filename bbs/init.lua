@@ -1,11 +1,15 @@
 Term = require("term")
+Chat = require("chat")
+UI = require("ui")
+require "input"
 require "sysop_area"
+require "message_boards"
+require "mailbox"
 
-if (getEnv("LANG") == "") then
-    -- Term.setOutputMode("CP850")
-    Term.setOutputMode("CP437")
-    -- Term.setOutputMode("UTF-8") -- default
-end
+-- the terminal is queried for the encoding, colors and images
+Caps = Term.capabilities()
+Term.setOutputMode(Caps.encoding)
+-- Term.setOutputMode("CP850")
 
 Term.write("\r\n")
 Term.write("\r\nthis is a test write to client instance\r\n")
@@ -27,19 +31,35 @@ end
 
 function MainMenu()
     clearTriggers()
+    setActivity("main menu")
     trigger("1", Runiptclient)
     trigger("2", SysopArea)
     trigger("3", ExitConnection)
-    Term.write("\27[37;40m")
+    trigger("4", WhosOnline)
+    trigger("5", ChatLobby)
+    trigger("6", MessageBoards)
+    trigger("7", MailMenu)
+    trigger("ctrl+x ctrl+c", ExitConnection)
+    Term.setColor("white")
+    Term.setBackgroundColor("black")
     Term.cls()
 
     Term.print(5, 8, "1 show shared terminal")
     Term.print(6, 8, "2 sysop area")
     Term.print(7, 8, "3 quit")
+    Term.print(8, 8, "4 who's online")
+    Term.print(9, 8, "5 chat")
+    Term.print(10, 8, "6 message boards")
+    Term.print(11, 8, "7 mail")
+
+    local unread = Mail.unread()
+    if unread > 0 then
+        Term.print(13, 8, string.format("you have %d new messages", unread))
+    end
 
-    Term.write("\27[35;40m")
+    Term.setColor("magenta")
     Term.print(15, 8, "option: ")
-    Term.write("\27[37;40m")
+    Term.setColor("white")
 
 end
 
@@ -51,9 +71,50 @@ function ExitConnection()
     quit()
 end
 
+local function formatIdle(seconds)
+    if seconds < 60 then
+        return "-"
+    end
+    return string.format("%d:%02d", math.floor(seconds / 3600), math.floor((seconds % 3600) / 60))
+end
+
+local function drawWhosOnline()
+    Term.cls()
+    Term.print(2, 3, "who's online")
+    Term.print(4, 3, string.format("%-5s %-16s %-6s %s", "node", "nickname", "idle", "activity"))
+    for i, s in ipairs(listSessions()) do
+        local mark = " "
+        if s.self then
+            mark = "*"
+        end
+        Term.print(4 + i, 2, string.format("%s%-5d %-16s %-6s %s",
+            mark, s.node, s.nickname, formatIdle(s.idle), s.activity))
+    end
+    Term.print(23, 3, "press 0 or esc to go back")
+end
+
+function WhosOnline()
+    clearTriggers()
+    setActivity("who's online")
+    trigger("0", MainMenu)
+    trigger("esc", MainMenu)
+    timer("whosOnline", 5000, drawWhosOnline)
+    drawWhosOnline()
+end
+
+function ChatLobby()
+    clearTriggers()
+    Chat.join("lobby")
+    MainMenu()
+end
+
 function Runiptclient()
     execWithTriggers("iptclient")
     MainMenu()
 end
 
+onDisconnect(function()
+    logf("disconnected user %s", getUser().nickname)
+end)
+
 MainMenu()
@@ -0,0 +1,28 @@
+-- Prompt writes the text at the row and returns the line typed by the user.
+function Prompt(row, text)
+    Term.setColor("magenta")
+    Term.setBackgroundColor("black")
+    Term.print(row, 3, text)
+    Term.setColor("white")
+    return Term.getField()
+end
+
+function Pause()
+    Prompt(23, "press enter to continue ")
+end
+
+-- ReadBody opens the editor with the initial text and returns the
+-- text, nil if the user aborted.
+function ReadBody(initial)
+    local text, saved = Term.editText(initial or "")
+    if not saved then
+        return nil
+    end
+    return text
+end
+
+-- WriteBody writes a multi-line text converting the line breaks.
+function WriteBody(body)
+    Term.write((string.gsub(body, "\n", "\r\n")))
+    Term.write("\r\n")
+end
@@ -0,0 +1,116 @@
+Mail = require("mail")
+
+local function showError(err)
+    Term.write("\r\nerror: " .. err .. "\r\n")
+    Pause()
+end
+
+local function compose()
+    Term.cls()
+    Term.print(2, 3, "new message")
+    local to = Prompt(4, "to: ")
+    local subject = Prompt(5, "subject: ")
+    local body = ReadBody()
+    if not body then
+        return
+    end
+    local id, err = Mail.send(to, subject, body)
+    if not id then
+        showError(err)
+    end
+end
+
+local function readMessage(id)
+    while true do
+        local m, err = Mail.read(id)
+        if not m then
+            showError(err)
+            return
+        end
+
+        Term.cls()
+        Term.print(2, 3, m.subject)
+        Term.print(3, 3, string.format("from %s to %s at %s", m.from, m.to, m.created_at))
+        Term.moveCursor(5, 1)
+        WriteBody(m.body)
+
+        local opt = Prompt(23, "r reply, d delete, 0 back: ")
+        if opt == "0" or opt == "" then
+            return
+        elseif opt == "r" then
+            local quote = "\n\n" .. m.from .. " wrote:\n> " .. string.gsub(m.body, "\n", "\n> ")
+            local body = ReadBody(quote)
+            if not body then
+                return
+            end
+            local rid, rerr = Mail.reply(m.id, body)
+            if not rid then
+                showError(rerr)
+            end
+            return
+        elseif opt == "d" then
+            local ok, derr = Mail.delete(m.id)
+            if not ok then
+                showError(derr)
+            end
+            return
+        end
+    end
+end
+
+local function listMessages(title, list, who)
+    while true do
+        local messages, err = list()
+        if not messages then
+            showError(err)
+            return
+        end
+
+        Term.cls()
+        Term.print(2, 3, title)
+        for i, m in ipairs(messages) do
+            if i > 15 then
+                break
+            end
+            local mark = " "
+            if m.unread and who == "from" then
+                mark = "*"
+            end
+            Term.print(3 + i, 2, string.format("%s%3d %-16s %-40s %s",
+                mark, i, m[who], m.subject, m.created_at))
+        end
+
+        local opt = Prompt(22, "message number, 0 back: ")
+        if opt == "0" or opt == "" then
+            return
+        end
+        local m = messages[tonumber(opt)]
+        if m then
+            readMessage(m.id)
+        end
+    end
+end
+
+function MailMenu()
+    clearTriggers()
+    setActivity("mail")
+    while true do
+        Term.cls()
+        Term.print(2, 3, "mail")
+        Term.print(4, 3, string.format("1 inbox (%d new)", Mail.unread()))
+        Term.print(5, 3, "2 sent")
+        Term.print(6, 3, "3 new message")
+
+        local opt = Prompt(22, "option, 0 back: ")
+        if opt == "0" or opt == "" then
+            break
+        elseif opt == "1" then
+            listMessages("inbox", Mail.inbox, "from")
+        elseif opt == "2" then
+            listMessages("sent", Mail.sent, "to")
+        elseif opt == "3" then
+            compose()
+        end
+    end
+    MainMenu()
+end
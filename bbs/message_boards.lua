@@ -0,0 +1,132 @@
+Boards = require("boards")
+
+local function showPost(thread, posts, i)
+    local p = posts[i]
+    Term.cls()
+    Term.print(2, 3, thread.subject)
+    Term.print(3, 3, string.format("%d/%d by %s at %s", i, #posts, p.nickname, p.created_at))
+    Term.moveCursor(5, 1)
+    WriteBody(p.body)
+end
+
+local function reply(thread)
+    local body = ReadBody()
+    if not body then
+        return
+    end
+    local id, err = Boards.reply(thread.id, body)
+    if not id then
+        Term.write("\r\nerror: " .. err .. "\r\n")
+        Pause()
+    end
+end
+
+local function readThread(area, thread)
+    local i = 1
+    while true do
+        local posts, err = Boards.posts(thread.id)
+        if not posts then
+            Term.write("\r\nerror: " .. err .. "\r\n")
+            Pause()
+            return
+        end
+        if i > #posts then
+            i = #posts
+        end
+        showPost(thread, posts, i)
+        Boards.markRead(area.id, posts[i].id)
+
+        local options = "n next, p previous, r reply, 0 back: "
+        if not Boards.canPost() then
+            options = "n next, p previous, 0 back: "
+        end
+        local opt = Prompt(23, options)
+        if opt == "0" or opt == "" then
+            return
+        elseif opt == "n" and i < #posts then
+            i = i + 1
+        elseif opt == "p" and i > 1 then
+            i = i - 1
+        elseif opt == "r" and Boards.canPost() then
+            reply(thread)
+            i = #posts + 1
+        end
+    end
+end
+
+local function newThread(area)
+    Term.cls()
+    Term.print(2, 3, "new thread in " .. area.name)
+    local subject = Prompt(4, "subject: ")
+    local body = ReadBody()
+    if not body then
+        return
+    end
+    local id, err = Boards.newThread(area.id, subject, body)
+    if not id then
+        Term.write("\r\nerror: " .. err .. "\r\n")
+        Pause()
+    end
+end
+
+local function listThreads(area)
+    while true do
+        setActivity("reading " .. area.name)
+        local threads, err = Boards.threads(area.id)
+        if not threads then
+            Term.write("\r\nerror: " .. err .. "\r\n")
+            Pause()
+            return
+        end
+
+        Term.cls()
+        Term.print(2, 3, area.name .. " - " .. area.description)
+        for i, t in ipairs(threads) do
+            if i > 15 then
+                break
+            end
+            Term.print(3 + i, 3, string.format("%3d %-40s %-16s %d",
+                i, t.subject, t.nickname, t.posts))
+        end
+
+        local options = "thread number, n new thread, 0 back: "
+        if not Boards.canPost() then
+            options = "thread number, 0 back: "
+        end
+        local opt = Prompt(22, options)
+        if opt == "0" or opt == "" then
+            return
+        elseif opt == "n" and Boards.canPost() then
+            newThread(area)
+        else
+            local t = threads[tonumber(opt)]
+            if t then
+                readThread(area, t)
+            end
+        end
+    end
+end
+
+function MessageBoards()
+    clearTriggers()
+    while true do
+        setActivity("message boards")
+        local areas = Boards.areas()
+        Term.cls()
+        Term.print(2, 3, "message boards")
+        for i, a in ipairs(areas) do
+            Term.print(3 + i, 3, string.format("%3d %-16s %-40s %d new",
+                i, a.name, a.description, a.unread))
+        end
+
+        local opt = Prompt(22, "area number, 0 back: ")
+        if opt == "0" or opt == "" then
+            break
+        end
+        local a = areas[tonumber(opt)]
+        if a then
+            listThreads(a)
+        end
+    end
+    MainMenu()
+end
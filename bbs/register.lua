@@ -0,0 +1,29 @@
+Term = require("term")
+
+local u = getUser()
+
+Term.cls()
+Term.write("\r\nWelcome to Atomic!\r\n")
+Term.write("\r\nThere is no account named " .. u.nickname .. ", let's create one.\r\n")
+Term.write("Leave the password empty to log in only with your SSH key.\r\n")
+
+for i = 1, 3 do
+    Term.write("\r\nemail: ")
+    local email = Term.getField()
+    Term.write("\r\npassword: ")
+    local password = Term.getPassword()
+    Term.write("\r\n")
+
+    local ok, err = createAccount(email, password)
+    if ok then
+        logf("new user %s", u.nickname)
+        Term.write("\r\naccount created, please reconnect to log in.\r\n")
+        quit()
+        return
+    end
+
+    Term.write("\r\nerror: " .. err .. "\r\n")
+end
+
+Term.write("\r\nbye!\r\n")
+quit()
@@ -1,26 +1,27 @@
-local function run_ipt_client()
-    execWithTriggers("iptclient")
-end
-
-local function back()
-    MainMenu()
-end
-
 function SysopMenu()
     clearTriggers()
-    Term.cls()
-    trigger("1", run_ipt_client)
-    trigger("2", run_test)
-    trigger("0", back)
-    Term.write("\r\nmain menu\r\n")
-    Term.write("[1] live coding\r\n")
-    Term.write("[2] run test\r\n")
-    Term.write("[0] back\r\n")
-end
+    while true do
+        Term.cls()
+        local _, key = UI.menu{
+            title = "sysop area",
+            items = {
+                {key = "1", label = "live coding"},
+                {key = "2", label = "run test"},
+                {key = "0", label = "back"},
+            },
+        }
 
-function run_test()
-    SysopMenu()
-    execNonInteractive("ls")
+        if key == "1" then
+            execWithTriggers("iptclient")
+        elseif key == "2" then
+            Term.cls()
+            execNonInteractive("ls")
+            Pause()
+        else
+            MainMenu()
+            return
+        end
+    end
 end
 
 function SysopArea()
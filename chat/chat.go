@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the kind of a line of the chat.
+type Kind int
+
+const (
+	Message Kind = iota
+	Action
+	Notice
+)
+
+// Line is a line of text said in a room.
+type Line struct {
+	Time     time.Time
+	Room     string
+	Nickname string
+	Text     string
+	Kind     Kind
+}
+
+func (l Line) String() string {
+	t := l.Time.Format("15:04")
+	switch l.Kind {
+	case Action:
+		return fmt.Sprintf("%s * %s %s", t, l.Nickname, l.Text)
+	case Notice:
+		return fmt.Sprintf("%s -- %s", t, l.Text)
+	}
+	return fmt.Sprintf("%s <%s> %s", t, l.Nickname, l.Text)
+}
+
+// Member is someone connected to a room.
+type Member interface {
+	Nickname() string
+	// Deliver is called, from any goroutine, for every line said in the room.
+	Deliver(line Line)
+}
+
+// Logger stores the messages said in the rooms, *database.Database implements it.
+type Logger interface {
+	LogChatMessage(room, nickname, message string) error
+}
+
+// Hub holds the chat rooms, rooms are created on the first join and
+// removed when the last member leaves.
+type Hub struct {
+	mutex      sync.Mutex
+	rooms      map[string]*Room
+	scrollback int
+	logger     Logger
+}
+
+// NewHub creates a hub keeping the last scrollback lines of each room
+// in memory, a negative scrollback keeps none. The logger can be nil to
+// not log the messages.
+func NewHub(scrollback int, logger Logger) *Hub {
+	return &Hub{
+		rooms:      make(map[string]*Room),
+		scrollback: max(scrollback, 0),
+		logger:     logger,
+	}
+}
+
+// Join adds the member to the room with the given name.
+func (h *Hub) Join(name string, m Member) *Room {
+	name = RoomName(name)
+
+	h.mutex.Lock()
+	r, ok := h.rooms[name]
+	if !ok {
+		r = &Room{
+			Name:    name,
+			hub:     h,
+			members: make(map[Member]struct{}),
+		}
+		h.rooms[name] = r
+	}
+	r.mutex.Lock()
+	r.members[m] = struct{}{}
+	r.mutex.Unlock()
+	h.mutex.Unlock()
+
+	r.notice(m.Nickname() + " joined " + name)
+
+	return r
+}
+
+// RoomName normalizes the name of a room.
+func RoomName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Rooms returns the names of the rooms with at least one member.
+func (h *Hub) Rooms() []string {
+	h.mutex.Lock()
+	names := make([]string, 0, len(h.rooms))
+	for name := range h.rooms {
+		names = append(names, name)
+	}
+	h.mutex.Unlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Room returns the room with the given name.
+func (h *Hub) Room(name string) (*Room, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	r, ok := h.rooms[RoomName(name)]
+	return r, ok
+}
+
+// Room is a chat room.
+type Room struct {
+	mutex      sync.Mutex
+	Name       string
+	hub        *Hub
+	members    map[Member]struct{}
+	scrollback []Line
+}
+
+// Leave removes the member from the room.
+func (r *Room) Leave(m Member) {
+	r.hub.mutex.Lock()
+	r.mutex.Lock()
+	delete(r.members, m)
+	if len(r.members) == 0 {
+		delete(r.hub.rooms, r.Name)
+	}
+	r.mutex.Unlock()
+	r.hub.mutex.Unlock()
+
+	r.notice(m.Nickname() + " left " + r.Name)
+}
+
+// Say sends a message from the member to the room.
+func (r *Room) Say(m Member, text string) {
+	r.send(Line{Nickname: m.Nickname(), Text: text, Kind: Message})
+}
+
+// Act sends an action, as in /me, from the member to the room.
+func (r *Room) Act(m Member, text string) {
+	r.send(Line{Nickname: m.Nickname(), Text: text, Kind: Action})
+}
+
+// Members returns the nicknames of the members of the room.
+func (r *Room) Members() []string {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.members))
+	for m := range r.members {
+		names = append(names, m.Nickname())
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Scrollback returns the last lines said in the room.
+func (r *Room) Scrollback() []Line {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	lines := make([]Line, len(r.scrollback))
+	copy(lines, r.scrollback)
+	return lines
+}
+
+func (r *Room) notice(text string) {
+	r.send(Line{Text: text, Kind: Notice})
+}
+
+func (r *Room) send(line Line) {
+	line.Time = time.Now()
+	line.Room = r.Name
+
+	r.mutex.Lock()
+	r.scrollback = append(r.scrollback, line)
+	if len(r.scrollback) > r.hub.scrollback {
+		r.scrollback = r.scrollback[len(r.scrollback)-r.hub.scrollback:]
+	}
+	members := make([]Member, 0, len(r.members))
+	for m := range r.members {
+		members = append(members, m)
+	}
+	r.mutex.Unlock()
+
+	if r.hub.logger != nil && line.Kind != Notice {
+		text := line.Text
+		if line.Kind == Action {
+			text = "/me " + text
+		}
+		err := r.hub.logger.LogChatMessage(r.Name, line.Nickname, text)
+		if err != nil {
+			log.Printf("error logging chat message, %v", err)
+		}
+	}
+
+	for _, m := range members {
+		m.Deliver(line)
+	}
+}
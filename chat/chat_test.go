@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"sync"
+	"testing"
+)
+
+type fakeMember struct {
+	mutex    sync.Mutex
+	nickname string
+	lines    []Line
+}
+
+func (m *fakeMember) Nickname() string {
+	return m.nickname
+}
+
+func (m *fakeMember) Deliver(line Line) {
+	m.mutex.Lock()
+	m.lines = append(m.lines, line)
+	m.mutex.Unlock()
+}
+
+type fakeLogger struct {
+	messages []string
+}
+
+func (l *fakeLogger) LogChatMessage(room, nickname, message string) error {
+	l.messages = append(l.messages, room+" "+nickname+" "+message)
+	return nil
+}
+
+func TestHub(t *testing.T) {
+	logger := &fakeLogger{}
+	h := NewHub(3, logger)
+
+	m1 := &fakeMember{nickname: "user1"}
+	m2 := &fakeMember{nickname: "user2"}
+
+	r := h.Join(" Lobby ", m1)
+	if r.Name != "lobby" {
+		t.Fatalf("Expected room lobby, got %q", r.Name)
+	}
+
+	r2 := h.Join("lobby", m2)
+	if r2 != r {
+		t.Fatal("Expected the same room")
+	}
+
+	r.Say(m1, "hello")
+	r.Act(m2, "waves")
+
+	if len(m1.lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d", len(m1.lines))
+	}
+
+	if m1.lines[3].String()[6:] != "* user2 waves" {
+		t.Fatalf("unexpected action line %q", m1.lines[3].String())
+	}
+
+	members := r.Members()
+	if len(members) != 2 || members[0] != "user1" || members[1] != "user2" {
+		t.Fatalf("unexpected members %v", members)
+	}
+
+	if len(r.Scrollback()) != 3 {
+		t.Fatalf("Expected scrollback limited to 3 lines, got %d", len(r.Scrollback()))
+	}
+
+	if len(logger.messages) != 2 || logger.messages[1] != "lobby user2 /me waves" {
+		t.Fatalf("unexpected log %v", logger.messages)
+	}
+
+	r.Leave(m1)
+	r.Leave(m2)
+
+	if len(h.Rooms()) != 0 {
+		t.Fatal("Expected empty rooms removed")
+	}
+}
+
+func TestHub_NegativeScrollback(t *testing.T) {
+	h := NewHub(-1, nil)
+	m := &fakeMember{nickname: "user1"}
+	r := h.Join("lobby", m)
+	r.Say(m, "hello")
+
+	if len(r.Scrollback()) != 0 {
+		t.Fatalf("Expected no scrollback, got %d lines", len(r.Scrollback()))
+	}
+}
@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+const maxInputLength = 200
+
+// Client is the split screen user interface of a member, the lines of
+// the room scroll in the top of the screen and the user types in the
+// bottom line.
+type Client struct {
+	mutex    sync.Mutex
+	term     *term.Term
+	nickname string
+	room     *Room
+	input    []rune
+	width    int
+	height   int
+}
+
+// NewClient creates the chat interface of the user on the terminal.
+func NewClient(t *term.Term, nickname string) *Client {
+	return &Client{
+		term:     t,
+		nickname: nickname,
+	}
+}
+
+// Nickname returns the nickname of the user.
+func (c *Client) Nickname() string {
+	return c.nickname
+}
+
+// Join draws the chat screen and joins the room.
+func (c *Client) Join(h *Hub, name string) {
+	c.mutex.Lock()
+	c.width, c.height = c.term.GetSize()
+	if c.width <= 0 || c.height <= 0 {
+		c.width, c.height = 80, 24
+	}
+	c.mutex.Unlock()
+
+	c.term.EnterScreen()
+	c.term.Clear()
+
+	c.term.WriteString(fmt.Sprintf("\033[2;%dr", c.height-2))
+	c.term.WriteString(fmt.Sprintf("\033[1;1H\033[7m%-*s\033[0m",
+		c.width, fmt.Sprintf(" #%s  /who /me /quit", name)))
+	c.term.WriteString(fmt.Sprintf("\033[%d;1H%s", c.height-1, strings.Repeat("─", c.width)))
+
+	if r, ok := h.Room(name); ok {
+		for _, line := range r.Scrollback() {
+			c.Deliver(line)
+		}
+	}
+
+	r := h.Join(name, c)
+
+	c.mutex.Lock()
+	c.room = r
+	c.mutex.Unlock()
+
+	c.drawInput()
+}
+
+// Leave leaves the room and restores the screen.
+func (c *Client) Leave() {
+	c.mutex.Lock()
+	r := c.room
+	c.room = nil
+	c.mutex.Unlock()
+
+	if r == nil {
+		return
+	}
+	r.Leave(c)
+
+	c.term.WriteString("\033[r")
+	c.term.ExitScreen()
+}
+
+// Deliver draws a line said in the room.
+func (c *Client) Deliver(line Line) {
+	c.println(line.String())
+}
+
+// println writes the text in the bottom of the scroll region,
+// wrapping long lines, and puts the cursor back in the input line.
+func (c *Client) println(text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("\0337")
+	r := []rune(text)
+	for {
+		n := len(r)
+		if n > c.width {
+			n = c.width
+		}
+		sb.WriteString(fmt.Sprintf("\033[%d;1H\r\n%s", c.height-2, string(r[:n])))
+		r = r[n:]
+		if len(r) == 0 {
+			break
+		}
+	}
+	sb.WriteString("\0338")
+
+	c.term.WriteString(sb.String())
+}
+
+func (c *Client) drawInput() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r := c.input
+	if len(r) > c.width-3 {
+		r = r[len(r)-(c.width-3):]
+	}
+	c.term.WriteString(fmt.Sprintf("\033[%d;1H\033[2K> %s", c.height, string(r)))
+}
+
+// Input handles the keys typed by the user, it returns true when the user leaves the room.
+func (c *Client) Input(ev term.Event) bool {
+	switch ev.Type {
+	case term.EventMouse:
+		return false
+	case term.EventPaste:
+		c.mutex.Lock()
+		for _, r := range ev.Text {
+			if r >= ' ' && len(c.input) < maxInputLength {
+				c.input = append(c.input, r)
+			}
+		}
+		c.mutex.Unlock()
+		c.drawInput()
+		return false
+	}
+
+	switch ev.Key {
+	case term.KeyEnter:
+		c.mutex.Lock()
+		line := strings.TrimSpace(string(c.input))
+		c.input = nil
+		c.mutex.Unlock()
+		c.drawInput()
+
+		return c.command(line)
+	case term.KeyBackspace:
+		c.mutex.Lock()
+		if len(c.input) > 0 {
+			c.input = c.input[:len(c.input)-1]
+		}
+		c.mutex.Unlock()
+		c.drawInput()
+	case term.KeyRune:
+		if ev.Mod&term.ModCtrl != 0 {
+			// ctrl + c, ctrl + d
+			return ev.Rune == 'c' || ev.Rune == 'd'
+		}
+		if ev.Mod&term.ModAlt != 0 {
+			return false
+		}
+		c.mutex.Lock()
+		if len(c.input) < maxInputLength {
+			c.input = append(c.input, ev.Rune)
+		}
+		c.mutex.Unlock()
+		c.drawInput()
+	}
+
+	return false
+}
+
+// command runs a line typed by the user, it returns true when the user leaves the room.
+func (c *Client) command(line string) bool {
+	c.mutex.Lock()
+	r := c.room
+	c.mutex.Unlock()
+
+	if line == "" || r == nil {
+		return false
+	}
+
+	if !strings.HasPrefix(line, "/") {
+		r.Say(c, line)
+		return false
+	}
+
+	cmd, arg, _ := strings.Cut(line, " ")
+	switch strings.ToLower(cmd) {
+	case "/quit", "/q":
+		return true
+	case "/me":
+		if arg != "" {
+			r.Act(c, arg)
+		}
+	case "/who":
+		c.println("-- in #" + r.Name + ": " + strings.Join(r.Members(), ", "))
+	case "/help":
+		c.println("-- /who list the users in the room, /me <action>, /quit leave the room")
+	default:
+		c.println("-- unknown command " + cmd + ", try /help")
+	}
+
+	return false
+}
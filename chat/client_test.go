@@ -0,0 +1,172 @@
+package chat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+// feed decodes the input and sends the events to the client, it
+// returns true when the client leaves the room.
+func feed(c *Client, s string) bool {
+	var d term.Decoder
+	for _, ev := range append(d.Feed(s), d.Flush()...) {
+		if c.Input(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// line returns the text of a row of the screen, without the time of
+// the lines of the room.
+func line(t *term.Term, row int) string {
+	s := t.Screen()
+	text := s.Line(row)
+	if len(text) > 6 && text[2] == ':' {
+		return text[6:]
+	}
+	return text
+}
+
+// newClient returns alice in the lobby of a 40x10 terminal, bob said a
+// line before she joined.
+func newClient(t *testing.T) (*Client, *term.Term, *Room, *fakeMember) {
+	h := NewHub(10, nil)
+	bob := &fakeMember{nickname: "bob"}
+	r := h.Join("lobby", bob)
+	r.Say(bob, "earlier")
+
+	tm := &term.Term{C: &bytes.Buffer{}, Width: 40, Height: 10}
+	c := NewClient(tm, "alice")
+	c.Join(h, "lobby")
+	t.Cleanup(c.Leave)
+	return c, tm, r, bob
+}
+
+func TestClient_Join(t *testing.T) {
+	_, tm, _, bob := newClient(t)
+
+	if got := line(tm, 1); got != " #lobby  /who /me /quit" {
+		t.Fatalf("Unexpected header %q", got)
+	}
+	// the scrollback is replayed at the bottom of the scroll region
+	want := []string{"-- bob joined lobby", "<bob> earlier", "-- alice joined lobby"}
+	for i, w := range want {
+		if got := line(tm, 6+i); got != w {
+			t.Fatalf("Unexpected row %d %q, expected %q", 6+i, got, w)
+		}
+	}
+	if got := line(tm, 9); got != strings.Repeat("─", 40) {
+		t.Fatalf("Unexpected separator %q", got)
+	}
+	if got := line(tm, 10); got != ">" {
+		t.Fatalf("Unexpected input line %q", got)
+	}
+
+	if len(bob.lines) != 3 || bob.lines[2].Text != "alice joined lobby" {
+		t.Fatalf("Expected bob to see alice join, got %v", bob.lines)
+	}
+}
+
+func TestClient_Input(t *testing.T) {
+	c, tm, _, bob := newClient(t)
+
+	if feed(c, "hi\x7f\x7fhello") {
+		t.Fatal("Expected to stay in the room")
+	}
+	if got := line(tm, 10); got != "> hello" {
+		t.Fatalf("Unexpected input line %q", got)
+	}
+
+	feed(c, "\r")
+	if got := line(tm, 10); got != ">" {
+		t.Fatalf("Expected the input cleared, got %q", got)
+	}
+	if got := line(tm, 8); got != "<alice> hello" {
+		t.Fatalf("Unexpected last line %q", got)
+	}
+	last := bob.lines[len(bob.lines)-1]
+	if last.Nickname != "alice" || last.Text != "hello" || last.Kind != Message {
+		t.Fatalf("Unexpected line delivered to bob %+v", last)
+	}
+
+	// the typed text is shown from its end
+	feed(c, strings.Repeat("x", 50))
+	if got := line(tm, 10); got != "> "+strings.Repeat("x", 37) {
+		t.Fatalf("Unexpected input line %q", got)
+	}
+	feed(c, "\r")
+}
+
+func TestClient_Commands(t *testing.T) {
+	c, tm, _, bob := newClient(t)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/me waves\r", "* alice waves"},
+		{"/who\r", "-- in #lobby: alice, bob"},
+		{"/WHO\r", "-- in #lobby: alice, bob"},
+		{"/nope\r", "-- unknown command /nope, try /help"},
+		{"/help\r", "-- /who list the users in the room, /me"},
+	}
+	for _, tt := range tests {
+		if feed(c, tt.input) {
+			t.Fatalf("%q: expected to stay in the room", tt.input)
+		}
+		// the line of /help wraps in two rows
+		row := 8
+		if tt.input == "/help\r" {
+			row = 7
+		}
+		if got := line(tm, row); got != tt.want {
+			t.Fatalf("%q: unexpected line %q, expected %q", tt.input, got, tt.want)
+		}
+	}
+
+	// only the action is said in the room
+	n := len(bob.lines)
+	if n != 4 || bob.lines[3].Kind != Action || bob.lines[3].Text != "waves" {
+		t.Fatalf("Unexpected lines delivered to bob %v", bob.lines)
+	}
+
+	if !feed(c, "/quit\r") {
+		t.Fatal("Expected to leave with /quit")
+	}
+	if !feed(c, "\x03") {
+		t.Fatal("Expected to leave with ctrl+c")
+	}
+	if feed(c, "\x1bq") {
+		t.Fatal("Expected alt+q ignored")
+	}
+
+	c.Leave()
+	last := bob.lines[len(bob.lines)-1]
+	if last.Text != "alice left lobby" {
+		t.Fatalf("Expected bob to see alice leave, got %+v", last)
+	}
+	c.Leave()
+	if len(bob.lines) != n+1 {
+		t.Fatal("Expected to leave once")
+	}
+}
+
+func TestClient_Wrap(t *testing.T) {
+	_, tm, r, bob := newClient(t)
+
+	r.Say(bob, strings.Repeat("a", 50))
+	if got := line(tm, 7); got != "<bob> "+strings.Repeat("a", 28) {
+		t.Fatalf("Unexpected first row %q", got)
+	}
+	if got := line(tm, 8); got != strings.Repeat("a", 22) {
+		t.Fatalf("Unexpected second row %q", got)
+	}
+	s := tm.Screen()
+	if row, col := s.Cursor(); row != 10 || col != 3 {
+		t.Fatalf("Expected the cursor back in the input line, got %d,%d", row, col)
+	}
+}
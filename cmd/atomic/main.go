@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"crg.eti.br/go/atomic/config"
 	"crg.eti.br/go/atomic/server"
@@ -69,17 +73,21 @@ func main() {
 
 	srv := server.New(cfg)
 
-	go func() {
-		sc := make(chan os.Signal, 1)
-		signal.Notify(sc, os.Interrupt)
-		<-sc
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		log.Println("shutting down...")
+	err = srv.ListenAndServe(ctx)
+	if err != nil && !errors.Is(err, server.ErrServerClosed) {
+		log.Println(err)
+	}
+
+	log.Println("shutting down...")
 
-		os.Exit(0)
-	}()
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
 
-	err = srv.ListenAndServe()
+	err = srv.Shutdown(ctx)
 	if err != nil {
 		log.Println(err)
 	}
@@ -13,6 +13,17 @@ type Config struct {
 	PrivateKey         string `json:"private_key" ini:"private_key" cfg:"private_key" cfgDefault:"id_rsa"`
 	BaseBBSDir         string `json:"base_bbs_dir" ini:"base_bbs_dir" cfg:"base_bbs_dir" cfgDefault:"./"`
 	EnableGuestAccount bool   `json:"enable_guest_account" ini:"enable_guest_account" cfg:"enable_guest_account" cfgDefault:"false"`
+	EnableRegistration bool   `json:"enable_registration" ini:"enable_registration" cfg:"enable_registration" cfgDefault:"false"`
+	ShutdownTimeout    int    `json:"shutdown_timeout" ini:"shutdown_timeout" cfg:"shutdown_timeout" cfgDefault:"30"`
+	ShutdownMessage    string `json:"shutdown_message" ini:"shutdown_message" cfg:"shutdown_message" cfgDefault:"system going down"`
+	ChatScrollback     int    `json:"chat_scrollback" ini:"chat_scrollback" cfg:"chat_scrollback" cfgDefault:"100"`
+	ChatLog            bool   `json:"chat_log" ini:"chat_log" cfg:"chat_log" cfgDefault:"false"`
+	Sandbox            bool   `json:"sandbox" ini:"sandbox" cfg:"sandbox" cfgDefault:"false"`
+	ExecAllowlist      string `json:"exec_allowlist" ini:"exec_allowlist" cfg:"exec_allowlist" cfgDefault:""`
+	MaxInstructions    int    `json:"max_instructions" ini:"max_instructions" cfg:"max_instructions" cfgDefault:"100000000"`
+	MaxMemory          int    `json:"max_memory" ini:"max_memory" cfg:"max_memory" cfgDefault:"67108864"`
+	MaxStackSize       int    `json:"max_stack_size" ini:"max_stack_size" cfg:"max_stack_size" cfgDefault:"5120"`
+	ReloadInterval     int    `json:"reload_interval" ini:"reload_interval" cfg:"reload_interval" cfgDefault:"2"`
 }
 
 func Load() (Config, error) {
@@ -0,0 +1,336 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrAreaNameEmpty = errors.New("area name is required")
+	ErrSubjectEmpty  = errors.New("subject is required")
+	ErrBodyEmpty     = errors.New("message body is required")
+)
+
+// Area is a message area of the boards.
+type Area struct {
+	ID          int    `db:"id"`
+	Name        string `db:"name"`
+	Description string `db:"description"`
+	Groups      string `db:"groups"`
+	CreatedAt   string `db:"created_at"`
+}
+
+// AllowedFor reports whether a user with the given comma-separated
+// groups can access the area, an area without groups is open to all.
+func (a Area) AllowedFor(groups string) bool {
+	if a.Groups == "" {
+		return true
+	}
+
+	userGroups := strings.Split(groups, ",")
+	for _, g := range strings.Split(a.Groups, ",") {
+		for _, ug := range userGroups {
+			if g == ug {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Thread is a conversation in an area.
+type Thread struct {
+	ID        int    `db:"id"`
+	AreaID    int    `db:"area_id"`
+	UserID    int    `db:"user_id"`
+	Nickname  string `db:"nickname"`
+	Subject   string `db:"subject"`
+	Posts     int    `db:"posts"`
+	CreatedAt string `db:"created_at"`
+	UpdatedAt string `db:"updated_at"`
+}
+
+// Post is a message of a thread.
+type Post struct {
+	ID        int    `db:"id"`
+	ThreadID  int    `db:"thread_id"`
+	UserID    int    `db:"user_id"`
+	Nickname  string `db:"nickname"`
+	Body      string `db:"body"`
+	CreatedAt string `db:"created_at"`
+}
+
+// CreateArea creates a new message area, groups is a comma-separated
+// list of the groups allowed to access the area, empty for everyone.
+func (d *Database) CreateArea(name, description, groups string) (Area, error) {
+	if name == "" {
+		return Area{}, ErrAreaNameEmpty
+	}
+
+	sql := `INSERT INTO %s_areas (name, description, groups) VALUES ($1, $2, $3) RETURNING *`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	var area Area
+	err := d.db.QueryRowx(sql, name, description, groups).StructScan(&area)
+
+	return area, err
+}
+
+// ListAreas returns all message areas ordered by name.
+func (d *Database) ListAreas() ([]Area, error) {
+	var areas []Area
+	sql := `SELECT * FROM %s_areas ORDER BY name`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Select(&areas, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	return areas, nil
+}
+
+func (d *Database) GetArea(id int) (Area, error) {
+	var area Area
+	sql := `SELECT * FROM %s_areas WHERE id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.QueryRowx(sql, id).StructScan(&area)
+	if err != nil {
+		return Area{}, err
+	}
+
+	return area, nil
+}
+
+// UpdateArea changes the description and the groups of the area.
+func (d *Database) UpdateArea(id int, description, groups string) error {
+	sql := `UPDATE %s_areas SET description = $1, groups = $2 WHERE id = $3`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err := d.db.Exec(sql, description, groups, id)
+	return err
+}
+
+// DeleteArea removes the area with all its threads, posts and read pointers.
+func (d *Database) DeleteArea(id int) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`DELETE FROM %[1]s_posts WHERE thread_id IN (SELECT id FROM %[1]s_threads WHERE area_id = $1)`,
+		`DELETE FROM %[1]s_threads WHERE area_id = $1`,
+		`DELETE FROM %[1]s_read_pointers WHERE area_id = $1`,
+		`DELETE FROM %[1]s_areas WHERE id = $1`,
+	}
+	for _, q := range queries {
+		_, err = tx.Exec(fmt.Sprintf(q, tablePrefix), id)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreateThread creates a new thread in the area with its first post.
+func (d *Database) CreateThread(areaID, userID int, subject, body string) (Thread, error) {
+	if subject == "" {
+		return Thread{}, ErrSubjectEmpty
+	}
+	if body == "" {
+		return Thread{}, ErrBodyEmpty
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return Thread{}, err
+	}
+
+	sql := `INSERT INTO %s_threads (area_id, user_id, subject) VALUES ($1, $2, $3) RETURNING id`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	var id int
+	err = tx.Get(&id, sql, areaID, userID, subject)
+	if err != nil {
+		_ = tx.Rollback()
+		return Thread{}, err
+	}
+
+	sql = `INSERT INTO %s_posts (thread_id, user_id, body) VALUES ($1, $2, $3)`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err = tx.Exec(sql, id, userID, body)
+	if err != nil {
+		_ = tx.Rollback()
+		return Thread{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Thread{}, err
+	}
+
+	return d.GetThread(id)
+}
+
+const selectThreads = `SELECT t.*,
+	COALESCE(u.nickname, '') AS nickname,
+	(SELECT COUNT(*) FROM %[1]s_posts p WHERE p.thread_id = t.id) AS posts
+	FROM %[1]s_threads t
+	LEFT JOIN %[1]s_users u ON u.id = t.user_id`
+
+func (d *Database) GetThread(id int) (Thread, error) {
+	var thread Thread
+	sql := selectThreads + ` WHERE t.id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.QueryRowx(sql, id).StructScan(&thread)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	return thread, nil
+}
+
+// ListThreads returns the threads of the area, the most recently updated first.
+func (d *Database) ListThreads(areaID int) ([]Thread, error) {
+	var threads []Thread
+	sql := selectThreads + ` WHERE t.area_id = $1 ORDER BY t.updated_at DESC, t.id DESC`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Select(&threads, sql, areaID)
+	if err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// CreatePost adds a reply to the thread.
+func (d *Database) CreatePost(threadID, userID int, body string) (Post, error) {
+	if body == "" {
+		return Post{}, ErrBodyEmpty
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return Post{}, err
+	}
+
+	sql := `INSERT INTO %s_posts (thread_id, user_id, body) VALUES ($1, $2, $3) RETURNING id`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	var id int
+	err = tx.Get(&id, sql, threadID, userID, body)
+	if err != nil {
+		_ = tx.Rollback()
+		return Post{}, err
+	}
+
+	sql = `UPDATE %s_threads SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err = tx.Exec(sql, threadID)
+	if err != nil {
+		_ = tx.Rollback()
+		return Post{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Post{}, err
+	}
+
+	return d.GetPost(id)
+}
+
+const selectPosts = `SELECT p.*,
+	COALESCE(u.nickname, '') AS nickname
+	FROM %[1]s_posts p
+	LEFT JOIN %[1]s_users u ON u.id = p.user_id`
+
+func (d *Database) GetPost(id int) (Post, error) {
+	var post Post
+	sql := selectPosts + ` WHERE p.id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.QueryRowx(sql, id).StructScan(&post)
+	if err != nil {
+		return Post{}, err
+	}
+
+	return post, nil
+}
+
+// ListPosts returns the posts of the thread, oldest first.
+func (d *Database) ListPosts(threadID int) ([]Post, error) {
+	var posts []Post
+	sql := selectPosts + ` WHERE p.thread_id = $1 ORDER BY p.id`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Select(&posts, sql, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// DeletePost removes a post, a thread without posts is removed too.
+func (d *Database) DeletePost(id int) error {
+	post, err := d.GetPost(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	sql := `DELETE FROM %s_posts WHERE id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err = tx.Exec(sql, id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	sql = `DELETE FROM %[1]s_threads WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM %[1]s_posts WHERE thread_id = $1)`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err = tx.Exec(sql, post.ThreadID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetReadPointer records the last post read by the user in the area,
+// the pointer never moves back.
+func (d *Database) SetReadPointer(userID, areaID, postID int) error {
+	sql := `INSERT INTO %s_read_pointers (user_id, area_id, post_id) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, area_id) DO UPDATE SET
+		post_id = MAX(post_id, excluded.post_id),
+		updated_at = CURRENT_TIMESTAMP`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err := d.db.Exec(sql, userID, areaID, postID)
+	return err
+}
+
+// GetReadPointer returns the last post read by the user in the area, 0 if none.
+func (d *Database) GetReadPointer(userID, areaID int) (int, error) {
+	var postID int
+	sql := `SELECT COALESCE(MAX(post_id), 0) FROM %s_read_pointers WHERE user_id = $1 AND area_id = $2`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Get(&postID, sql, userID, areaID)
+	return postID, err
+}
+
+// CountUnread returns the number of posts of the area after the read pointer of the user.
+func (d *Database) CountUnread(userID, areaID int) (int, error) {
+	var count int
+	sql := `SELECT COUNT(*) FROM %[1]s_posts p
+		JOIN %[1]s_threads t ON t.id = p.thread_id
+		WHERE t.area_id = $1 AND p.id > (
+			SELECT COALESCE(MAX(post_id), 0) FROM %[1]s_read_pointers
+			WHERE user_id = $2 AND area_id = $1)`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Get(&count, sql, areaID, userID)
+	return count, err
+}
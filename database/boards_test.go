@@ -0,0 +1,162 @@
+package database
+
+import (
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestArea_AllowedFor(t *testing.T) {
+	a := Area{Groups: ""}
+	if !a.AllowedFor("users") {
+		t.Fatal("Expected area without groups open to everyone")
+	}
+
+	a = Area{Groups: "sysop,staff"}
+	if a.AllowedFor("users") {
+		t.Fatal("Expected area closed to users")
+	}
+
+	if !a.AllowedFor("users,staff") {
+		t.Fatal("Expected area open to staff")
+	}
+}
+
+func TestDatabase_Boards(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		e := db.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.CreateUser("test", "test@test", "test1234567", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	area, err := db.CreateArea("games", "Games", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	areas, err := db.ListAreas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// general and sysop are created by the migration
+	if len(areas) != 3 {
+		t.Fatalf("Expected 3 areas, got %d", len(areas))
+	}
+
+	_, err = db.CreateThread(area.ID, u.ID, "", "body")
+	if err != ErrSubjectEmpty {
+		t.Fatal("Expected ErrSubjectEmpty")
+	}
+
+	thread, err := db.CreateThread(area.ID, u.ID, "hello", "first post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if thread.Nickname != "test" || thread.Posts != 1 {
+		t.Fatalf("unexpected thread %+v", thread)
+	}
+
+	post, err := db.CreatePost(thread.ID, u.ID, "second post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := db.ListPosts(thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 || posts[1].ID != post.ID {
+		t.Fatal("Expected 2 posts, oldest first")
+	}
+
+	threads, err := db.ListThreads(area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(threads) != 1 || threads[0].Posts != 2 {
+		t.Fatal("Expected 1 thread with 2 posts")
+	}
+
+	n, err := db.CountUnread(u.ID, area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("Expected 2 unread posts, got %d", n)
+	}
+
+	err = db.SetReadPointer(u.ID, area.ID, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pointer never moves back
+	err = db.SetReadPointer(u.ID, area.ID, posts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := db.GetReadPointer(u.ID, area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != post.ID {
+		t.Fatal("Expected read pointer at the last post")
+	}
+
+	n, err = db.CountUnread(u.ID, area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatalf("Expected 0 unread posts, got %d", n)
+	}
+
+	err = db.DeletePost(posts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeletePost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	threads, err = db.ListThreads(area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(threads) != 0 {
+		t.Fatal("Expected thread without posts removed")
+	}
+
+	err = db.DeleteArea(area.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
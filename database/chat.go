@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+)
+
+// ChatMessage is a message said in a chat room.
+type ChatMessage struct {
+	ID        int    `db:"id"`
+	Room      string `db:"room"`
+	Nickname  string `db:"nickname"`
+	Message   string `db:"message"`
+	CreatedAt string `db:"created_at"`
+}
+
+// LogChatMessage stores a message said in a chat room.
+func (d *Database) LogChatMessage(room, nickname, message string) error {
+	sql := `INSERT INTO %s_chat_log (room, nickname, message) VALUES ($1, $2, $3)`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err := d.db.Exec(sql, room, nickname, message)
+	return err
+}
+
+// ListChatLog returns the last messages said in the chat room, oldest first.
+func (d *Database) ListChatLog(room string, limit int) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	sql := `SELECT * FROM (
+		SELECT * FROM %s_chat_log WHERE room = $1 ORDER BY id DESC LIMIT $2
+		) ORDER BY id`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Select(&messages, sql, room, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
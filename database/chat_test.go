@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestDatabase_ChatLog(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		e := db.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []string{"one", "two", "three"} {
+		err = db.LogChatMessage("lobby", "test", m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.LogChatMessage("other", "test", "four")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := db.ListChatLog("lobby", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+
+	if messages[0].Message != "two" || messages[1].Message != "three" {
+		t.Fatal("Expected the last messages, oldest first")
+	}
+}
@@ -15,7 +15,7 @@ import (
 const (
 	// currentMigration is the current migration version of the code.
 	// it must be incremented every time a new migration is added.
-	currentMigration = 1
+	currentMigration = 5
 )
 
 var (
@@ -33,6 +33,18 @@ var (
 
 	//go:embed migration01.sql
 	migration01 string
+
+	//go:embed migration02.sql
+	migration02 string
+
+	//go:embed migration03.sql
+	migration03 string
+
+	//go:embed migration04.sql
+	migration04 string
+
+	//go:embed migration05.sql
+	migration05 string
 )
 
 type Database struct {
@@ -91,25 +103,55 @@ func (d *Database) RunMigration() error {
 	// run migrations
 	switch lastMigration {
 	case 0:
-		log.Println("running migration 1")
-		migration := fmt.Sprintf(migration01, tablePrefix)
-		_, err = tx.Exec(migration)
+		err = d.migrate(tx, 1, migration01)
 		if err != nil {
 			_ = tx.Rollback()
 			return err
 		}
+		lastMigration = 1
 
-		// update migration table
-		sql := `INSERT INTO %s_migrations (id) VALUES (1)`
-		sql = fmt.Sprintf(sql, tablePrefix)
-		_, err = tx.Exec(sql)
+		fallthrough
+	case 1:
+		err = d.migrate(tx, 2, migration02)
 		if err != nil {
 			_ = tx.Rollback()
 			return err
 		}
 
-		log.Println("done migration 1")
-		lastMigration = 1
+		// move the keys stored in the users table to the keys table
+		err = importUserKeys(tx)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		lastMigration = 2
+
+		fallthrough
+	case 2:
+		err = d.migrate(tx, 3, migration03)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		lastMigration = 3
+
+		fallthrough
+	case 3:
+		err = d.migrate(tx, 4, migration04)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		lastMigration = 4
+
+		fallthrough
+	case 4:
+		err = d.migrate(tx, 5, migration05)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		lastMigration = 5
 
 		fallthrough
 	default:
@@ -127,6 +169,27 @@ func (d *Database) RunMigration() error {
 	return tx.Commit()
 }
 
+// migrate runs a migration script and registers it in the migrations table.
+func (d *Database) migrate(tx *sqlx.Tx, id int, migration string) error {
+	log.Printf("running migration %d", id)
+	migration = fmt.Sprintf(migration, tablePrefix)
+	_, err := tx.Exec(migration)
+	if err != nil {
+		return err
+	}
+
+	// update migration table
+	sql := `INSERT INTO %s_migrations (id) VALUES ($1)`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err = tx.Exec(sql, id)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("done migration %d", id)
+	return nil
+}
+
 func (d *Database) createMigrationTable() error {
 	sql := `CREATE TABLE IF NOT EXISTS %s_migrations (
 		id INTEGER PRIMARY KEY,
@@ -212,11 +275,18 @@ func (d *Database) CreateUser(nickname, email, password, sshPublicKey, groups st
 		}
 		password = string(hashedPassword)
 	}
+	if sshPublicKey != "" {
+		var err error
+		sshPublicKey, _, err = parsePublicKey(sshPublicKey)
+		if err != nil {
+			return User{}, err
+		}
+	}
 	if groups == "" {
 		groups = "users"
 	}
 
-	sql := `INSERT INTO %susers (
+	sql := `INSERT INTO %s_users (
 		nickname,
 		email,
 		password,
@@ -224,10 +294,33 @@ func (d *Database) CreateUser(nickname, email, password, sshPublicKey, groups st
 		groups) 
 		VALUES ($1, $2, $3, $4, $5) RETURNING *`
 	sql = fmt.Sprintf(sql, tablePrefix)
+	// the user is created with its key or not at all
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return User{}, err
+	}
+
 	var user User
-	err := d.db.QueryRowx(sql, nickname, email, password, sshPublicKey, groups).StructScan(&user)
+	err = tx.QueryRowx(sql, nickname, email, password, sshPublicKey, groups).StructScan(&user)
+	if err != nil {
+		_ = tx.Rollback()
+		return User{}, err
+	}
+
+	if sshPublicKey != "" {
+		_, err = addUserKey(tx, user.ID, "default", sshPublicKey)
+		if err != nil {
+			_ = tx.Rollback()
+			return User{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return User{}, err
+	}
 
-	return user, err
+	return user, nil
 }
 
 func (d *Database) GetUserByID(id int) (User, error) {
@@ -111,7 +111,7 @@ func TestDatabase_ChkMigration(t *testing.T) {
 	}
 
 	// insert a fake migration
-	_, err = db.db.Exec("INSERT INTO migrations (id) VALUES (999999)")
+	_, err = db.db.Exec("INSERT INTO atomic_migrations (id) VALUES (999999)")
 	if err != nil {
 		t.Fatal(err)
 	}
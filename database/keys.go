@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid ssh public key")
+	ErrKeyNotFound      = errors.New("ssh public key not found")
+)
+
+// UserKey is a SSH public key that can be used to authenticate a user.
+type UserKey struct {
+	ID          int            `db:"id"`
+	UserID      int            `db:"user_id"`
+	Label       string         `db:"label"`
+	PublicKey   string         `db:"public_key"`
+	Fingerprint string         `db:"fingerprint"`
+	CreatedAt   string         `db:"created_at"`
+	LastUsedAt  sql.NullString `db:"last_used_at"`
+	RevokedAt   sql.NullString `db:"revoked_at"`
+}
+
+// Revoked reports whether the key can no longer be used to authenticate.
+func (k UserKey) Revoked() bool {
+	return k.RevokedAt.Valid
+}
+
+// parsePublicKey parses a key in authorized_keys format and returns
+// the normalized key and its SHA256 fingerprint.
+func parsePublicKey(publicKey string) (string, string, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", "", ErrInvalidPublicKey
+	}
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+
+	return authorizedKey, ssh.FingerprintSHA256(pubKey), nil
+}
+
+// AddUserKey adds a new public key, in authorized_keys format, to the user.
+func (d *Database) AddUserKey(userID int, label, publicKey string) (UserKey, error) {
+	return addUserKey(d.db, userID, label, publicKey)
+}
+
+// addUserKey adds the key in the database or in the transaction q.
+func addUserKey(q sqlx.Queryer, userID int, label, publicKey string) (UserKey, error) {
+	authorizedKey, fingerprint, err := parsePublicKey(publicKey)
+	if err != nil {
+		return UserKey{}, err
+	}
+
+	sql := `INSERT INTO %s_user_keys (
+		user_id,
+		label,
+		public_key,
+		fingerprint)
+		VALUES ($1, $2, $3, $4) RETURNING *`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	var key UserKey
+	err = q.QueryRowx(sql, userID, label, authorizedKey, fingerprint).StructScan(&key)
+
+	return key, err
+}
+
+// ListUserKeys returns all keys of the user, including the revoked ones.
+func (d *Database) ListUserKeys(userID int) ([]UserKey, error) {
+	var keys []UserKey
+	sql := `SELECT * FROM %s_user_keys WHERE user_id = $1 ORDER BY id`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	err := d.db.Select(&keys, sql, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeUserKey revokes a key of the user, the key is kept for auditing.
+func (d *Database) RevokeUserKey(userID, keyID int) error {
+	sql := `UPDATE %s_user_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	res, err := d.db.Exec(sql, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
+
+// GetActiveUserKey returns the non-revoked key of the user with the given fingerprint.
+func (d *Database) GetActiveUserKey(userID int, fingerprint string) (UserKey, error) {
+	var key UserKey
+	query := `SELECT * FROM %s_user_keys
+		WHERE user_id = $1 AND fingerprint = $2 AND revoked_at IS NULL`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := d.db.QueryRowx(query, userID, fingerprint).StructScan(&key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return UserKey{}, ErrKeyNotFound
+		}
+		return UserKey{}, err
+	}
+
+	return key, nil
+}
+
+// TouchUserKey updates the last used date time of the key.
+func (d *Database) TouchUserKey(keyID int) error {
+	sql := `UPDATE %s_user_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`
+	sql = fmt.Sprintf(sql, tablePrefix)
+	_, err := d.db.Exec(sql, keyID)
+	return err
+}
+
+// importUserKeys copies the keys stored in the users table, before the
+// keys table existed, to the keys table. A key used by more than one
+// user is kept only for the first one, the others are logged.
+func importUserKeys(tx *sqlx.Tx) error {
+	var users []User
+	query := `SELECT * FROM %s_users WHERE ssh_public_key IS NOT NULL AND ssh_public_key <> ''`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := tx.Select(&users, query)
+	if err != nil {
+		return err
+	}
+
+	insert := `INSERT INTO %s_user_keys (
+		user_id,
+		label,
+		public_key,
+		fingerprint)
+		VALUES ($1, $2, $3, $4)`
+	insert = fmt.Sprintf(insert, tablePrefix)
+	exists := `SELECT COUNT(*) FROM %s_user_keys WHERE fingerprint = $1 AND revoked_at IS NULL`
+	exists = fmt.Sprintf(exists, tablePrefix)
+
+	for _, u := range users {
+		authorizedKey, fingerprint, err := parsePublicKey(u.SSHPublicKey)
+		if err != nil {
+			// an invalid key could never be used to log in, skip it
+			continue
+		}
+
+		var n int
+		err = tx.Get(&n, exists, fingerprint)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("key %s of user %s already used by another user, not imported", fingerprint, u.Nickname)
+			continue
+		}
+
+		_, err = tx.Exec(insert, u.ID, "default", authorizedKey, fingerprint)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
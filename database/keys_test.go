@@ -0,0 +1,209 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	testPublicKey1 = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFZjl/IElcrEmr8J+z1vudlIwNCmDyr/eyCRChZd10sI laptop"
+	testPublicKey2 = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIE84wdw9mJcqxjKv4+f05IYREOHXS2n5bpeEusgEephF desktop"
+)
+
+func TestDatabase_UserKeys(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		e := db.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.CreateUser(
+		"test",
+		"test@test",
+		"",
+		testPublicKey1,
+		"",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := db.ListUserKeys(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(keys))
+	}
+
+	k2, err := db.AddUserKey(u.ID, "desktop", testPublicKey2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k2.Label != "desktop" {
+		t.Fatal("Label not equal")
+	}
+
+	_, err = db.AddUserKey(u.ID, "invalid", "ssh-ed25519 invalid")
+	if err != ErrInvalidPublicKey {
+		t.Fatal("Expected ErrInvalidPublicKey")
+	}
+
+	k, err := db.GetActiveUserKey(u.ID, k2.Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.ID != k2.ID {
+		t.Fatal("Key not equal")
+	}
+
+	err = db.TouchUserKey(k.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err = db.GetActiveUserKey(u.ID, k2.Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !k.LastUsedAt.Valid {
+		t.Fatal("Expected last used date time")
+	}
+
+	err = db.RevokeUserKey(u.ID, k2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.RevokeUserKey(u.ID, k2.ID)
+	if err != ErrKeyNotFound {
+		t.Fatal("Expected ErrKeyNotFound")
+	}
+
+	_, err = db.GetActiveUserKey(u.ID, k2.Fingerprint)
+	if err != ErrKeyNotFound {
+		t.Fatal("Expected ErrKeyNotFound")
+	}
+
+	// a revoked key can be added again
+	_, err = db.AddUserKey(u.ID, "desktop", testPublicKey2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = db.ListUserKeys(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 keys, got %d", len(keys))
+	}
+
+	if !keys[1].Revoked() {
+		t.Fatal("Expected revoked key")
+	}
+}
+
+func TestDatabase_CreateUserKeyUsed(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateUser("alice", "alice@test", "", testPublicKey1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key of another user, the user is not created without it
+	_, err = db.CreateUser("bob", "bob@test", "", testPublicKey1, "")
+	if err == nil {
+		t.Fatal("Expected an error for a key already in use")
+	}
+
+	_, err = db.GetUserByNickname("bob")
+	if err == nil {
+		t.Fatal("Expected the user not created")
+	}
+}
+
+func TestDatabase_ImportUserKeys(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two legacy users with the same key and one with an invalid key
+	insert := `INSERT INTO %s_users (nickname, email, password, ssh_public_key, groups)
+		VALUES ($1, $2, '', $3, 'users')`
+	insert = fmt.Sprintf(insert, tablePrefix)
+	for _, u := range [][]string{
+		{"alice", "alice@test", testPublicKey1},
+		{"bob", "bob@test", testPublicKey1},
+		{"carol", "carol@test", "ssh-ed25519 invalid"},
+	} {
+		_, err = db.db.Exec(insert, u[0], u[1], u[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importUserKeys(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err = db.db.Get(&n, fmt.Sprintf(`SELECT COUNT(*) FROM %s_user_keys`, tablePrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("Expected 1 key, got %d", n)
+	}
+}
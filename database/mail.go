@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrMailNotFound = errors.New("message not found")
+
+// Mail is a private message between two users, each side has its own
+// copy that can be deleted without affecting the other.
+type Mail struct {
+	ID                 int            `db:"id"`
+	FromUserID         int            `db:"from_user_id"`
+	FromNickname       string         `db:"from_nickname"`
+	ToUserID           int            `db:"to_user_id"`
+	ToNickname         string         `db:"to_nickname"`
+	ReplyTo            sql.NullInt64  `db:"reply_to"`
+	Subject            string         `db:"subject"`
+	Body               string         `db:"body"`
+	CreatedAt          string         `db:"created_at"`
+	ReadAt             sql.NullString `db:"read_at"`
+	SenderDeletedAt    sql.NullString `db:"sender_deleted_at"`
+	RecipientDeletedAt sql.NullString `db:"recipient_deleted_at"`
+}
+
+// Unread reports whether the recipient has not read the message yet.
+func (m Mail) Unread() bool {
+	return !m.ReadAt.Valid
+}
+
+// SendMail sends a message from one user to another, replyTo is the id
+// of the message being answered or 0.
+func (d *Database) SendMail(fromUserID, toUserID int, subject, body string, replyTo int) (Mail, error) {
+	if subject == "" {
+		return Mail{}, ErrSubjectEmpty
+	}
+	if body == "" {
+		return Mail{}, ErrBodyEmpty
+	}
+
+	var reply sql.NullInt64
+	if replyTo > 0 {
+		reply = sql.NullInt64{Int64: int64(replyTo), Valid: true}
+	}
+
+	query := `INSERT INTO %s_mail (from_user_id, to_user_id, reply_to, subject, body)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	query = fmt.Sprintf(query, tablePrefix)
+	var id int
+	err := d.db.Get(&id, query, fromUserID, toUserID, reply, subject, body)
+	if err != nil {
+		return Mail{}, err
+	}
+
+	return d.GetMail(fromUserID, id)
+}
+
+const selectMail = `SELECT m.*,
+	COALESCE(f.nickname, '') AS from_nickname,
+	COALESCE(t.nickname, '') AS to_nickname
+	FROM %[1]s_mail m
+	LEFT JOIN %[1]s_users f ON f.id = m.from_user_id
+	LEFT JOIN %[1]s_users t ON t.id = m.to_user_id`
+
+// GetMail returns a message sent or received by the user that the user
+// has not deleted.
+func (d *Database) GetMail(userID, id int) (Mail, error) {
+	var mail Mail
+	query := selectMail + ` WHERE m.id = $1 AND (
+		(m.from_user_id = $2 AND m.sender_deleted_at IS NULL) OR
+		(m.to_user_id = $2 AND m.recipient_deleted_at IS NULL))`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := d.db.QueryRowx(query, id, userID).StructScan(&mail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Mail{}, ErrMailNotFound
+		}
+		return Mail{}, err
+	}
+
+	return mail, nil
+}
+
+// ListInbox returns the messages received by the user, newest first.
+func (d *Database) ListInbox(userID int) ([]Mail, error) {
+	var mail []Mail
+	query := selectMail + ` WHERE m.to_user_id = $1 AND m.recipient_deleted_at IS NULL
+		ORDER BY m.id DESC`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := d.db.Select(&mail, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mail, nil
+}
+
+// ListSent returns the messages sent by the user, newest first.
+func (d *Database) ListSent(userID int) ([]Mail, error) {
+	var mail []Mail
+	query := selectMail + ` WHERE m.from_user_id = $1 AND m.sender_deleted_at IS NULL
+		ORDER BY m.id DESC`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := d.db.Select(&mail, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mail, nil
+}
+
+// MarkMailRead marks a message received by the user as read.
+func (d *Database) MarkMailRead(userID, id int) error {
+	query := `UPDATE %s_mail SET read_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND to_user_id = $2 AND read_at IS NULL`
+	query = fmt.Sprintf(query, tablePrefix)
+	_, err := d.db.Exec(query, id, userID)
+	return err
+}
+
+// DeleteMail removes the message from the mailbox of the user, the
+// other side keeps its copy.
+func (d *Database) DeleteMail(userID, id int) error {
+	mail, err := d.GetMail(userID, id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// a message sent to oneself is in both mailboxes
+	if mail.FromUserID == userID {
+		query := `UPDATE %s_mail SET sender_deleted_at = CURRENT_TIMESTAMP WHERE id = $1`
+		query = fmt.Sprintf(query, tablePrefix)
+		_, err = tx.Exec(query, id)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if mail.ToUserID == userID {
+		query := `UPDATE %s_mail SET recipient_deleted_at = CURRENT_TIMESTAMP WHERE id = $1`
+		query = fmt.Sprintf(query, tablePrefix)
+		_, err = tx.Exec(query, id)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CountUnreadMail returns the number of messages the user has not read.
+func (d *Database) CountUnreadMail(userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM %s_mail
+		WHERE to_user_id = $1 AND read_at IS NULL AND recipient_deleted_at IS NULL`
+	query = fmt.Sprintf(query, tablePrefix)
+	err := d.db.Get(&count, query, userID)
+	return count, err
+}
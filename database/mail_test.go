@@ -0,0 +1,146 @@
+package database
+
+import (
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestDatabase_Mail(t *testing.T) {
+	connectionString = ":memory:"
+
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		e := db.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+	}()
+
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := db.CreateUser("alice", "alice@test", "test1234567", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := db.CreateUser("bob", "bob@test", "test1234567", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SendMail(alice.ID, bob.ID, "", "body", 0)
+	if err != ErrSubjectEmpty {
+		t.Fatal("Expected ErrSubjectEmpty")
+	}
+
+	m, err := db.SendMail(alice.ID, bob.ID, "hello", "hi bob", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.FromNickname != "alice" || m.ToNickname != "bob" {
+		t.Fatal("Nicknames not equal")
+	}
+
+	if !m.Unread() {
+		t.Fatal("Expected unread message")
+	}
+
+	n, err := db.CountUnreadMail(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("Expected 1 unread message, got %d", n)
+	}
+
+	err = db.MarkMailRead(bob.ID, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = db.CountUnreadMail(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatalf("Expected 0 unread messages, got %d", n)
+	}
+
+	r, err := db.SendMail(bob.ID, alice.ID, "Re: hello", "hi alice", m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.ReplyTo.Int64 != int64(m.ID) {
+		t.Fatal("ReplyTo not equal")
+	}
+
+	inbox, err := db.ListInbox(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inbox) != 1 || inbox[0].ID != r.ID {
+		t.Fatal("Expected the reply in the inbox")
+	}
+
+	sent, err := db.ListSent(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 || sent[0].ID != m.ID {
+		t.Fatal("Expected the message in the sent box")
+	}
+
+	// a third user can not read the message
+	carol, err := db.CreateUser("carol", "carol@test", "test1234567", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetMail(carol.ID, m.ID)
+	if err != ErrMailNotFound {
+		t.Fatal("Expected ErrMailNotFound")
+	}
+
+	err = db.DeleteMail(carol.ID, m.ID)
+	if err != ErrMailNotFound {
+		t.Fatal("Expected ErrMailNotFound")
+	}
+
+	// deleting is per mailbox
+	err = db.DeleteMail(bob.ID, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetMail(bob.ID, m.ID)
+	if err != ErrMailNotFound {
+		t.Fatal("Expected ErrMailNotFound")
+	}
+
+	_, err = db.GetMail(alice.ID, m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inbox, err = db.ListInbox(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inbox) != 0 {
+		t.Fatalf("Expected empty inbox, got %d messages", len(inbox))
+	}
+}
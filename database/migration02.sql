@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS %[1]s_user_keys (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	label TEXT NOT NULL DEFAULT '', -- laptop, desktop, ci...
+	public_key TEXT NOT NULL, -- authorized_keys format
+	fingerprint TEXT NOT NULL, -- SHA256 fingerprint
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	revoked_at DATETIME -- revoked keys are kept for auditing
+);
+
+CREATE INDEX IF NOT EXISTS %[1]s_user_keys_user_id ON %[1]s_user_keys (user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_user_keys_fingerprint
+	ON %[1]s_user_keys (fingerprint) WHERE revoked_at IS NULL;
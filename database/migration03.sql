@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS %[1]s_chat_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	room TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	message TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS %[1]s_chat_log_room ON %[1]s_chat_log (room, created_at);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS %[1]s_areas (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	groups TEXT NOT NULL DEFAULT '', -- users,sysop; empty for everyone
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS %[1]s_threads (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	area_id INTEGER NOT NULL REFERENCES %[1]s_areas(id),
+	user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	subject TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS %[1]s_threads_area_id ON %[1]s_threads (area_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS %[1]s_posts (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	thread_id INTEGER NOT NULL REFERENCES %[1]s_threads(id),
+	user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	body TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS %[1]s_posts_thread_id ON %[1]s_posts (thread_id);
+
+CREATE TABLE IF NOT EXISTS %[1]s_read_pointers (
+	user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	area_id INTEGER NOT NULL REFERENCES %[1]s_areas(id),
+	post_id INTEGER NOT NULL, -- last post read in the area
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, area_id)
+);
+
+INSERT INTO %[1]s_areas (name, description) VALUES ('general', 'General discussion');
+INSERT INTO %[1]s_areas (name, description, groups) VALUES ('sysop', 'Sysop only', 'sysop');
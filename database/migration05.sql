@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS %[1]s_mail (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	from_user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	to_user_id INTEGER NOT NULL REFERENCES %[1]s_users(id),
+	reply_to INTEGER REFERENCES %[1]s_mail(id),
+	subject TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	read_at DATETIME,
+	sender_deleted_at DATETIME, -- soft-delete, each side deletes its own copy
+	recipient_deleted_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS %[1]s_mail_to_user_id ON %[1]s_mail (to_user_id);
+CREATE INDEX IF NOT EXISTS %[1]s_mail_from_user_id ON %[1]s_mail (from_user_id);
@@ -0,0 +1,337 @@
+package luaengine
+
+import (
+	"log"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The scripts of a session run in coroutines of one Lua state, the
+// event loop runs them one at a time: the script, the triggers, the
+// timers and the messages. The functions that wait for the user or for
+// a command suspend the coroutine and the loop resumes it when they are
+// done, the other events run in the meantime.
+
+// thread is a coroutine run by the event loop, done is called when its
+// function returns or fails.
+type thread struct {
+	l    *lua.LState
+	done func(error)
+}
+
+// wait is a coroutine suspended by a function of the engine. cleanup
+// is called in the loop when the wait ends, resumed or because the
+// session ended.
+type wait struct {
+	le      *LuaExtender
+	th      *thread
+	cleanup func()
+}
+
+// resume continues the coroutine with the values returned to the
+// script, only the first call counts. It is called in the loop, the
+// input typed after is handled after the coroutine waits again.
+func (w *wait) resume(values ...lua.LValue) {
+	if w.le.running != nil {
+		w.post(values...)
+		return
+	}
+	if !w.le.waits[w] {
+		return
+	}
+	w.end()
+	w.le.refillBudget()
+	w.le.resume(w.th, nil, values...)
+}
+
+// post resumes the coroutine in the loop, it can be called from any
+// goroutine.
+func (w *wait) post(values ...lua.LValue) {
+	w.le.post(func() { w.resume(values...) })
+}
+
+func (w *wait) end() {
+	delete(w.le.waits, w)
+	if w.cleanup != nil {
+		w.cleanup()
+	}
+}
+
+// loopPrelude makes the waits of the engine pass through pcall, xpcall
+// and the coroutines of the scripts up to the event loop. It returns
+// the function that wraps the Go functions that wait, gopher-lua can
+// not resume them in a tail call or as the body of a coroutine.
+//
+// The native pcall and xpcall of gopher-lua can not yield, they are
+// replaced by functions that run a Lua function in a coroutine and pass
+// its yields to the caller, so they are transparent to the waits and to
+// the coroutines of the scripts. The handler of xpcall is set with catch
+// to run where the error is raised, with the stack of the error. The Go
+// functions do not wait, the functions that wait are wrapped in Lua, so
+// they are called by the native functions.
+const loopPrelude = `
+local token, catch, isGo = ...
+local create, resume, yield, status = coroutine.create, coroutine.resume, coroutine.yield, coroutine.status
+local basepcall, basexpcall = pcall, xpcall
+
+local function pack(...)
+	return {n = select("#", ...), ...}
+end
+
+-- run resumes co and passes the waits of the engine to the caller
+local function run(co, ...)
+	local r = pack(resume(co, ...))
+	while r[1] and r[2] == token and status(co) == "suspended" do
+		r = pack(resume(co, yield(unpack(r, 2, r.n))))
+	end
+	return r
+end
+
+-- protect resumes co and passes all its yields to the caller
+local function protect(co, ...)
+	local r = pack(resume(co, ...))
+	while r[1] and status(co) == "suspended" do
+		r = pack(resume(co, yield(unpack(r, 2, r.n))))
+	end
+	return r
+end
+
+function coroutine.resume(co, ...)
+	local r = run(co, ...)
+	return unpack(r, 1, r.n)
+end
+
+function coroutine.wrap(f)
+	local co = create(f)
+	return function(...)
+		local r = run(co, ...)
+		if not r[1] then
+			error(r[2], 2)
+		end
+		return unpack(r, 2, r.n)
+	end
+end
+
+function pcall(f, ...)
+	if type(f) ~= "function" or isGo(f) then
+		return basepcall(f, ...)
+	end
+	local r = protect(create(f), ...)
+	return unpack(r, 1, r.n)
+end
+
+function xpcall(f, handler)
+	if type(f) ~= "function" or type(handler) ~= "function" or isGo(f) then
+		return basexpcall(f, handler)
+	end
+	local caught
+	local r = protect(create(function()
+		caught = catch(handler)
+		-- not a tail call, gopher-lua counts the levels of the stack
+		-- of a tail call twice
+		local r = pack(f())
+		return unpack(r, 1, r.n)
+	end))
+	if not r[1] and not caught() then
+		-- a Go panic does not pass through the handler of the state
+		return false, handler(r[2])
+	end
+	return unpack(r, 1, r.n)
+end
+
+return function(f)
+	return function(...)
+		local r = pack(f(...))
+		return unpack(r, 1, r.n)
+	end
+end
+`
+
+// catch sets the handler of xpcall in the coroutine that calls it, the
+// handler runs when an error is raised, before the stack unwinds. It
+// returns the function that reports whether the handler ran.
+func catch(l *lua.LState) int {
+	handler := l.CheckFunction(1)
+	caught := false
+	l.Panic = func(l *lua.LState) {
+		l.Panic = raise
+		caught = true
+		err := l.CallByParam(lua.P{Fn: handler, NRet: 1, Protect: true}, l.Get(-1))
+		if err != nil {
+			// the error of the handler is the error of xpcall
+			if aerr, ok := err.(*lua.ApiError); ok {
+				l.Push(aerr.Object)
+			} else {
+				l.Push(lua.LString(err.Error()))
+			}
+		}
+		raise(l)
+	}
+	l.Push(l.NewFunction(func(l *lua.LState) int {
+		l.Push(lua.LBool(caught))
+		return 1
+	}))
+	return 1
+}
+
+// isGo returns whether the function is a Go function.
+func isGo(l *lua.LState) int {
+	l.Push(lua.LBool(l.CheckFunction(1).IsG))
+	return 1
+}
+
+// raise panics with the error on the top of the stack, like the Panic
+// of the coroutines of gopher-lua.
+func raise(l *lua.LState) {
+	panic(&lua.ApiError{Type: lua.ApiErrorRun, Object: l.Get(-1)})
+}
+
+// initLoop prepares the state for the event loop.
+func (le *LuaExtender) initLoop() {
+	le.wake = make(chan struct{}, 1)
+	le.waits = make(map[*wait]bool)
+	le.hooks = make(map[string]*lua.LFunction)
+	le.lastInput = time.Now()
+	le.waitToken = le.luaState.NewUserData()
+
+	l := le.luaState
+	fn, err := l.LoadString(loopPrelude)
+	if err != nil {
+		panic(err)
+	}
+	l.Push(fn)
+	l.Push(le.waitToken)
+	l.Push(l.NewFunction(catch))
+	l.Push(l.NewFunction(isGo))
+	l.Call(3, 1)
+	le.waitWrapper = l.CheckFunction(-1)
+	l.Pop(1)
+}
+
+// setWaitFuncs sets the functions that call await in the table.
+func (le *LuaExtender) setWaitFuncs(l *lua.LState, t *lua.LTable, funcs map[string]lua.LGFunction) {
+	for name, f := range funcs {
+		l.SetField(t, name, le.waitFunc(l, f))
+	}
+}
+
+// waitFunc returns a function that calls await wrapped for the scripts.
+func (le *LuaExtender) waitFunc(l *lua.LState, f lua.LGFunction) lua.LValue {
+	l.Push(le.waitWrapper)
+	l.Push(l.NewFunction(f))
+	l.Call(1, 1)
+	v := l.Get(-1)
+	l.Pop(1)
+	return v
+}
+
+// post queues f to run in the event loop, it can be called from any
+// goroutine.
+func (le *LuaExtender) post(f func()) {
+	le.queueMutex.Lock()
+	le.queue = append(le.queue, f)
+	le.queueMutex.Unlock()
+
+	select {
+	case le.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop runs the events until the session ends, then the waits end and
+// the function set by onDisconnect runs.
+func (le *LuaExtender) loop() {
+	for {
+		select {
+		case <-le.done:
+			le.stopIdle()
+			le.endWaits()
+			le.runHook("onDisconnect")
+			le.endWaits()
+			return
+		case <-le.wake:
+		}
+
+		le.queueMutex.Lock()
+		queue := le.queue
+		le.queue = nil
+		le.queueMutex.Unlock()
+
+		for _, f := range queue {
+			f()
+		}
+	}
+}
+
+func (le *LuaExtender) endWaits() {
+	for w := range le.waits {
+		w.end()
+	}
+}
+
+// newThread returns a coroutine of the state with the same instruction
+// budget.
+func (le *LuaExtender) newThread() *lua.LState {
+	th, cancel := le.luaState.NewThread()
+	if le.budget != nil {
+		if cancel != nil {
+			cancel()
+		}
+		le.setBudget(th)
+	}
+	return th
+}
+
+// start runs f in a new coroutine, done is called when it returns.
+func (le *LuaExtender) start(f *lua.LFunction, done func(error), args ...lua.LValue) {
+	le.refillBudget()
+	le.resume(&thread{l: le.newThread(), done: done}, f, args...)
+}
+
+// resume runs the coroutine until it returns or waits, a coroutine that
+// yields by itself is resumed after the events already queued. The
+// instruction budget is refilled by the events that start or resume a
+// coroutine, not by the coroutine yielding.
+func (le *LuaExtender) resume(th *thread, f *lua.LFunction, args ...lua.LValue) {
+	le.running = th
+	st, err, values := le.luaState.Resume(th.l, f, args...)
+	le.running = nil
+
+	if le.budget != nil && le.budget.Err() == errMemoryLimit {
+		// the scripts can not free the memory, the session ends
+		le.Disconnected()
+	}
+
+	if st != lua.ResumeYield {
+		if th.done != nil {
+			th.done(err)
+		}
+		return
+	}
+	if len(values) == 0 || values[0] != le.waitToken {
+		le.post(func() { le.resume(th, nil) })
+	}
+}
+
+// await suspends the coroutine running l, begin starts what resumes it.
+// The functions that would block the loop call it and return its value,
+// they are set with setWaitFuncs.
+func (le *LuaExtender) await(l *lua.LState, begin func(w *wait)) int {
+	if le.running == nil || l.Parent == nil {
+		l.RaiseError("can not wait outside of a coroutine")
+	}
+	w := &wait{le: le, th: le.running}
+	le.waits[w] = true
+	begin(w)
+	return l.Yield(le.waitToken)
+}
+
+// logError returns the done function of a coroutine that logs its error.
+func logError(what string) func(error) {
+	return func(err error) {
+		if err != nil {
+			log.Println(what, "error", err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package luaengine
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/config"
+	"crg.eti.br/go/atomic/term"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newLoop(t *testing.T) *LuaExtender {
+	le := &LuaExtender{
+		Term:        &term.Term{C: io.Discard, Width: 80, Height: 24},
+		triggerList: make(map[string]*lua.LFunction),
+		done:        make(chan struct{}),
+	}
+	le.luaState = le.newState(config.Config{})
+	le.installLoader()
+	le.initLoop()
+	le.luaState.PreloadModule("term", le.termLoader)
+	le.luaState.SetGlobal("trigger", le.luaState.NewFunction(le.trigger))
+	le.luaState.SetGlobal("timer", le.luaState.NewFunction(le.timer))
+	le.luaState.SetGlobal("rmTrigger", le.luaState.NewFunction(le.removeTrigger))
+	le.luaState.SetGlobal("onConnect", le.luaState.NewFunction(le.setHook("onConnect")))
+	le.luaState.SetGlobal("onResize", le.luaState.NewFunction(le.setHook("onResize")))
+	le.luaState.SetGlobal("onDisconnect", le.luaState.NewFunction(le.setHook("onDisconnect")))
+	le.luaState.SetGlobal("onIdle", le.luaState.NewFunction(le.onIdle))
+	t.Cleanup(le.luaState.Close)
+	return le
+}
+
+// startScript runs the code in a coroutine of the loop.
+func startScript(t *testing.T, le *LuaExtender, code string) {
+	fn, err := le.luaState.LoadString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.post(func() {
+		le.start(fn, func(err error) {
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	})
+}
+
+// global returns a global of the state read in the loop.
+func global(le *LuaExtender, name string) string {
+	c := make(chan string)
+	le.post(func() { c <- lua.LVAsString(le.luaState.GetGlobal(name)) })
+	return <-c
+}
+
+func waitGlobal(t *testing.T, le *LuaExtender, name, want string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := global(le, name)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v %q, got %q", name, want, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoop_Wait(t *testing.T) {
+	le := newLoop(t)
+	go le.loop()
+	defer le.Disconnected()
+
+	startScript(t, le, `
+		local term = require("term")
+		log = ""
+		trigger("x", function() log = log .. "trigger " end)
+		local function ask()
+			return term.getField()
+		end
+		local ok, name = pcall(term.getField)
+		log = log .. tostring(ok) .. " " .. name .. " " .. ask()
+	`)
+
+	le.HandleInput("x")
+	waitGlobal(t, le, "log", "trigger ")
+	le.HandleInput("bob\r")
+	le.HandleInput("alice\r")
+	waitGlobal(t, le, "log", "trigger true bob alice")
+}
+
+func TestLoop_Yield(t *testing.T) {
+	le := newLoop(t)
+	go le.loop()
+	defer le.Disconnected()
+
+	le.luaState.SetGlobal("log", lua.LString(""))
+	for _, name := range []string{"a", "b"} {
+		startScript(t, le, `for i = 1, 2 do
+			log = log .. "`+name+`" .. i .. " "
+			coroutine.yield()
+		end`)
+	}
+	waitGlobal(t, le, "log", "a1 b1 a2 b2 ")
+}
+
+func TestLoop_PCall(t *testing.T) {
+	le := newLoop(t)
+
+	for _, code := range []string{
+		// the errors are the values given to error
+		`local e = {}
+		local ok, v = pcall(error, e)
+		assert(not ok and v == e)`,
+		`local ok, v = pcall(function() error("boom") end)
+		assert(not ok and v:find(":1: boom$"), v)`,
+		`local ok, v = pcall(function() error("boom", 0) end)
+		assert(not ok and v == "boom", v)`,
+		`local ok, v = pcall(nil)
+		assert(not ok and v == "attempt to call a nil value", v)`,
+		`assert(not pcall(xpcall, nil, print))`,
+		`assert(not pcall(xpcall, print, nil))`,
+
+		// the arguments and the results pass as they are
+		`local r = {pcall(function(...) return select("#", ...), ... end, 1, nil, 3, nil)}
+		assert(r[1] and r[2] == 4 and r[3] == 1 and r[5] == 3)`,
+		`local r = {xpcall(function(...) return select("#", ...) end, print, 1, 2)}
+		assert(r[1] and r[2] == 0 and #r == 2)`,
+
+		// the handler of xpcall runs where the error is raised
+		`local function boom()
+			local x = nil
+			return x.y
+		end
+		local ok, v = xpcall(boom, debug.traceback)
+		assert(not ok and v:find("stack traceback") and v:find("\n%s*<string>:3: in "), v)`,
+		`local depth
+		local ok, v = xpcall(function() error("boom") end, function(e)
+			depth = 0
+			while debug.getinfo(depth + 1) do
+				depth = depth + 1
+			end
+			return "handled " .. e
+		end)
+		assert(not ok and v:find("handled .*boom$") and depth > 2, v)`,
+		`local ok, v = xpcall(function() error("boom") end, function(e) error("again", 0) end)
+		assert(not ok and v == "again", v)`,
+		`local inner
+		local ok, v = xpcall(function()
+			inner = {pcall(error, "inner")}
+			error("outer", 0)
+		end, function(e) return "handled " .. e end)
+		assert(not ok and v == "handled outer" and not inner[1] and inner[2]:find("inner$"), v)`,
+
+		// pcall does not stop the yields of the coroutines
+		`local co = coroutine.create(function(a)
+			local ok, v = pcall(function() return coroutine.yield(a + 1) + 1 end)
+			assert(ok)
+			return v
+		end)
+		local ok, v = coroutine.resume(co, 1)
+		assert(ok and v == 2 and coroutine.status(co) == "suspended")
+		ok, v = coroutine.resume(co, 41)
+		assert(ok and v == 42 and coroutine.status(co) == "dead")`,
+		`local gen = coroutine.wrap(function()
+			xpcall(function()
+				for i = 1, 3 do coroutine.yield(i) end
+				error("stop", 0)
+			end, function(e) coroutine.yield(e) end)
+		end)
+		assert(gen() == 1 and gen() == 2 and gen() == 3)`,
+	} {
+		if err := le.luaState.DoString(code); err != nil {
+			t.Fatalf("%s: %v", code, err)
+		}
+	}
+}
+
+func TestLoop_WaitNested(t *testing.T) {
+	le := newLoop(t)
+	go le.loop()
+	defer le.Disconnected()
+
+	// a wait in xpcall in a coroutine of the script passes to the loop,
+	// the coroutine still gets its own yields
+	startScript(t, le, `
+		local term = require("term")
+		local co = coroutine.wrap(function()
+			local ok, name = xpcall(function()
+				coroutine.yield("first")
+				return term.getField()
+			end, debug.traceback)
+			coroutine.yield(name)
+		end)
+		log = co()
+		log = log .. " " .. co()
+	`)
+
+	waitGlobal(t, le, "log", "first")
+	le.HandleInput("bob\r")
+	waitGlobal(t, le, "log", "first bob")
+}
+
+func TestLoop_NestedField(t *testing.T) {
+	le := newLoop(t)
+	go le.loop()
+	defer le.Disconnected()
+
+	// the timer can not take the field the script is reading
+	startScript(t, le, `
+		local term = require("term")
+		timer("t", 5, function()
+			rmTrigger("t")
+			local ok, err = pcall(term.getField)
+			busy = tostring(not ok and err:find("already being read", 1, true) ~= nil)
+		end)
+		name = term.getField()
+	`)
+
+	waitGlobal(t, le, "busy", "true")
+	le.HandleInput("bob\r")
+	waitGlobal(t, le, "name", "bob")
+}
+
+func TestLoop_Timer(t *testing.T) {
+	le := newLoop(t)
+	go le.loop()
+	defer le.Disconnected()
+
+	startScript(t, le, `n = 0
+		timer("t", 5, function()
+			n = n + 1
+			if n == 3 then
+				rmTrigger("t")
+			end
+		end)`)
+	waitGlobal(t, le, "n", "3")
+	time.Sleep(30 * time.Millisecond)
+	if n := global(le, "n"); n != "3" {
+		t.Fatalf("Expected the timer removed, got %v runs", n)
+	}
+}
+
+func TestLoop_InitState(t *testing.T) {
+	le := newLoop(t)
+	dir := t.TempDir()
+	writeScript(t, dir, "init.lua", `local term = require("term")
+		term.getField()
+		error("not reached")`, time.Now())
+	proto, err := Compile(filepath.Join(dir, "init.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.Proto = proto
+
+	done := make(chan error)
+	go func() { done <- le.InitState() }()
+
+	// the script waits for the field until the session ends
+	le.HandleInput("abc")
+	time.Sleep(10 * time.Millisecond)
+	le.Disconnected()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected InitState to return")
+	}
+	if len(le.waits) != 0 {
+		t.Fatal("Expected the waits ended")
+	}
+
+	err = le.luaState.DoString(`require("term").getField()`)
+	if err == nil || !strings.Contains(err.Error(), "outside of a coroutine") {
+		t.Fatalf("Expected an error outside of a coroutine, got %v", err)
+	}
+}
+
+func TestLoop_Hooks(t *testing.T) {
+	le := newLoop(t)
+	dir := t.TempDir()
+	writeScript(t, dir, "init.lua", `log = ""
+		onConnect(function() log = log .. "connect " end)
+		onResize(function(w, h) log = log .. "resize " .. w .. "x" .. h .. " " end)
+		onIdle(0.02, function() log = log .. "idle " end)
+		onDisconnect(function() log = log .. "disconnect" end)
+		log = log .. "script "`, time.Now())
+	proto, err := Compile(filepath.Join(dir, "init.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.Proto = proto
+
+	done := make(chan error)
+	go func() { done <- le.InitState() }()
+	// the idle hook runs once until the user types again
+	waitGlobal(t, le, "log", "script connect idle ")
+
+	le.Term.SetSize(100, 30)
+	le.Resized()
+	waitGlobal(t, le, "log", "script connect idle resize 100x30 ")
+
+	le.HandleInput("a")
+	waitGlobal(t, le, "log", "script connect idle resize 100x30 idle ")
+
+	le.Disconnected()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := lua.LVAsString(le.luaState.GetGlobal("log")); got != "script connect idle resize 100x30 idle disconnect" {
+		t.Fatalf("Expected the disconnect hook, got %q", got)
+	}
+}
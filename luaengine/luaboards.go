@@ -0,0 +1,247 @@
+package luaengine
+
+import (
+	"errors"
+	"log"
+
+	"crg.eti.br/go/atomic/database"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var (
+	errAccessDenied = errors.New("access denied")
+	errReadOnly     = errors.New("guests can not post")
+)
+
+// allowedArea returns the area if the user has access to it.
+func (le *LuaExtender) allowedArea(id int) (database.Area, error) {
+	area, err := le.DB.GetArea(id)
+	if err != nil {
+		return database.Area{}, err
+	}
+
+	if !area.AllowedFor(le.User.Groups) {
+		return database.Area{}, errAccessDenied
+	}
+
+	return area, nil
+}
+
+// allowedThread returns the thread if the user has access to its area.
+func (le *LuaExtender) allowedThread(id int) (database.Thread, error) {
+	thread, err := le.DB.GetThread(id)
+	if err != nil {
+		return database.Thread{}, err
+	}
+
+	_, err = le.allowedArea(thread.AreaID)
+	if err != nil {
+		return database.Thread{}, err
+	}
+
+	return thread, nil
+}
+
+// canPost reports whether the user has an account to post with, the
+// guests and the users still registering have none.
+func (le *LuaExtender) canPost() bool {
+	return le.User != nil && le.User.ID != 0 &&
+		!le.userHasGroup("guest") && !le.userHasGroup("registration")
+}
+
+// pushError pushes nil and the error message, the way the board
+// functions report errors to Lua.
+func pushError(l *lua.LState, err error) int {
+	l.Push(lua.LNil)
+	l.Push(lua.LString(err.Error()))
+	return 2
+}
+
+func (le *LuaExtender) boardsAreas(l *lua.LState) int {
+	areas, err := le.DB.ListAreas()
+	if err != nil {
+		log.Printf("error listing areas, %v", err)
+		return pushError(l, err)
+	}
+
+	tbl := l.NewTable()
+	for _, a := range areas {
+		if !a.AllowedFor(le.User.Groups) {
+			continue
+		}
+
+		unread := 0
+		if le.canPost() {
+			unread, err = le.DB.CountUnread(le.User.ID, a.ID)
+			if err != nil {
+				log.Printf("error counting unread posts, %v", err)
+			}
+		}
+
+		row := l.NewTable()
+		l.SetField(row, "id", lua.LNumber(a.ID))
+		l.SetField(row, "name", lua.LString(a.Name))
+		l.SetField(row, "description", lua.LString(a.Description))
+		l.SetField(row, "unread", lua.LNumber(unread))
+		tbl.Append(row)
+	}
+	l.Push(tbl)
+	return 1
+}
+
+func (le *LuaExtender) boardsThreads(l *lua.LState) int {
+	area, err := le.allowedArea(l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	threads, err := le.DB.ListThreads(area.ID)
+	if err != nil {
+		log.Printf("error listing threads, %v", err)
+		return pushError(l, err)
+	}
+
+	tbl := l.NewTable()
+	for _, t := range threads {
+		row := l.NewTable()
+		l.SetField(row, "id", lua.LNumber(t.ID))
+		l.SetField(row, "subject", lua.LString(t.Subject))
+		l.SetField(row, "nickname", lua.LString(t.Nickname))
+		l.SetField(row, "posts", lua.LNumber(t.Posts))
+		l.SetField(row, "created_at", lua.LString(t.CreatedAt))
+		l.SetField(row, "updated_at", lua.LString(t.UpdatedAt))
+		tbl.Append(row)
+	}
+	l.Push(tbl)
+	return 1
+}
+
+func (le *LuaExtender) boardsPosts(l *lua.LState) int {
+	thread, err := le.allowedThread(l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	posts, err := le.DB.ListPosts(thread.ID)
+	if err != nil {
+		log.Printf("error listing posts, %v", err)
+		return pushError(l, err)
+	}
+
+	tbl := l.NewTable()
+	for _, p := range posts {
+		row := l.NewTable()
+		l.SetField(row, "id", lua.LNumber(p.ID))
+		l.SetField(row, "nickname", lua.LString(p.Nickname))
+		l.SetField(row, "body", lua.LString(p.Body))
+		l.SetField(row, "created_at", lua.LString(p.CreatedAt))
+		tbl.Append(row)
+	}
+	l.Push(tbl)
+	return 1
+}
+
+func (le *LuaExtender) boardsNewThread(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errReadOnly)
+	}
+
+	area, err := le.allowedArea(l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	thread, err := le.DB.CreateThread(area.ID, le.User.ID, l.ToString(2), l.ToString(3))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	l.Push(lua.LNumber(thread.ID))
+	return 1
+}
+
+func (le *LuaExtender) boardsReply(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errReadOnly)
+	}
+
+	thread, err := le.allowedThread(l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	post, err := le.DB.CreatePost(thread.ID, le.User.ID, l.ToString(2))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	l.Push(lua.LNumber(post.ID))
+	return 1
+}
+
+func (le *LuaExtender) boardsReadPointer(l *lua.LState) int {
+	area, err := le.allowedArea(l.CheckInt(1))
+	if err != nil || !le.canPost() {
+		l.Push(lua.LNumber(0))
+		return 1
+	}
+
+	postID, err := le.DB.GetReadPointer(le.User.ID, area.ID)
+	if err != nil {
+		log.Printf("error reading read pointer, %v", err)
+	}
+	l.Push(lua.LNumber(postID))
+	return 1
+}
+
+func (le *LuaExtender) boardsMarkRead(l *lua.LState) int {
+	area, err := le.allowedArea(l.CheckInt(1))
+	if err != nil || !le.canPost() {
+		return 0
+	}
+
+	err = le.DB.SetReadPointer(le.User.ID, area.ID, l.CheckInt(2))
+	if err != nil {
+		log.Printf("error setting read pointer, %v", err)
+	}
+	return 0
+}
+
+// boardsCreateArea creates a new area, only sysops can create areas.
+func (le *LuaExtender) boardsCreateArea(l *lua.LState) int {
+	if !le.userHasGroup("sysop") {
+		return pushError(l, errAccessDenied)
+	}
+
+	area, err := le.DB.CreateArea(l.CheckString(1), l.OptString(2, ""), l.OptString(3, ""))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	l.Push(lua.LNumber(area.ID))
+	return 1
+}
+
+func (le *LuaExtender) boardsCanPost(l *lua.LState) int {
+	l.Push(lua.LBool(le.canPost()))
+	return 1
+}
+
+func (le *LuaExtender) boardsLoader(L *lua.LState) int {
+	var boardsAPI = map[string]lua.LGFunction{
+		"areas":       le.boardsAreas,
+		"canPost":     le.boardsCanPost,
+		"createArea":  le.boardsCreateArea,
+		"markRead":    le.boardsMarkRead,
+		"newThread":   le.boardsNewThread,
+		"posts":       le.boardsPosts,
+		"readPointer": le.boardsReadPointer,
+		"reply":       le.boardsReply,
+		"threads":     le.boardsThreads,
+	}
+
+	t := L.NewTable()
+	L.SetFuncs(t, boardsAPI)
+	L.Push(t)
+	return 1
+}
@@ -0,0 +1,69 @@
+package luaengine
+
+import (
+	"crg.eti.br/go/atomic/chat"
+	"crg.eti.br/go/atomic/term"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// chatJoin enters the chat room, it returns when the user leaves the room.
+func (le *LuaExtender) chatJoin(l *lua.LState) int {
+	name := chat.RoomName(l.OptString(1, "lobby"))
+	if name == "" {
+		name = "lobby"
+	}
+
+	return le.await(l, func(w *wait) {
+		activity := le.Session.Activity()
+		le.Session.SetActivity("chat #" + name)
+
+		c := chat.NewClient(le.Term, le.User.Nickname)
+		left := false
+		release := le.captureInput(func(ev term.Event) {
+			if !left && c.Input(ev) {
+				left = true
+				w.resume()
+			}
+		})
+		w.cleanup = func() {
+			c.Leave()
+			release()
+			le.Session.SetActivity(activity)
+		}
+
+		c.Join(le.Chat, name)
+	})
+}
+
+// chatRooms returns a table with the rooms and their members.
+func (le *LuaExtender) chatRooms(l *lua.LState) int {
+	tbl := l.NewTable()
+	for _, name := range le.Chat.Rooms() {
+		r, ok := le.Chat.Room(name)
+		if !ok {
+			continue
+		}
+		members := l.NewTable()
+		for _, m := range r.Members() {
+			members.Append(lua.LString(m))
+		}
+		row := l.NewTable()
+		l.SetField(row, "name", lua.LString(name))
+		l.SetField(row, "members", members)
+		tbl.Append(row)
+	}
+	l.Push(tbl)
+	return 1
+}
+
+func (le *LuaExtender) chatLoader(L *lua.LState) int {
+	var chatAPI = map[string]lua.LGFunction{
+		"rooms": le.chatRooms,
+	}
+
+	t := L.NewTable()
+	L.SetFuncs(t, chatAPI)
+	le.setWaitFuncs(L, t, map[string]lua.LGFunction{"join": le.chatJoin})
+	L.Push(t)
+	return 1
+}
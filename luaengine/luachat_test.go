@@ -0,0 +1,84 @@
+package luaengine
+
+import (
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/chat"
+	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/session"
+)
+
+func TestLuaExtender_chatJoin(t *testing.T) {
+	le := newLoop(t)
+	le.Chat = chat.NewHub(10, nil)
+	le.User = &database.User{ID: 1, Nickname: "alice"}
+	le.Session = session.New("a", le.User, nil, nil)
+	le.Session.SetActivity("main menu")
+	le.luaState.PreloadModule("chat", le.chatLoader)
+	go le.loop()
+	defer le.Disconnected()
+
+	startScript(t, le, `
+		typed = ""
+		trigger("x", function() typed = typed .. "x" end)
+		local chat = require("chat")
+		chat.join(" Lobby ")
+		left = "yes"
+	`)
+
+	// the script waits in the room until the user leaves
+	var r *chat.Room
+	for i := 0; i < 100 && r == nil; i++ {
+		time.Sleep(5 * time.Millisecond)
+		r, _ = le.Chat.Room("lobby")
+	}
+	if r == nil {
+		t.Fatal("Expected the room created")
+	}
+	if m := r.Members(); len(m) != 1 || m[0] != "alice" {
+		t.Fatalf("Expected alice in the room, got %v", m)
+	}
+	if a := le.Session.Activity(); a != "chat #lobby" {
+		t.Fatalf("Expected the chat activity, got %q", a)
+	}
+
+	bob := &chatMember{nickname: "bob"}
+	r = le.Chat.Join("lobby", bob)
+	le.HandleInput("x hello\r")
+	le.HandleInput("/quit\r")
+	waitGlobal(t, le, "left", "yes")
+
+	if _, ok := le.Chat.Room("lobby"); !ok {
+		t.Fatal("Expected the room of bob kept")
+	}
+	if m := r.Members(); len(m) != 1 || m[0] != "bob" {
+		t.Fatalf("Expected alice out of the room, got %v", m)
+	}
+	if a := le.Session.Activity(); a != "main menu" {
+		t.Fatalf("Expected the activity restored, got %q", a)
+	}
+	var said []string
+	for _, line := range r.Scrollback() {
+		if line.Kind == chat.Message {
+			said = append(said, line.Nickname+" "+line.Text)
+		}
+	}
+	if len(said) != 1 || said[0] != "alice x hello" {
+		t.Fatalf("Expected the line typed said in the room, got %v", said)
+	}
+
+	// the keys go to the triggers again once the user left
+	if typed := global(le, "typed"); typed != "" {
+		t.Fatalf("Expected the keys typed in the room not to run triggers, got %q", typed)
+	}
+	le.HandleInput("x")
+	waitGlobal(t, le, "typed", "x")
+}
+
+type chatMember struct {
+	nickname string
+}
+
+func (m *chatMember) Nickname() string       { return m.nickname }
+func (m *chatMember) Deliver(line chat.Line) {}
@@ -1,9 +1,9 @@
 package luaengine
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -11,29 +11,60 @@ import (
 	"sync"
 	"time"
 
+	"crg.eti.br/go/atomic/chat"
 	"crg.eti.br/go/atomic/config"
 	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/session"
 	"crg.eti.br/go/atomic/term"
 	"github.com/creack/pty"
 	lua "github.com/yuin/gopher-lua"
-	"github.com/yuin/gopher-lua/parse"
 	"golang.org/x/crypto/ssh"
 )
 
+// keySequenceTimeout is how long a trigger with more than one key waits
+// for the next key.
+const keySequenceTimeout = 1500 * time.Millisecond
+
 // LuaExtender holds an instance of the moon interpreter and the state variables of the extensions we made.
 type LuaExtender struct {
 	mutex        sync.RWMutex
 	luaState     *lua.LState
 	triggerList  map[string]*lua.LFunction
+	onMessageFn  *lua.LFunction
+	hooks        map[string]*lua.LFunction
+	idleTimeout  time.Duration
+	idleTimer    *time.Timer
+	lastInput    time.Time
+	inputHandler func(term.Event)
+	rawHandler   func(string)
+	keySeq       []string
+	keySeqAt     time.Time
+	busy         bool // a trigger is running
+	done         chan struct{}
+	queueMutex   sync.Mutex
+	queue        []func()
+	wake         chan struct{}
+	running      *thread
+	waits        map[*wait]bool
+	waitToken    *lua.LUserData
+	waitWrapper  *lua.LFunction
 	Proto        *lua.FunctionProto
+	Scripts      *Scripts
+	DB           *database.Database
+	Chat         *chat.Hub
 	ExternalExec bool
-	Sessions     *map[string]*database.User
+	Sessions     *session.Registry
+	Session      *session.Session
 	User         *database.User
 	Term         *term.Term
 	ServerConn   *ssh.ServerConn
 	Conn         ssh.Channel
 	IsConnected  bool
 	Environment  map[string]string
+	cfg          config.Config
+	baseDir      string
+	execAllow    map[string]bool
+	budget       *budget
 }
 
 type KeyValue struct {
@@ -51,28 +82,35 @@ type Winsize struct {
 
 // New creates a new instance of LuaExtender.
 func New(cfg config.Config,
-	Sessions *map[string]*database.User,
-	user *database.User,
+	sessions *session.Registry,
+	sess *session.Session,
 	term *term.Term,
 	serverConn *ssh.ServerConn,
 	conn ssh.Channel,
 ) *LuaExtender {
 
 	le := &LuaExtender{
-		Sessions:    Sessions,
-		User:        user,
+		Sessions:    sessions,
+		Session:     sess,
+		User:        sess.User(),
 		Term:        term,
 		ServerConn:  serverConn,
 		Conn:        conn,
 		Environment: make(map[string]string),
 		IsConnected: true,
+		done:        make(chan struct{}),
+		cfg:         cfg,
+		baseDir:     baseDir(cfg.BaseBBSDir),
+		execAllow:   parseAllowlist(cfg.ExecAllowlist),
 	}
 	le.triggerList = make(map[string]*lua.LFunction)
-	le.luaState = lua.NewState()
+	le.luaState = le.newState(cfg)
+	le.installLoader()
+	le.initLoop()
 	le.luaState.SetGlobal("clearTriggers", le.luaState.NewFunction(le.ClearTriggers))
-	le.luaState.SetGlobal("exec", le.luaState.NewFunction(le.exec))
-	le.luaState.SetGlobal("execWithTriggers", le.luaState.NewFunction(le.execWithTriggers))
-	le.luaState.SetGlobal("execNonInteractive", le.luaState.NewFunction(le.execNonInteractive))
+	le.luaState.SetGlobal("exec", le.waitFunc(le.luaState, le.exec))
+	le.luaState.SetGlobal("execWithTriggers", le.waitFunc(le.luaState, le.execWithTriggers))
+	le.luaState.SetGlobal("execNonInteractive", le.waitFunc(le.luaState, le.execNonInteractive))
 	le.luaState.SetGlobal("fileExists", le.luaState.NewFunction(le.fileExists))
 	le.luaState.SetGlobal("getEnv", le.luaState.NewFunction(le.getEnv))
 	le.luaState.SetGlobal("logf", le.luaState.NewFunction(le.logf))
@@ -84,22 +122,40 @@ func New(cfg config.Config,
 	le.luaState.SetGlobal("getUser", le.luaState.NewFunction(le.getUser))
 	le.luaState.SetGlobal("hasGroup", le.luaState.NewFunction(le.hasGroup))
 	le.luaState.SetGlobal("readFile", le.luaState.NewFunction(le.readFile))
+	le.luaState.SetGlobal("createAccount", le.luaState.NewFunction(le.createAccount))
+	le.luaState.SetGlobal("listSessions", le.luaState.NewFunction(le.listSessions))
+	le.luaState.SetGlobal("setActivity", le.luaState.NewFunction(le.setActivity))
+	le.luaState.SetGlobal("sendMessage", le.luaState.NewFunction(le.sendMessage))
+	le.luaState.SetGlobal("onMessage", le.luaState.NewFunction(le.onMessage))
+	le.luaState.SetGlobal("onConnect", le.luaState.NewFunction(le.setHook("onConnect")))
+	le.luaState.SetGlobal("onResize", le.luaState.NewFunction(le.setHook("onResize")))
+	le.luaState.SetGlobal("onDisconnect", le.luaState.NewFunction(le.setHook("onDisconnect")))
+	le.luaState.SetGlobal("onIdle", le.luaState.NewFunction(le.onIdle))
+	le.luaState.SetGlobal("broadcast", le.luaState.NewFunction(le.broadcast))
 
 	le.luaState.PreloadModule("term", le.termLoader)
+	le.luaState.PreloadModule("chat", le.chatLoader)
+	le.luaState.PreloadModule("boards", le.boardsLoader)
+	le.luaState.PreloadModule("mail", le.mailLoader)
+	le.luaState.PreloadModule("ui", le.uiLoader)
 	return le
 }
 
 func (le *LuaExtender) hasGroup(l *lua.LState) int {
 	group := l.ToString(1)
+	l.Push(lua.LBool(le.userHasGroup(group)))
+	return 1
+}
+
+// userHasGroup reports whether the user belongs to the group.
+func (le *LuaExtender) userHasGroup(group string) bool {
 	groups := strings.Split(le.User.Groups, ",")
 	for _, g := range groups {
 		if g == group {
-			l.Push(lua.LBool(true))
-			return 1
+			return true
 		}
 	}
-	l.Push(lua.LBool(false))
-	return 1
+	return false
 }
 
 func (le *LuaExtender) getUser(l *lua.LState) int {
@@ -115,6 +171,46 @@ func (le *LuaExtender) getUser(l *lua.LState) int {
 	return 1
 }
 
+// createAccount creates the account of a user connected in registration
+// mode using the nickname of the connection and the public key offered
+// by the client, if any. It returns true on success or false and the
+// error message.
+func (le *LuaExtender) createAccount(l *lua.LState) int {
+	email := strings.TrimSpace(l.ToString(1))
+	password := l.ToString(2)
+
+	if le.ServerConn.Permissions == nil ||
+		le.ServerConn.Permissions.Extensions["registration"] == "" {
+		l.Push(lua.LBool(false))
+		l.Push(lua.LString("not in registration mode"))
+		return 2
+	}
+
+	if !strings.Contains(email, "@") {
+		l.Push(lua.LBool(false))
+		l.Push(lua.LString("invalid email"))
+		return 2
+	}
+
+	publicKey := le.ServerConn.Permissions.Extensions["pubkey"]
+	user, err := le.DB.CreateUser(le.User.Nickname, email, password, publicKey, "")
+	if err != nil {
+		log.Printf("error creating user %q, %v", le.User.Nickname, err)
+		l.Push(lua.LBool(false))
+		l.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	log.Printf("user %q registered", user.Nickname)
+
+	le.User = &user
+	le.Session.SetUser(&user)
+	delete(le.ServerConn.Permissions.Extensions, "registration")
+
+	l.Push(lua.LBool(true))
+	return 1
+}
+
 func (le *LuaExtender) logf(l *lua.LState) int {
 	format := l.ToString(1)
 	args := make([]interface{}, l.GetTop()-1)
@@ -139,25 +235,6 @@ func (le *LuaExtender) GetState() *lua.LState {
 	return le.luaState
 }
 
-// CompileLua reads the passed lua file from disk and compiles it.
-func (le *LuaExtender) Compile(filePath string) (*lua.FunctionProto, error) {
-	file, err := os.Open(filePath)
-	defer file.Close()
-	if err != nil {
-		return nil, err
-	}
-	reader := bufio.NewReader(file)
-	chunk, err := parse.Parse(reader, filePath)
-	if err != nil {
-		return nil, err
-	}
-	proto, err := lua.Compile(chunk, filePath)
-	if err != nil {
-		return nil, err
-	}
-	return proto, nil
-}
-
 // DoCompiledFile takes a FunctionProto, as returned by CompileLua, and runs it in the LState. It is equivalent
 // to calling DoFile on the LState with the original source file.
 func (le *LuaExtender) DoCompiledFile(L *lua.LState, proto *lua.FunctionProto) error {
@@ -166,9 +243,27 @@ func (le *LuaExtender) DoCompiledFile(L *lua.LState, proto *lua.FunctionProto) e
 	return L.PCall(0, lua.MultRet, nil)
 }
 
-// InitState starts the lua interpreter with a script.
+// InitState runs the script in a coroutine and then the event loop of
+// the session, the function set by onConnect runs when the main chunk of
+// the script returns. It returns when the session ends, the script
+// fails or the scripts pass the memory limit.
 func (le *LuaExtender) InitState() error {
-	return le.DoCompiledFile(le.luaState, le.Proto)
+	var err error
+	le.post(func() {
+		le.start(le.luaState.NewFunctionFromProto(le.Proto), func(e error) {
+			if e != nil {
+				err = e
+				le.Disconnected()
+				return
+			}
+			le.runHook("onConnect")
+		})
+	})
+	le.loop()
+	if err == nil && le.budget != nil && le.budget.Err() == errMemoryLimit {
+		err = errMemoryLimit
+	}
+	return err
 }
 
 // getEnv returns the value of the environment variable named by the key.
@@ -179,25 +274,174 @@ func (le *LuaExtender) getEnv(l *lua.LState) int {
 	return 1
 }
 
-// RunTrigger executes a pre-configured trigger.
-func (le *LuaExtender) RunTrigger(name string) (bool, error) {
+// HandleInput queues the input read from the connection in the event
+// loop, see input.
+func (le *LuaExtender) HandleInput(k string) {
+	le.post(func() { le.input(k) })
+}
+
+// input decodes the input and routes the events. A command run by exec
+// receives the input as it is. When a component captured the input it
+// receives everything, otherwise the event runs the trigger with its
+// name or goes to the terminal. While a trigger is running the input
+// goes to the terminal.
+func (le *LuaExtender) input(k string) {
+	le.touch()
+
+	le.mutex.RLock()
+	raw := le.rawHandler
+	le.mutex.RUnlock()
+	if raw != nil {
+		raw(k)
+		return
+	}
+
+	le.dispatch(le.Term.Decode(k))
+
+	if le.Term.InputPending() {
+		// a lone escape is the escape key if nothing follows it
+		time.AfterFunc(term.EscapeTimeout, func() {
+			le.post(func() { le.dispatch(le.Term.FlushInput()) })
+		})
+	}
+}
+
+func (le *LuaExtender) dispatch(events []term.Event) {
+	for _, ev := range events {
+		le.mutex.RLock()
+		h := le.inputHandler
+		le.mutex.RUnlock()
+
+		if h != nil {
+			h(ev)
+			continue
+		}
+
+		if le.busy {
+			le.Term.InputEvent(ev)
+			continue
+		}
+
+		f, pending := le.matchTrigger(ev.String())
+		if f != nil {
+			le.busy = true
+			le.start(f, func(err error) {
+				le.busy = false
+				if err != nil {
+					log.Println("error RunTrigger", err.Error())
+					le.Conn.Close()
+				}
+			})
+			continue
+		}
+
+		if pending {
+			continue
+		}
+
+		le.Term.InputEvent(ev)
+	}
+}
+
+// matchTrigger adds the key to the sequence being typed and returns the
+// trigger of the sequence, pending is true when the sequence is the
+// start of a longer trigger.
+func (le *LuaExtender) matchTrigger(name string) (f *lua.LFunction, pending bool) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+
+	if len(le.keySeq) > 0 && time.Since(le.keySeqAt) > keySequenceTimeout {
+		le.keySeq = nil
+	}
+
+	for {
+		seq := append(append([]string{}, le.keySeq...), name)
+		keys := strings.Join(seq, " ")
+
+		if f, ok := le.triggerList[keys]; ok {
+			le.keySeq = nil
+			return f, false
+		}
+
+		for k := range le.triggerList {
+			if strings.HasPrefix(k, keys+" ") {
+				le.keySeq = seq
+				le.keySeqAt = time.Now()
+				return nil, true
+			}
+		}
+
+		if len(le.keySeq) == 0 {
+			return nil, false
+		}
+
+		// the sequence does not match, try the key alone
+		le.keySeq = nil
+	}
+}
+
+// captureInput sends all the input to h until release is called.
+func (le *LuaExtender) captureInput(h func(term.Event)) (release func()) {
+	le.mutex.Lock()
+	previous := le.inputHandler
+	le.inputHandler = h
+	le.mutex.Unlock()
+
+	return func() {
+		le.mutex.Lock()
+		le.inputHandler = previous
+		le.mutex.Unlock()
+	}
+}
+
+// captureRaw sends the input to h before it is decoded until release
+// is called.
+func (le *LuaExtender) captureRaw(h func(string)) (release func()) {
+	le.mutex.Lock()
+	previous := le.rawHandler
+	le.rawHandler = h
+	le.mutex.Unlock()
+
+	return func() {
+		le.mutex.Lock()
+		le.rawHandler = previous
+		le.mutex.Unlock()
+	}
+}
+
+// Disconnected is called when the connection is closed, it releases
+// the functions waiting for input.
+func (le *LuaExtender) Disconnected() {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+
+	le.IsConnected = false
+	select {
+	case <-le.done:
+	default:
+		close(le.done)
+	}
+}
+
+// RunTrigger queues a pre-configured trigger in the event loop, it
+// returns false if there is no trigger with the name.
+func (le *LuaExtender) RunTrigger(name string) bool {
+	le.mutex.RLock()
 	f, ok := le.triggerList[name]
+	le.mutex.RUnlock()
 	if !ok {
-		return false, nil
+		return false
 	}
 
-	err := le.luaState.CallByParam(lua.P{
-		Fn:      f,    // Lua function
-		NRet:    0,    // number of returned values
-		Protect: true, // return err or panic
-	})
-	return true, err
+	le.post(func() { le.start(f, logError("trigger "+name)) })
+	return true
 }
 
 func (le *LuaExtender) removeTrigger(l *lua.LState) int {
 	n := l.ToString(1) // name
 	le.mutex.Lock()
-	delete(le.triggerList, n)
+	delete(le.triggerList, n) // timers use the name as it is
+	delete(le.triggerList, triggerKeys(n))
 	le.mutex.Unlock()
 	return 0
 }
@@ -205,6 +449,7 @@ func (le *LuaExtender) removeTrigger(l *lua.LState) int {
 func (le *LuaExtender) ClearTriggers(l *lua.LState) int {
 	le.mutex.Lock()
 	le.triggerList = make(map[string]*lua.LFunction)
+	le.keySeq = nil
 	le.mutex.Unlock()
 	return 0
 }
@@ -222,33 +467,41 @@ func (le *LuaExtender) timer(l *lua.LState) int {
 	le.triggerList[n] = f
 	le.mutex.Unlock()
 
-	go func() {
-		for {
-			<-time.After(time.Duration(t) * time.Millisecond)
-			le.mutex.Lock()
-			_, ok := le.triggerList[n]
-			le.mutex.Unlock()
-			if !le.IsConnected || !ok {
-				return
-			}
-			le.mutex.Lock()
-			ok, err := le.RunTrigger(n)
-			le.mutex.Unlock()
-			if err != nil {
-				log.Println(n, "timer trigger error", err)
-				return
-			}
-			if !ok {
+	le.schedule(n, f, time.Duration(t)*time.Millisecond)
+	return 0
+}
+
+// schedule runs the timer in the event loop after d and again d after
+// it returns, until the timer is removed or replaced.
+func (le *LuaExtender) schedule(n string, f *lua.LFunction, d time.Duration) {
+	time.AfterFunc(d, func() {
+		le.post(func() {
+			le.mutex.RLock()
+			current := le.triggerList[n]
+			le.mutex.RUnlock()
+			if current != f {
 				return
 			}
-		}
-	}()
+			le.start(f, func(err error) {
+				if err != nil {
+					log.Println(n, "timer trigger error", err)
+					return
+				}
+				le.schedule(n, f, d)
+			})
+		})
+	})
+}
 
-	return 0
+// triggerKeys returns the canonical form of the keys of a trigger.
+func triggerKeys(keys string) string {
+	return strings.Join(term.ParseKeys(keys), " ")
 }
 
+// trigger runs the function when the user types the keys, a key name
+// like "1", "up", "f1", "ctrl+c" or a sequence like "ctrl+x ctrl+s".
 func (le *LuaExtender) trigger(l *lua.LState) int {
-	a := l.ToString(1)
+	a := triggerKeys(l.ToString(1))
 	f := l.ToFunction(2)
 
 	le.mutex.Lock()
@@ -264,8 +517,6 @@ func (le *LuaExtender) quit(l *lua.LState) int {
 	le.Conn.Close()
 	le.IsConnected = false
 	le.ServerConn.Conn.Close()
-	sessionID := fmt.Sprintf("%x", le.ServerConn.SessionID())
-	delete(*le.Sessions, sessionID)
 	return 0
 }
 
@@ -292,23 +543,36 @@ func fileExists(filename string) bool {
 }
 
 func (le *LuaExtender) fileExists(l *lua.LState) int {
-	filename := l.ToString(1)
-	res := lua.LBool(fileExists(filename))
+	filename, err := le.path(l.ToString(1))
+	res := lua.LBool(err == nil && fileExists(filename))
 	l.Push(res)
 	return 1
 }
 
-func (le *LuaExtender) exec(l *lua.LState) int {
+// execArgs returns the command and the arguments of the exec functions.
+func execArgs(l *lua.LState) (string, []string) {
 	name := l.ToString(1)
 	args := make([]string, l.GetTop()-1)
 	for i := 2; i <= l.GetTop(); i++ {
 		args[i-2] = l.ToString(i)
 	}
+	return name, args
+}
+
+// execPty runs the command in a pty shown in the terminal, input sends
+// it the input of the user. The coroutine waits for the command to end,
+// the command is killed if the session ends first.
+func (le *LuaExtender) execPty(l *lua.LState, input func(w io.Writer) (release func())) int {
+	name, args := execArgs(l)
+	if err := le.allowExec(name); err != nil {
+		log.Printf("exec %v: %v", name, err)
+		return pushError(l, err)
+	}
 
-	le.ExternalExec = true
 	npty, ntty, err := pty.Open()
 	if err != nil {
 		log.Printf("could not start pty (%s)", err)
+		return pushError(l, err)
 	}
 
 	cmd := exec.Command(name, args...)
@@ -317,185 +581,118 @@ func (le *LuaExtender) exec(l *lua.LState) int {
 	cmd.Stderr = ntty
 	setCtrlTerm(cmd)
 
-	if err := cmd.Start(); err != nil {
+	err = cmd.Start()
+	ntty.Close()
+	if err != nil {
 		cmdlog := name + " " + strings.Join(args, " ")
 		log.Printf("failed to start %v (%s)", cmdlog, err)
+		npty.Close()
 		return 0
 	}
 
-	go func() {
-		for {
-			b := make([]byte, 8)
-			n, err := npty.Read(b)
-			if err != nil {
-				log.Printf("1 -> n: %v (%v)", n, err)
-				return
-			}
+	return le.await(l, func(w *wait) {
+		le.mutex.Lock()
+		le.ExternalExec = true
+		le.mutex.Unlock()
 
-			le.Term.WriteString(string(b[:n]))
-			//_, err = le.Conn.Write(b[:n])
-			//if err != nil {
-			//	log.Printf("1 <- n: %v (%v)", n, err)
-			//	return
-			//}
-			if !le.IsConnected {
-				return
-			}
+		release := input(npty)
+		w.cleanup = func() {
+			release()
+			cmd.Process.Kill()
+			npty.Close()
+			le.mutex.Lock()
+			le.ExternalExec = false
+			le.mutex.Unlock()
 		}
-	}()
-
-	go func() {
-		b := make([]byte, 1024)
-		for {
-			n, err := le.Conn.Read(b)
-			if err != nil {
-				log.Printf("2 -> n: %v (%v)", n, err)
-				return
-			}
-			_, err = npty.Write(b[:n])
-			if err != nil {
-				log.Printf("2 <- n: %v (%v) %q", n, err, b[:n])
-				ok, err := le.RunTrigger(string(b[:n]))
+
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			b := make([]byte, 1024)
+			for {
+				n, err := npty.Read(b)
 				if err != nil {
-					log.Println("error RunTrigger", err.Error())
 					return
 				}
-				if !ok {
-					le.Input(string(b[:n]))
-				}
-
-				return
-			}
-			if !le.IsConnected {
-				return
+				le.Term.WriteString(string(b[:n]))
 			}
-		}
-	}()
+		}()
 
-	go func() {
-		var w, h int
-		var sizeAux string
+		go le.followSize(npty)
 
-		for {
-			// TODO: improve using a channels
-			le.mutex.Lock()
-			if !le.ExternalExec {
-				le.mutex.Unlock()
-				return
-			}
-			le.mutex.Unlock()
-			time.Sleep(100 * time.Millisecond)
-			w = le.Term.Width
-			h = le.Term.Height
-			if sizeAux == fmt.Sprintf("%d;%d", w, h) {
-				continue
+		go func() {
+			cmd.Wait()
+			select {
+			case <-drained:
+			case <-time.After(100 * time.Millisecond):
 			}
+			w.post()
+		}()
+	})
+}
 
+// followSize sets the size of the pty to the size of the terminal while
+// the command runs.
+func (le *LuaExtender) followSize(npty *os.File) {
+	var w, h int
+	var sizeAux string
+
+	for {
+		// TODO: improve using a channels
+		le.mutex.Lock()
+		if !le.ExternalExec {
+			le.mutex.Unlock()
+			return
+		}
+		le.mutex.Unlock()
+		w, h = le.Term.GetSize()
+		if sizeAux != fmt.Sprintf("%d;%d", w, h) {
 			SetWinsize(npty.Fd(), w, h)
 			sizeAux = fmt.Sprintf("%d;%d", w, h)
-
-			if !le.IsConnected {
-				return
-			}
 		}
-	}()
-
-	cmd.Wait()
-	le.mutex.Lock()
-	le.ExternalExec = false
-	le.mutex.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
 
-	return 0
+// exec runs an interactive command, it receives the input of the user.
+func (le *LuaExtender) exec(l *lua.LState) int {
+	return le.execPty(l, func(w io.Writer) func() {
+		return le.captureRaw(func(s string) {
+			w.Write([]byte(s))
+		})
+	})
 }
 
+// execWithTriggers runs a command while the keys run the triggers with
+// their name, the other keys go to the terminal.
 func (le *LuaExtender) execWithTriggers(l *lua.LState) int {
-	name := l.ToString(1)
-	args := make([]string, l.GetTop()-1)
-	for i := 2; i <= l.GetTop(); i++ {
-		args[i-2] = l.ToString(i)
-	}
-
-	npty, ntty, err := pty.Open()
-	if err != nil {
-		log.Printf("could not start pty (%s)", err)
-	}
-
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = ntty
-	cmd.Stdin = ntty
-	cmd.Stderr = ntty
-	setCtrlTerm(cmd)
-
-	if err := cmd.Start(); err != nil {
-		cmdlog := name + " " + strings.Join(args, " ")
-		log.Printf("failed to start %v (%s)", cmdlog, err)
-		return 0
-	}
-
-	go func() {
-		for {
-			b := make([]byte, 8)
-			n, err := npty.Read(b)
-			if err != nil {
-				log.Printf("1 -> n: %v (%v)", n, err)
-				return
-			}
-
-			le.Term.WriteString(string(b[:n]))
-			//_, err = le.Conn.Write(b[:n])
-			//if err != nil {
-			//	log.Printf("1 <- n: %v (%v)", n, err)
-			//	return
-			//}
-			if !le.IsConnected {
-				return
-			}
-		}
-	}()
-
-	go func() {
-		b := make([]byte, 1024)
-		for {
-			n, err := le.Conn.Read(b)
-			if err != nil {
-				log.Printf("2 -> n: %v (%v)", n, err)
-				return
-			}
-
-			k := string(b[:n])
-			ok, err := le.RunTrigger(k)
-			if err != nil {
-				log.Println("error RunTrigger", err.Error())
-				break
-			}
+	return le.execPty(l, func(io.Writer) func() {
+		return le.captureInput(func(ev term.Event) {
+			le.mutex.RLock()
+			f, ok := le.triggerList[ev.String()]
+			le.mutex.RUnlock()
 			if !ok {
-				le.Input(k)
-			}
-
-			if !le.IsConnected {
+				le.Term.InputEvent(ev)
 				return
 			}
-		}
-	}()
-
-	cmd.Wait()
-	le.ExternalExec = false
-
-	return 0
+			le.start(f, logError("trigger "+ev.String()))
+		})
+	})
 }
 
+// execNonInteractive runs a command and returns its output, the output
+// is shown in the terminal.
 func (le *LuaExtender) execNonInteractive(l *lua.LState) int {
 	var outb, errb bytes.Buffer
-	name := l.ToString(1)
-	args := make([]string, l.GetTop()-1)
-	for i := 2; i <= l.GetTop(); i++ {
-		args[i-2] = l.ToString(i)
+	name, args := execArgs(l)
+	if err := le.allowExec(name); err != nil {
+		log.Printf("exec %v: %v", name, err)
+		return pushError(l, err)
 	}
 
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
-	//cmd.Stdin =
 
 	if err := cmd.Start(); err != nil {
 		cmdlog := name + " " + strings.Join(args, " ")
@@ -503,23 +700,25 @@ func (le *LuaExtender) execNonInteractive(l *lua.LState) int {
 		return 0
 	}
 
-	cmd.Wait()
+	return le.await(l, func(w *wait) {
+		w.cleanup = func() { cmd.Process.Kill() }
 
-	le.Term.WriteString(outb.String())
-	if errb.String() != "" {
-		cmdlog := name + " " + strings.Join(args, " ")
-		log.Printf("exec %v: %v", cmdlog, errb.String())
-	}
-
-	le.ExternalExec = false
+		go func() {
+			cmd.Wait()
 
-	l.Push(lua.LString(outb.String()))
-	return 1
+			le.Term.WriteString(outb.String())
+			if errb.String() != "" {
+				cmdlog := name + " " + strings.Join(args, " ")
+				log.Printf("exec %v: %v", cmdlog, errb.String())
+			}
+			w.post(lua.LString(outb.String()))
+		}()
+	})
 }
 
 func (le *LuaExtender) readFile(l *lua.LState) int {
 	file := l.ToString(1)
-	content, err := os.ReadFile(file)
+	content, err := le.readBBSFile(file)
 	if err != nil {
 		log.Printf("error reading file %v, %v", file, err)
 		return 0
@@ -0,0 +1,250 @@
+package luaengine
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/session"
+	lua "github.com/yuin/gopher-lua"
+	"golang.org/x/crypto/ssh"
+	_ "modernc.org/sqlite"
+)
+
+func TestLuaExtender_matchTrigger(t *testing.T) {
+	type step struct {
+		key     string
+		want    string // the keys of the trigger run, "" for none
+		pending bool
+		expire  bool // the time of a sequence passed before the key
+	}
+	tests := []struct {
+		name     string
+		triggers []string
+		steps    []step
+	}{
+		{"key", []string{"1", "2"}, []step{
+			{key: "1", want: "1"},
+			{key: "3"},
+			{key: "2", want: "2"},
+		}},
+		{"sequence", []string{"ctrl+x ctrl+c", "ctrl+x ctrl+s"}, []step{
+			{key: "ctrl+x", pending: true},
+			{key: "ctrl+s", want: "ctrl+x ctrl+s"},
+			{key: "ctrl+x", pending: true},
+			{key: "ctrl+c", want: "ctrl+x ctrl+c"},
+		}},
+		{"key after a broken sequence", []string{"ctrl+x ctrl+c", "1"}, []step{
+			{key: "ctrl+x", pending: true},
+			{key: "1", want: "1"},
+			{key: "ctrl+c"},
+		}},
+		{"sequence timeout", []string{"ctrl+x ctrl+c", "ctrl+c"}, []step{
+			{key: "ctrl+x", pending: true},
+			{key: "ctrl+c", want: "ctrl+c", expire: true},
+			{key: "ctrl+x", pending: true},
+			{key: "ctrl+c", want: "ctrl+x ctrl+c"},
+		}},
+		{"legacy word", []string{"help", "h"}, []step{
+			{key: "h", want: "h"},
+		}},
+		{"legacy word letters", []string{"help"}, []step{
+			{key: "h", pending: true},
+			{key: "e", pending: true},
+			{key: "l", pending: true},
+			{key: "p", want: "h e l p"},
+		}},
+		{"ctrl letters", []string{"ctrl+i", "ctrl+m", "ctrl+h"}, []step{
+			{key: "tab", want: "tab"},
+			{key: "enter", want: "enter"},
+			{key: "backspace", want: "backspace"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			le := newLoop(t)
+			for _, keys := range tt.triggers {
+				le.luaState.SetGlobal("keys", lua.LString(keys))
+				err := le.luaState.DoString(`trigger(keys, function() end)`)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, s := range tt.steps {
+				if s.expire {
+					le.keySeqAt = le.keySeqAt.Add(-keySequenceTimeout - time.Second)
+				}
+				f, pending := le.matchTrigger(s.key)
+				if pending != s.pending {
+					t.Fatalf("step %d %q: expected pending %v", i, s.key, s.pending)
+				}
+				if s.want == "" {
+					if f != nil {
+						t.Fatalf("step %d %q: expected no trigger", i, s.key)
+					}
+					continue
+				}
+				if f == nil || f != le.triggerList[s.want] {
+					t.Fatalf("step %d %q: expected the trigger %q", i, s.key, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLuaExtender_canPost(t *testing.T) {
+	tests := []struct {
+		user database.User
+		want bool
+	}{
+		{database.User{ID: 1, Nickname: "alice", Groups: "users"}, true},
+		{database.User{ID: 1, Nickname: "sysop", Groups: "users,sysop"}, true},
+		{database.User{ID: 0, Nickname: "guest", Groups: "guest"}, false},
+		{database.User{ID: 0, Nickname: "bob", Groups: "registration"}, false},
+		{database.User{ID: 0, Nickname: "carol", Groups: "users"}, false},
+		{database.User{ID: 2, Nickname: "dave", Groups: "registration"}, false},
+	}
+
+	for _, tt := range tests {
+		le := &LuaExtender{User: &tt.user}
+		if got := le.canPost(); got != tt.want {
+			t.Fatalf("canPost of %+v = %v, expected %v", tt.user, got, tt.want)
+		}
+	}
+}
+
+// newTestDB returns a new database in a temporary directory.
+func newTestDB(t *testing.T) *database.Database {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db, err := database.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newPublicKey(t *testing.T) string {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(key))
+}
+
+// registering returns the engine of a connection in registration mode,
+// with createAccount called by the script.
+func registering(t *testing.T, db *database.Database, nickname, publicKey string) *LuaExtender {
+	user := &database.User{Nickname: nickname, Groups: "registration"}
+	le := &LuaExtender{
+		DB:      db,
+		User:    user,
+		Session: session.New("1", user, nil, nil),
+		ServerConn: &ssh.ServerConn{Permissions: &ssh.Permissions{
+			Extensions: map[string]string{
+				"registration": "true",
+				"nickname":     nickname,
+				"pubkey":       publicKey,
+			},
+		}},
+		luaState: lua.NewState(),
+	}
+	t.Cleanup(le.luaState.Close)
+	le.luaState.SetGlobal("createAccount", le.luaState.NewFunction(le.createAccount))
+	return le
+}
+
+func createAccount(t *testing.T, le *LuaExtender, email, password string) (bool, string) {
+	l := le.luaState
+	err := l.CallByParam(lua.P{Fn: l.GetGlobal("createAccount"), NRet: 2, Protect: true},
+		lua.LString(email), lua.LString(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, msg := l.Get(-2), l.Get(-1)
+	l.Pop(2)
+	return lua.LVAsBool(ok), lua.LVAsString(msg)
+}
+
+func TestLuaExtender_createAccount(t *testing.T) {
+	db := newTestDB(t)
+	usedKey := newPublicKey(t)
+	_, err := db.CreateUser("alice", "alice@test", "", usedKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a user already logged in
+	le := registering(t, db, "alice", "")
+	delete(le.ServerConn.Permissions.Extensions, "registration")
+	if ok, msg := createAccount(t, le, "alice@test", "password123"); ok || msg != "not in registration mode" {
+		t.Fatalf("Expected not in registration mode, got %v %q", ok, msg)
+	}
+
+	le = registering(t, db, "bob", "")
+	if ok, msg := createAccount(t, le, "bob", "password123"); ok || msg != "invalid email" {
+		t.Fatalf("Expected an invalid email, got %v %q", ok, msg)
+	}
+
+	// the nickname registered by another connection in the meantime
+	le = registering(t, db, "alice", "")
+	if ok, _ := createAccount(t, le, "other@test", "password123"); ok {
+		t.Fatal("Expected an error for a nickname in use")
+	}
+
+	// the key of another user, the account is not created
+	le = registering(t, db, "bob", usedKey)
+	if ok, _ := createAccount(t, le, "bob@test", ""); ok {
+		t.Fatal("Expected an error for a key in use")
+	}
+	if _, err := db.GetUserByNickname("bob"); err == nil {
+		t.Fatal("Expected bob not created")
+	}
+
+	key := newPublicKey(t)
+	le = registering(t, db, "bob", key)
+	if ok, msg := createAccount(t, le, " bob@test ", ""); !ok {
+		t.Fatalf("Expected the account created, got %q", msg)
+	}
+	if le.User.ID == 0 || le.User.Email != "bob@test" || le.Session.User() != le.User {
+		t.Fatalf("Expected the session of the new user, got %+v", le.User)
+	}
+	if le.ServerConn.Permissions.Extensions["registration"] != "" {
+		t.Fatal("Expected the registration mode ended")
+	}
+	keys, err := db.ListUserKeys(le.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].PublicKey != strings.TrimSpace(key) {
+		t.Fatalf("Expected the key of the connection, got %+v", keys)
+	}
+
+	// the account is created once
+	if ok, msg := createAccount(t, le, "bob@test", ""); ok || msg != "not in registration mode" {
+		t.Fatalf("Expected not in registration mode, got %v %q", ok, msg)
+	}
+}
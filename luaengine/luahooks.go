@@ -0,0 +1,96 @@
+package luaengine
+
+import (
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// The hooks are the functions the scripts set to run when the session
+// changes: when the script is loaded, when the terminal is resized, when
+// the user goes idle and when the connection drops. They are set and run
+// in the event loop, each call in a coroutine of its own.
+
+// setHook returns the function that sets the hook with the name, called
+// with nil it removes the hook.
+func (le *LuaExtender) setHook(name string) lua.LGFunction {
+	return func(l *lua.LState) int {
+		f := l.OptFunction(1, nil)
+		if f == nil {
+			delete(le.hooks, name)
+			return 0
+		}
+		le.hooks[name] = f
+		return 0
+	}
+}
+
+// runHook starts the hook with the name if the script has set it.
+func (le *LuaExtender) runHook(name string, args ...lua.LValue) {
+	f := le.hooks[name]
+	if f == nil {
+		return
+	}
+	le.start(f, logError(name), args...)
+}
+
+// Resized runs the function set by onResize with the new width and
+// height, the server calls it after the terminal size changes.
+func (le *LuaExtender) Resized() {
+	w, h := le.Term.GetSize()
+	le.post(func() {
+		le.runHook("onResize", lua.LNumber(w), lua.LNumber(h))
+	})
+}
+
+// onIdle sets the function called with the idle time in seconds when the
+// user has typed nothing for the given seconds, it is called again only
+// after the user types. Call onIdle(nil) to remove the function.
+func (le *LuaExtender) onIdle(l *lua.LState) int {
+	d := time.Duration(float64(l.OptNumber(1, 0)) * float64(time.Second))
+	f := l.OptFunction(2, nil)
+
+	le.stopIdle()
+	if f == nil || d <= 0 {
+		delete(le.hooks, "onIdle")
+		return 0
+	}
+	le.hooks["onIdle"] = f
+	le.idleTimeout = d
+
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		le.post(func() { le.idle(t) })
+	})
+	le.idleTimer = t
+	return 0
+}
+
+// idle runs the function set by onIdle if the user is still idle, a
+// timer replaced by another onIdle is ignored.
+func (le *LuaExtender) idle(t *time.Timer) {
+	if t != le.idleTimer {
+		return
+	}
+	idle := time.Since(le.lastInput)
+	if idle < le.idleTimeout {
+		t.Reset(le.idleTimeout - idle)
+		return
+	}
+	le.runHook("onIdle", lua.LNumber(int(idle.Seconds())))
+}
+
+// touch records the input of the user and restarts the idle timer.
+func (le *LuaExtender) touch() {
+	le.lastInput = time.Now()
+	if le.idleTimer != nil {
+		le.idleTimer.Reset(le.idleTimeout)
+	}
+}
+
+func (le *LuaExtender) stopIdle() {
+	if le.idleTimer != nil {
+		le.idleTimer.Stop()
+		le.idleTimer = nil
+	}
+}
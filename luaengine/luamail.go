@@ -0,0 +1,187 @@
+package luaengine
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"crg.eti.br/go/atomic/database"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var errNoMailbox = errors.New("guests do not have a mailbox")
+
+func mailTable(l *lua.LState, m database.Mail, withBody bool) *lua.LTable {
+	t := l.NewTable()
+	l.SetField(t, "id", lua.LNumber(m.ID))
+	l.SetField(t, "from", lua.LString(m.FromNickname))
+	l.SetField(t, "to", lua.LString(m.ToNickname))
+	l.SetField(t, "subject", lua.LString(m.Subject))
+	l.SetField(t, "created_at", lua.LString(m.CreatedAt))
+	l.SetField(t, "unread", lua.LBool(m.Unread()))
+	if withBody {
+		l.SetField(t, "body", lua.LString(m.Body))
+	}
+	return t
+}
+
+func mailList(l *lua.LState, mail []database.Mail) *lua.LTable {
+	t := l.NewTable()
+	for _, m := range mail {
+		t.Append(mailTable(l, m, false))
+	}
+	return t
+}
+
+func (le *LuaExtender) mailSend(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	to, err := le.DB.GetUserByNickname(l.CheckString(1))
+	if err != nil {
+		return pushError(l, errors.New("user not found"))
+	}
+
+	m, err := le.DB.SendMail(le.User.ID, to.ID, l.ToString(2), l.ToString(3), 0)
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	le.Sessions.Send(to.Nickname, le.User.Nickname, "new mail: "+m.Subject)
+
+	l.Push(lua.LNumber(m.ID))
+	return 1
+}
+
+func (le *LuaExtender) mailInbox(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	mail, err := le.DB.ListInbox(le.User.ID)
+	if err != nil {
+		log.Printf("error listing inbox, %v", err)
+		return pushError(l, err)
+	}
+
+	l.Push(mailList(l, mail))
+	return 1
+}
+
+func (le *LuaExtender) mailSent(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	mail, err := le.DB.ListSent(le.User.ID)
+	if err != nil {
+		log.Printf("error listing sent mail, %v", err)
+		return pushError(l, err)
+	}
+
+	l.Push(mailList(l, mail))
+	return 1
+}
+
+// mailRead returns the message with its body and marks it as read.
+func (le *LuaExtender) mailRead(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	m, err := le.DB.GetMail(le.User.ID, l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	if m.ToUserID == le.User.ID && m.Unread() {
+		err = le.DB.MarkMailRead(le.User.ID, m.ID)
+		if err != nil {
+			log.Printf("error marking mail as read, %v", err)
+		}
+	}
+
+	l.Push(mailTable(l, m, true))
+	return 1
+}
+
+// mailReply answers a message, the reply goes to the other side of
+// the conversation.
+func (le *LuaExtender) mailReply(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	m, err := le.DB.GetMail(le.User.ID, l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	to, nickname := m.FromUserID, m.FromNickname
+	if m.FromUserID == le.User.ID {
+		to, nickname = m.ToUserID, m.ToNickname
+	}
+
+	subject := m.Subject
+	if !strings.HasPrefix(subject, "Re: ") {
+		subject = "Re: " + subject
+	}
+
+	r, err := le.DB.SendMail(le.User.ID, to, subject, l.ToString(2), m.ID)
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	le.Sessions.Send(nickname, le.User.Nickname, "new mail: "+r.Subject)
+
+	l.Push(lua.LNumber(r.ID))
+	return 1
+}
+
+func (le *LuaExtender) mailDelete(l *lua.LState) int {
+	if !le.canPost() {
+		return pushError(l, errNoMailbox)
+	}
+
+	err := le.DB.DeleteMail(le.User.ID, l.CheckInt(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	l.Push(lua.LTrue)
+	return 1
+}
+
+// mailUnread returns the number of unread messages, to be checked at login.
+func (le *LuaExtender) mailUnread(l *lua.LState) int {
+	if !le.canPost() {
+		l.Push(lua.LNumber(0))
+		return 1
+	}
+
+	n, err := le.DB.CountUnreadMail(le.User.ID)
+	if err != nil {
+		log.Printf("error counting unread mail, %v", err)
+	}
+
+	l.Push(lua.LNumber(n))
+	return 1
+}
+
+func (le *LuaExtender) mailLoader(L *lua.LState) int {
+	var mailAPI = map[string]lua.LGFunction{
+		"delete": le.mailDelete,
+		"inbox":  le.mailInbox,
+		"read":   le.mailRead,
+		"reply":  le.mailReply,
+		"send":   le.mailSend,
+		"sent":   le.mailSent,
+		"unread": le.mailUnread,
+	}
+
+	t := L.NewTable()
+	L.SetFuncs(t, mailAPI)
+	L.Push(t)
+	return 1
+}
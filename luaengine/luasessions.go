@@ -0,0 +1,83 @@
+package luaengine
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// listSessions returns a table with the users connected to the BBS,
+// ordered by node number.
+func (le *LuaExtender) listSessions(l *lua.LState) int {
+	tbl := l.NewTable()
+	for _, s := range le.Sessions.List() {
+		u := s.User()
+		row := l.NewTable()
+		l.SetField(row, "node", lua.LNumber(s.Node))
+		l.SetField(row, "nickname", lua.LString(u.Nickname))
+		l.SetField(row, "idle", lua.LNumber(int(s.Idle().Seconds())))
+		l.SetField(row, "activity", lua.LString(s.Activity()))
+		l.SetField(row, "connected_at", lua.LString(s.ConnectedAt.Format("2006-01-02 15:04:05")))
+		l.SetField(row, "self", lua.LBool(s == le.Session))
+		tbl.Append(row)
+	}
+	l.Push(tbl)
+	return 1
+}
+
+// setActivity changes what the user is doing as shown to the other users.
+func (le *LuaExtender) setActivity(l *lua.LState) int {
+	le.Session.SetActivity(l.ToString(1))
+	return 0
+}
+
+// sendMessage sends a message to every session of the user with the
+// given nickname and returns the number of sessions reached.
+func (le *LuaExtender) sendMessage(l *lua.LState) int {
+	nickname := l.ToString(1)
+	text := l.ToString(2)
+	n := le.Sessions.Send(nickname, le.User.Nickname, text)
+	l.Push(lua.LNumber(n))
+	return 1
+}
+
+// broadcast sends a message to every connected user, only sysops can broadcast.
+func (le *LuaExtender) broadcast(l *lua.LState) int {
+	if !le.userHasGroup("sysop") {
+		l.Push(lua.LNumber(0))
+		return 1
+	}
+	text := l.ToString(1)
+	n := le.Sessions.SendAll(le.User.Nickname, text)
+	l.Push(lua.LNumber(n))
+	return 1
+}
+
+// onMessage sets the function called with the nickname of the sender
+// and the text when a message arrives, with no function the message is
+// shown in the last line of the screen. Call onMessage(nil) to remove
+// the function.
+func (le *LuaExtender) onMessage(l *lua.LState) int {
+	f := l.OptFunction(1, nil)
+	le.mutex.Lock()
+	le.onMessageFn = f
+	le.mutex.Unlock()
+	return 0
+}
+
+// Message delivers a message sent by another user, the function set by
+// onMessage runs in the event loop of the session.
+func (le *LuaExtender) Message(from, text string) {
+	le.mutex.RLock()
+	f := le.onMessageFn
+	le.mutex.RUnlock()
+
+	if f == nil {
+		le.Term.Notify(fmt.Sprintf(" message from %s: %s ", from, text))
+		return
+	}
+
+	le.post(func() {
+		le.start(f, logError("onMessage"), lua.LString(from), lua.LString(text))
+	})
+}
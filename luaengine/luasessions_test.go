@@ -0,0 +1,82 @@
+package luaengine
+
+import (
+	"testing"
+
+	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/session"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// newSessions returns the engine of the session of alice, connected
+// after the session of bob.
+func newSessions(t *testing.T) (*LuaExtender, *session.Registry) {
+	sessions := session.NewRegistry()
+	bob := session.New("b", &database.User{Nickname: "bob"}, nil, nil)
+	sessions.Add(bob)
+	alice := session.New("a", &database.User{Nickname: "alice"}, nil, nil)
+	sessions.Add(alice)
+
+	le := &LuaExtender{
+		Sessions: sessions,
+		Session:  alice,
+		User:     alice.User(),
+		luaState: lua.NewState(),
+	}
+	t.Cleanup(le.luaState.Close)
+	le.luaState.SetGlobal("listSessions", le.luaState.NewFunction(le.listSessions))
+	le.luaState.SetGlobal("setActivity", le.luaState.NewFunction(le.setActivity))
+	return le, sessions
+}
+
+func TestLuaExtender_listSessions(t *testing.T) {
+	le, sessions := newSessions(t)
+
+	err := le.luaState.DoString(`
+		local list = listSessions()
+		assert(#list == 2, #list)
+
+		local bob, alice = list[1], list[2]
+		assert(bob.node == 1 and bob.nickname == "bob" and not bob.self)
+		assert(alice.node == 2 and alice.nickname == "alice" and alice.self)
+		assert(alice.activity == "logging in", alice.activity)
+		assert(alice.idle == 0, alice.idle)
+		assert(alice.connected_at:match("^%d%d%d%d%-%d%d%-%d%d %d%d:%d%d:%d%d$"), alice.connected_at)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the node of a session that left is free for the next one
+	sessions.Remove("b")
+	err = le.luaState.DoString(`
+		local list = listSessions()
+		assert(#list == 1 and list[1].nickname == "alice" and list[1].node == 2)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLuaExtender_setActivity(t *testing.T) {
+	le, sessions := newSessions(t)
+
+	err := le.luaState.DoString(`
+		setActivity("message boards")
+		for _, s in ipairs(listSessions()) do
+			if s.self then
+				assert(s.activity == "message boards", s.activity)
+			else
+				assert(s.activity == "logging in", s.activity)
+			end
+		end
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := sessions.Get("a")
+	if s.Activity() != "message boards" {
+		t.Fatalf("Expected the activity of the session set, got %q", s.Activity())
+	}
+}
@@ -1,13 +1,12 @@
 package luaengine
 
 import (
-	"bufio"
 	"encoding/base64"
-	"io"
 	"log"
-	"os"
 	"strings"
+	"sync"
 
+	"crg.eti.br/go/atomic/term"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -18,11 +17,65 @@ func (le *LuaExtender) write(l *lua.LState) int {
 	return 0
 }
 
+// writeFromASCII writes a CP437 ANSI art file, it returns true or nil
+// and the error if the file can not be read.
 func (le *LuaExtender) writeFromASCII(l *lua.LState) int {
-	s := l.ToString(1)
-	le.Term.WriteFromASCII(s)
+	s, err := le.path(l.CheckString(1))
+	if err == nil {
+		err = le.Term.WriteFromASCII(s)
+	}
+	if err != nil {
+		return pushError(l, err)
+	}
+	l.Push(lua.LTrue)
+	return 1
+}
 
-	return 0
+// sauce returns the SAUCE record of an ANSI art file as a table, nil
+// if it has none or nil and the error if the file can not be read.
+func (le *LuaExtender) sauce(l *lua.LState) int {
+	b, err := le.readBBSFile(l.CheckString(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+	_, s := term.ParseSauce(b)
+	if s == nil {
+		l.Push(lua.LNil)
+		return 1
+	}
+
+	comments := l.NewTable()
+	for _, c := range s.Comments {
+		comments.Append(lua.LString(c))
+	}
+
+	tbl := l.NewTable()
+	l.SetField(tbl, "title", lua.LString(s.Title))
+	l.SetField(tbl, "author", lua.LString(s.Author))
+	l.SetField(tbl, "group", lua.LString(s.Group))
+	l.SetField(tbl, "date", lua.LString(s.Date))
+	l.SetField(tbl, "width", lua.LNumber(s.Width))
+	l.SetField(tbl, "height", lua.LNumber(s.Height))
+	l.SetField(tbl, "iceColors", lua.LBool(s.ICEColors))
+	l.SetField(tbl, "font", lua.LString(s.Font))
+	l.SetField(tbl, "comments", comments)
+	l.Push(tbl)
+	return 1
+}
+
+// page shows a file or a text in the pager, it returns true when the
+// user quits or nil and the error if the file can not be read.
+func (le *LuaExtender) page(l *lua.LState) int {
+	s := l.CheckString(1)
+	p, err := le.path(s)
+	return le.await(l, func(w *wait) {
+		quit := func() { w.resume(lua.LTrue) }
+		if strings.ContainsAny(s, "\r\n") || err != nil || !fileExists(p) {
+			le.Term.ShowPage(s, quit)
+		} else if err := le.Term.ShowPageFile(p, quit); err != nil {
+			w.resume(lua.LNil, lua.LString(err.Error()))
+		}
+	})
 }
 
 func (le *LuaExtender) cls(l *lua.LState) int {
@@ -56,6 +109,46 @@ func (le *LuaExtender) setOutputDelay(l *lua.LState) int {
 	return 0
 }
 
+// setBaudRate emulates a line from 300 to 115200 baud, 0 turns it off.
+// It returns true or nil and the error for an invalid rate.
+func (le *LuaExtender) setBaudRate(l *lua.LState) int {
+	if err := le.Term.SetBaudRate(l.CheckInt(1)); err != nil {
+		return pushError(l, err)
+	}
+	l.Push(lua.LTrue)
+	return 1
+}
+
+// playANSI plays an ANSI art file at a baud rate, 9600 by default, a key
+// skips to the end. It returns true when played to the end, false when
+// skipped or nil and the error if the file can not be read.
+func (le *LuaExtender) playANSI(l *lua.LState) int {
+	b, err := le.readBBSFile(l.CheckString(1))
+	if err != nil {
+		return pushError(l, err)
+	}
+
+	baud := l.OptInt(2, 9600)
+	return le.await(l, func(w *wait) {
+		skip := make(chan struct{})
+		var once sync.Once
+		stop := func() { once.Do(func() { close(skip) }) }
+		release := le.captureInput(func(ev term.Event) {
+			if ev.Type == term.EventKey {
+				stop()
+			}
+		})
+		w.cleanup = func() {
+			release()
+			stop()
+		}
+
+		go func() {
+			w.post(lua.LBool(le.Term.PlayANSI(b, baud, skip)))
+		}()
+	})
+}
+
 func (le *LuaExtender) setOutputMode(l *lua.LState) int {
 	s := l.ToString(1)
 	le.Term.SetOutputMode(s)
@@ -65,14 +158,10 @@ func (le *LuaExtender) setOutputMode(l *lua.LState) int {
 func (le *LuaExtender) inlineImagesProtocol(l *lua.LState) int {
 	s := l.ToString(1)
 
-	f, err := os.Open(s)
-	if err != nil {
-		log.Println(err)
-	}
-	reader := bufio.NewReader(f)
-	content, err := io.ReadAll(reader)
+	content, err := le.readBBSFile(s)
 	if err != nil {
 		log.Println(err)
+		return 0
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(content)
@@ -84,10 +173,78 @@ func (le *LuaExtender) inlineImagesProtocol(l *lua.LState) int {
 	return 0
 }
 
+// readField waits for the user to type a line, shown when echo is true.
+// A trigger or a timer can not read a field while another coroutine is
+// reading one, it raises an error.
+func (le *LuaExtender) readField(l *lua.LState, echo bool) int {
+	return le.await(l, func(w *wait) {
+		err := le.Term.ReadField(echo, func(s string) {
+			w.resume(lua.LString(s))
+		})
+		if err != nil {
+			w.end()
+			l.RaiseError(err.Error())
+		}
+	})
+}
+
 func (le *LuaExtender) getField(l *lua.LState) int {
-	res := lua.LString(le.Term.GetField())
-	l.Push(res)
-	return 1
+	return le.readField(l, true)
+}
+
+// editText opens the full-screen editor, it returns the text and
+// true if the user saved it.
+func (le *LuaExtender) editText(l *lua.LState) int {
+	initial := l.OptString(1, "")
+	return le.await(l, func(w *wait) {
+		le.Term.StartEditText(initial, func(text string, saved bool) {
+			w.resume(lua.LString(text), lua.LBool(saved))
+		})
+	})
+}
+
+// setBuffered turns on or off the buffered output, while on the
+// writes are sent to the terminal by flush.
+func (le *LuaExtender) setBuffered(l *lua.LState) int {
+	le.Term.SetBuffered(l.ToBool(1))
+	return 0
+}
+
+// flush sends the cells changed since the last flush.
+func (le *LuaExtender) flush(l *lua.LState) int {
+	le.Term.Flush()
+	return 0
+}
+
+// repaint draws the whole screen again.
+func (le *LuaExtender) repaint(l *lua.LState) int {
+	le.Term.Repaint()
+	return 0
+}
+
+// capabilities returns a table with the capabilities of the terminal,
+// the terminal is queried on the first call. The replies arrive in the
+// event loop while the coroutine waits.
+func (le *LuaExtender) capabilities(l *lua.LState) int {
+	return le.await(l, func(w *wait) {
+		go func() {
+			c := le.Term.Capabilities(le.Environment)
+			le.post(func() { w.resume(le.capabilitiesTable(c)) })
+		}()
+	})
+}
+
+func (le *LuaExtender) capabilitiesTable(c term.Capabilities) *lua.LTable {
+	tbl := le.luaState.NewTable()
+	tbl.RawSetString("termType", lua.LString(c.TermType))
+	tbl.RawSetString("version", lua.LString(c.Version))
+	tbl.RawSetString("encoding", lua.LString(c.Encoding.String()))
+	tbl.RawSetString("colors", lua.LNumber(c.ColorDepth.Colors()))
+	tbl.RawSetString("inlineImages", lua.LBool(c.InlineImages))
+	tbl.RawSetString("sixel", lua.LBool(c.Sixel))
+	tbl.RawSetString("mouse", lua.LBool(c.Mouse))
+	tbl.RawSetString("responded", lua.LBool(c.Responded))
+	return tbl
 }
 
 func (le *LuaExtender) getOutputMode(l *lua.LState) int {
@@ -97,9 +254,7 @@ func (le *LuaExtender) getOutputMode(l *lua.LState) int {
 }
 
 func (le *LuaExtender) getPassword(l *lua.LState) int {
-	res := lua.LString(le.Term.GetField())
-	l.Push(res)
-	return 1
+	return le.readField(l, false)
 }
 
 func (le *LuaExtender) drawBox(l *lua.LState) int {
@@ -135,27 +290,85 @@ func (le *LuaExtender) moveCursor(l *lua.LState) int {
 	return 0
 }
 
-/*
-ResetScreen()
-EnterScreen()
-ExitScreen()
-SetOutputMode(mode string)
-SetInputLimit(limit int)
-SetOutputDelay(delay int)
-DrawBox(row, col, width, height int)
-GetSize() (int, int)
-SetColor(color string)
-SetBackgroundColor(color string)
-SetColorRGB(r, g, b int)
-SetBackgroundColorRGB(r, g, b int)
-SetBold()
-SetUnderline()
-SetBlink()
-SetReverse()
-SetInvisible()
-Reset()
-SetCursorVisible(visible bool)
-*/
+// checkColor returns the color argument, a number from 0 to 255 or a
+// name like "red", "brightblue" or "#rrggbb".
+func checkColor(l *lua.LState, n int) term.Color {
+	if v, ok := l.Get(n).(lua.LNumber); ok {
+		if v != lua.LNumber(int(v)) || v < 0 || v > 255 {
+			l.ArgError(n, term.ErrInvalidColor.Error())
+		}
+		return term.Color(v)
+	}
+	c, err := term.ParseColor(l.CheckString(n))
+	if err != nil {
+		l.ArgError(n, err.Error())
+	}
+	return c
+}
+
+func (le *LuaExtender) setColor(l *lua.LState) int {
+	le.Term.SetColor(checkColor(l, 1))
+	return 0
+}
+
+func (le *LuaExtender) setBackgroundColor(l *lua.LState) int {
+	le.Term.SetBackgroundColor(checkColor(l, 1))
+	return 0
+}
+
+// checkByte returns the argument, a number from 0 to 255.
+func checkByte(l *lua.LState, n int) uint8 {
+	v := l.CheckInt(n)
+	if v < 0 || v > 255 {
+		l.ArgError(n, "value out of range 0-255")
+	}
+	return uint8(v)
+}
+
+func (le *LuaExtender) setColorRGB(l *lua.LState) int {
+	le.Term.SetColorRGB(checkByte(l, 1), checkByte(l, 2), checkByte(l, 3))
+	return 0
+}
+
+func (le *LuaExtender) setBackgroundColorRGB(l *lua.LState) int {
+	le.Term.SetBackgroundColorRGB(checkByte(l, 1), checkByte(l, 2), checkByte(l, 3))
+	return 0
+}
+
+func (le *LuaExtender) setBold(l *lua.LState) int {
+	le.Term.SetBold()
+	return 0
+}
+
+func (le *LuaExtender) setUnderline(l *lua.LState) int {
+	le.Term.SetUnderline()
+	return 0
+}
+
+func (le *LuaExtender) setBlink(l *lua.LState) int {
+	le.Term.SetBlink()
+	return 0
+}
+
+func (le *LuaExtender) setReverse(l *lua.LState) int {
+	le.Term.SetReverse()
+	return 0
+}
+
+func (le *LuaExtender) setInvisible(l *lua.LState) int {
+	le.Term.SetInvisible()
+	return 0
+}
+
+func (le *LuaExtender) reset(l *lua.LState) int {
+	le.Term.Reset()
+	return 0
+}
+
+func (le *LuaExtender) setCursorVisible(l *lua.LState) int {
+	le.Term.SetCursorVisible(l.ToBool(1))
+	return 0
+}
 
 func (le *LuaExtender) resetScreen(l *lua.LState) int {
 	le.Term.ResetScreen()
@@ -187,30 +400,55 @@ func (le *LuaExtender) printMultipleLines(l *lua.LState) int {
 
 func (le *LuaExtender) termLoader(L *lua.LState) int {
 	var termAPI = map[string]lua.LGFunction{
-		"cls":                  le.cls,
-		"drawBox":              le.drawBox,
-		"enterScreen":          le.enterScreen,
-		"exitScreen":           le.exitScreen,
-		"getField":             le.getField,
-		"getOutputMode":        le.getOutputMode,
-		"getPassword":          le.getPassword,
-		"getSize":              le.getSize,
-		"inlineImagesProtocol": le.inlineImagesProtocol,
-		"moveCursor":           le.moveCursor,
-		"print":                le.print,
-		"resetScreen":          le.resetScreen,
-		"setEcho":              le.setEcho,
-		"setInputLimit":        le.setInputLimit,
-		"setMaxInputLength":    le.setMaxInputLength,
-		"setOutputDelay":       le.setOutputDelay,
-		"setOutputMode":        le.setOutputMode,
-		"write":                le.write,
-		"writeFromASCII":       le.writeFromASCII,
-		"printMultipleLines":   le.printMultipleLines,
+		"cls":                   le.cls,
+		"drawBox":               le.drawBox,
+		"enterScreen":           le.enterScreen,
+		"exitScreen":            le.exitScreen,
+		"flush":                 le.flush,
+		"getOutputMode":         le.getOutputMode,
+		"getSize":               le.getSize,
+		"inlineImagesProtocol":  le.inlineImagesProtocol,
+		"moveCursor":            le.moveCursor,
+		"print":                 le.print,
+		"repaint":               le.repaint,
+		"reset":                 le.reset,
+		"sauce":                 le.sauce,
+		"resetScreen":           le.resetScreen,
+		"setBackgroundColor":    le.setBackgroundColor,
+		"setBaudRate":           le.setBaudRate,
+		"setBackgroundColorRGB": le.setBackgroundColorRGB,
+		"setBlink":              le.setBlink,
+		"setBold":               le.setBold,
+		"setBuffered":           le.setBuffered,
+		"setColor":              le.setColor,
+		"setColorRGB":           le.setColorRGB,
+		"setCursorVisible":      le.setCursorVisible,
+		"setEcho":               le.setEcho,
+		"setInputLimit":         le.setInputLimit,
+		"setInvisible":          le.setInvisible,
+		"setMaxInputLength":     le.setMaxInputLength,
+		"setOutputDelay":        le.setOutputDelay,
+		"setOutputMode":         le.setOutputMode,
+		"setReverse":            le.setReverse,
+		"setUnderline":          le.setUnderline,
+		"write":                 le.write,
+		"writeFromASCII":        le.writeFromASCII,
+		"printMultipleLines":    le.printMultipleLines,
+	}
+
+	// the functions that wait for the user
+	var termWaits = map[string]lua.LGFunction{
+		"capabilities": le.capabilities,
+		"editText":     le.editText,
+		"getField":     le.getField,
+		"getPassword":  le.getPassword,
+		"page":         le.page,
+		"playANSI":     le.playANSI,
 	}
 
-	t := le.luaState.NewTable()
-	le.luaState.SetFuncs(t, termAPI)
-	le.luaState.Push(t)
+	t := L.NewTable()
+	L.SetFuncs(t, termAPI)
+	le.setWaitFuncs(L, t, termWaits)
+	L.Push(t)
 	return 1
 }
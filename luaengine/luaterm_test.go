@@ -0,0 +1,30 @@
+package luaengine
+
+import "testing"
+
+func TestTerm_Colors(t *testing.T) {
+	le := newLoop(t)
+
+	for _, code := range []string{
+		`local term = require("term") term.setColor(9) term.setColor("red") term.setColorRGB(0, 128, 255)`,
+		`local term = require("term") term.setBackgroundColor(255) term.setBackgroundColorRGB(255, 255, 255)`,
+	} {
+		if err := le.luaState.DoString(code); err != nil {
+			t.Fatalf("%s: %v", code, err)
+		}
+	}
+
+	for _, code := range []string{
+		`require("term").setColor(-5)`,
+		`require("term").setColor(300)`,
+		`require("term").setColor(1.5)`,
+		`require("term").setColor("300")`,
+		`require("term").setBackgroundColor(256)`,
+		`require("term").setColorRGB(0, 256, 0)`,
+		`require("term").setBackgroundColorRGB(-1, 0, 0)`,
+	} {
+		if err := le.luaState.DoString(code); err == nil {
+			t.Fatalf("%s: expected an error", code)
+		}
+	}
+}
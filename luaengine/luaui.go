@@ -0,0 +1,222 @@
+package luaengine
+
+import (
+	"errors"
+
+	"crg.eti.br/go/atomic/term"
+	"crg.eti.br/go/atomic/ui"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// runWidget draws the widget and sends it the input until it is done,
+// the screen below the widget is restored after. The coroutine is
+// resumed with the values returned by result.
+func (le *LuaExtender) runWidget(l *lua.LState, w ui.Widget, cursor bool, result func() []lua.LValue) int {
+	return le.await(l, func(wt *wait) {
+		saved := le.Term.Screen()
+		done := false
+		release := le.captureInput(func(ev term.Event) {
+			if !done && w.Input(ev) {
+				done = true
+				wt.resume(result()...)
+			}
+		})
+		wt.cleanup = func() {
+			release()
+			le.Term.Restore(saved)
+		}
+
+		le.Term.SetCursorVisible(cursor)
+		w.Draw()
+	})
+}
+
+// tableInt returns the integer field of a table, def if not set.
+func tableInt(l *lua.LState, tbl *lua.LTable, name string, def int) int {
+	if v, ok := l.GetField(tbl, name).(lua.LNumber); ok {
+		return int(v)
+	}
+	return def
+}
+
+func tableString(l *lua.LState, tbl *lua.LTable, name string) string {
+	v := l.GetField(tbl, name)
+	if v == lua.LNil {
+		return ""
+	}
+	return lua.LVAsString(v)
+}
+
+// listOptions reads the title, position and size of a list or menu.
+func listOptions(l *lua.LState, tbl *lua.LTable, list *ui.List) {
+	list.Row = tableInt(l, tbl, "row", 0)
+	list.Col = tableInt(l, tbl, "col", 0)
+	list.Width = tableInt(l, tbl, "width", 0)
+	list.Height = tableInt(l, tbl, "height", 0)
+	list.Selected = tableInt(l, tbl, "selected", 1) - 1
+	if list.Selected < 0 || list.Selected >= len(list.Items) {
+		list.Selected = 0
+	}
+}
+
+// uiMenu shows a menu, the items are strings or tables with key and
+// label. It returns the index and the key of the selected item or nil
+// if the user pressed esc.
+func (le *LuaExtender) uiMenu(l *lua.LState) int {
+	opts := l.CheckTable(1)
+
+	var items []ui.MenuItem
+	if tbl, ok := l.GetField(opts, "items").(*lua.LTable); ok {
+		tbl.ForEach(func(_, v lua.LValue) {
+			if it, ok := v.(*lua.LTable); ok {
+				items = append(items, ui.MenuItem{
+					Key:   tableString(l, it, "key"),
+					Label: tableString(l, it, "label"),
+				})
+				return
+			}
+			items = append(items, ui.MenuItem{Label: lua.LVAsString(v)})
+		})
+	}
+
+	menu := ui.NewMenu(le.Term, tableString(l, opts, "title"), items)
+	listOptions(l, opts, menu)
+
+	return le.runWidget(l, menu, false, func() []lua.LValue {
+		if menu.Canceled {
+			return []lua.LValue{lua.LNil}
+		}
+		return []lua.LValue{lua.LNumber(menu.Selected + 1), lua.LString(items[menu.Selected].Key)}
+	})
+}
+
+// uiList shows a scrollable list of strings, it returns the index and
+// the selected item or nil if the user pressed esc.
+func (le *LuaExtender) uiList(l *lua.LState) int {
+	opts := l.CheckTable(1)
+
+	var items []string
+	if tbl, ok := l.GetField(opts, "items").(*lua.LTable); ok {
+		tbl.ForEach(func(_, v lua.LValue) {
+			items = append(items, lua.LVAsString(v))
+		})
+	}
+
+	list := ui.NewList(le.Term, tableString(l, opts, "title"), items)
+	listOptions(l, opts, list)
+
+	return le.runWidget(l, list, false, func() []lua.LValue {
+		if list.Canceled {
+			return []lua.LValue{lua.LNil}
+		}
+		return []lua.LValue{lua.LNumber(list.Selected + 1), lua.LString(items[list.Selected])}
+	})
+}
+
+// uiForm shows a form, the fields are tables with name, label, value,
+// password, required, max and a validate function that returns an
+// error message for an invalid value. It returns a table with the
+// values by name, or by index for the fields without name, or nil if
+// the user pressed esc.
+func (le *LuaExtender) uiForm(l *lua.LState) int {
+	opts := l.CheckTable(1)
+
+	var (
+		fields []ui.Field
+		names  []string
+	)
+	if tbl, ok := l.GetField(opts, "fields").(*lua.LTable); ok {
+		tbl.ForEach(func(_, v lua.LValue) {
+			fd, ok := v.(*lua.LTable)
+			if !ok {
+				return
+			}
+			name := tableString(l, fd, "name")
+			label := tableString(l, fd, "label")
+			if label == "" {
+				label = name
+			}
+			fields = append(fields, ui.Field{
+				Label:     label,
+				Value:     tableString(l, fd, "value"),
+				Password:  lua.LVAsBool(l.GetField(fd, "password")),
+				Required:  lua.LVAsBool(l.GetField(fd, "required")),
+				MaxLength: tableInt(l, fd, "max", 0),
+				Validate:  le.luaValidate(l.GetField(fd, "validate")),
+			})
+			names = append(names, name)
+		})
+	}
+
+	form := ui.NewForm(le.Term, tableString(l, opts, "title"), fields)
+	form.Row = tableInt(l, opts, "row", 0)
+	form.Col = tableInt(l, opts, "col", 0)
+	form.Width = tableInt(l, opts, "width", 0)
+
+	return le.runWidget(l, form, true, func() []lua.LValue {
+		if form.Canceled {
+			return []lua.LValue{lua.LNil}
+		}
+		tbl := le.luaState.NewTable()
+		for i, v := range form.Values() {
+			if names[i] == "" {
+				tbl.RawSetInt(i+1, lua.LString(v))
+				continue
+			}
+			tbl.RawSetString(names[i], lua.LString(v))
+		}
+		return []lua.LValue{tbl}
+	})
+}
+
+// luaValidate returns the validation of a form field made by a Lua
+// function that returns an error message for an invalid value. It runs
+// in the event loop while the form has the input, so it can not wait.
+func (le *LuaExtender) luaValidate(v lua.LValue) func(string) error {
+	f, ok := v.(*lua.LFunction)
+	if !ok {
+		return nil
+	}
+	return func(value string) error {
+		l := le.luaState
+		err := l.CallByParam(lua.P{Fn: f, NRet: 1, Protect: true}, lua.LString(value))
+		if err != nil {
+			return err
+		}
+		msg := l.Get(-1)
+		l.Pop(1)
+		if msg != lua.LNil && msg != lua.LFalse {
+			return errors.New(lua.LVAsString(msg))
+		}
+		return nil
+	}
+}
+
+// uiConfirm asks a yes or no question, it returns true for yes.
+func (le *LuaExtender) uiConfirm(l *lua.LState) int {
+	d := ui.NewConfirm(le.Term, l.CheckString(1), l.OptString(2, ""))
+	return le.runWidget(l, d, false, func() []lua.LValue {
+		return []lua.LValue{lua.LBool(!d.Canceled && d.Selected == 0)}
+	})
+}
+
+// uiMessage shows a message until the user presses enter or esc.
+func (le *LuaExtender) uiMessage(l *lua.LState) int {
+	d := ui.NewMessage(le.Term, l.CheckString(1), l.OptString(2, ""))
+	return le.runWidget(l, d, false, func() []lua.LValue { return nil })
+}
+
+func (le *LuaExtender) uiLoader(L *lua.LState) int {
+	var uiAPI = map[string]lua.LGFunction{
+		"confirm": le.uiConfirm,
+		"form":    le.uiForm,
+		"list":    le.uiList,
+		"menu":    le.uiMenu,
+		"message": le.uiMessage,
+	}
+
+	t := L.NewTable()
+	le.setWaitFuncs(L, t, uiAPI)
+	L.Push(t)
+	return 1
+}
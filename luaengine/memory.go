@@ -0,0 +1,150 @@
+package luaengine
+
+import (
+	"unsafe"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// memoryCheckInterval is the number of instructions between the counts
+// of the memory reachable by the scripts of a session.
+const memoryCheckInterval = 1 << 20
+
+// The sizes of the values are estimated, the overhead of the Go values
+// behind the Lua values and not the exact memory used.
+const (
+	valueSize = 16
+	tableSize = 64
+	funcSize  = 64
+)
+
+// usage counts the memory of the values reachable by the scripts, it
+// stops once the limit is passed.
+type usage struct {
+	seen  map[any]bool
+	total int64
+	limit int64
+}
+
+func newUsage(limit int64) *usage {
+	return &usage{seen: make(map[any]bool), limit: limit}
+}
+
+func (u *usage) over() bool {
+	return u.total > u.limit
+}
+
+// visit returns true the first time it is called with p.
+func (u *usage) visit(p any) bool {
+	if u.seen[p] {
+		return false
+	}
+	u.seen[p] = true
+	return true
+}
+
+func (u *usage) add(v lua.LValue) {
+	if u.over() {
+		return
+	}
+	u.total += valueSize
+
+	switch v := v.(type) {
+	case lua.LString:
+		// the same string in many places is counted once
+		if len(v) < 64 || u.visit(unsafe.StringData(string(v))) {
+			u.total += int64(len(v))
+		}
+	case *lua.LTable:
+		if !u.visit(v) {
+			return
+		}
+		u.total += tableSize
+		v.ForEach(func(k, val lua.LValue) {
+			u.add(k)
+			u.add(val)
+		})
+		u.add(v.Metatable)
+	case *lua.LFunction:
+		if !u.visit(v) {
+			return
+		}
+		u.total += funcSize
+		for _, uv := range v.Upvalues {
+			u.add(uv.Value())
+		}
+		u.add(v.Env)
+	case *lua.LUserData:
+		if !u.visit(v) {
+			return
+		}
+		u.add(v.Metatable)
+	case *lua.LState:
+		u.addThread(v)
+	}
+}
+
+// addThread counts the functions and the locals of the stack of the
+// coroutine.
+func (u *usage) addThread(l *lua.LState) {
+	if !u.visit(l) {
+		return
+	}
+	for level := 0; !u.over(); level++ {
+		dbg, ok := l.GetStack(level)
+		if !ok {
+			return
+		}
+		if fn, err := l.GetInfo("f", dbg, lua.LNil); err == nil {
+			u.add(fn)
+		}
+		for n := 1; ; n++ {
+			name, v := l.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			u.add(v)
+		}
+	}
+}
+
+// frameStrings returns the length of the strings in the registers of
+// the function running in l, it is cheap enough to run before each
+// instruction and finds the strings that grow faster than the counts.
+func frameStrings(l *lua.LState) int64 {
+	var n int64
+	for i := l.GetTop(); i > 0; i-- {
+		if s, ok := l.Get(i).(lua.LString); ok {
+			n += int64(len(s))
+		}
+	}
+	return n
+}
+
+// memoryUsage counts the memory reachable by the scripts of the session
+// with l running, up to limit.
+func (le *LuaExtender) memoryUsage(l *lua.LState, limit int64) int64 {
+	u := newUsage(limit)
+	u.add(le.luaState.G.Global)
+	u.add(le.luaState.G.Registry)
+	u.addThread(le.luaState)
+	if l != nil {
+		u.addThread(l)
+	}
+
+	le.mutex.RLock()
+	for _, f := range le.triggerList {
+		u.add(f)
+	}
+	le.mutex.RUnlock()
+	for _, f := range le.hooks {
+		u.add(f)
+	}
+	if le.onMessageFn != nil {
+		u.add(le.onMessageFn)
+	}
+	for w := range le.waits {
+		u.addThread(w.th.l)
+	}
+	return u.total
+}
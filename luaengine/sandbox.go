@@ -0,0 +1,277 @@
+package luaengine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"crg.eti.br/go/atomic/config"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var (
+	errOutsideBBSDir    = errors.New("path outside the BBS directory")
+	errExecNotAllowed   = errors.New("command not allowed")
+	errInstructionLimit = errors.New("instruction limit exceeded")
+	errMemoryLimit      = errors.New("memory limit exceeded")
+)
+
+// maxStringLength limits the strings made by string.rep in sandbox mode.
+const maxStringLength = 16 << 20
+
+// maxCallDepth limits the nested calls of a coroutine in sandbox mode.
+const maxCallDepth = 200
+
+// budget is the context of a sandboxed state. The VM calls Done before
+// each instruction, so it counts the instructions run since the last
+// refill and checks the memory of the scripts. Once the budget runs out
+// or the memory passes the limit the scripts of the session stop.
+type budget struct {
+	context.Context
+	cancel    context.CancelCauseFunc
+	max       int64
+	left      atomic.Int64
+	maxMemory int64
+	ticks     int64
+	usage     func(l *lua.LState, limit int64) int64
+}
+
+func newBudget(max, maxMemory int) *budget {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	b := &budget{
+		Context:   ctx,
+		cancel:    cancel,
+		max:       int64(max),
+		maxMemory: int64(maxMemory),
+	}
+	b.refill()
+	return b
+}
+
+func (b *budget) Done() <-chan struct{} {
+	return b.step(nil)
+}
+
+// step counts an instruction of the coroutine l.
+func (b *budget) step(l *lua.LState) <-chan struct{} {
+	if b.max > 0 && b.left.Add(-1) < 0 {
+		b.cancel(errInstructionLimit)
+	}
+	if b.maxMemory > 0 {
+		b.ticks++
+		if l != nil && frameStrings(l) > b.maxMemory {
+			b.cancel(errMemoryLimit)
+		}
+		if b.ticks%memoryCheckInterval == 0 && b.usage(l, b.maxMemory) > b.maxMemory {
+			b.cancel(errMemoryLimit)
+		}
+	}
+	return b.Context.Done()
+}
+
+func (b *budget) Err() error {
+	return context.Cause(b.Context)
+}
+
+// refill gives the scripts a new budget, it is called when the user
+// types and when a trigger or a timer runs.
+func (b *budget) refill() {
+	b.left.Store(b.max)
+}
+
+// meter is the context of a coroutine, it counts the instructions in
+// the budget of the session with the coroutine running.
+type meter struct {
+	*budget
+	l *lua.LState
+}
+
+func (m meter) Done() <-chan struct{} {
+	return m.step(m.l)
+}
+
+// setBudget makes l count its instructions in the budget of the
+// session.
+func (le *LuaExtender) setBudget(l *lua.LState) {
+	if le.budget != nil {
+		l.SetContext(meter{budget: le.budget, l: l})
+	}
+}
+
+// newState returns the Lua state of a session, in sandbox mode the
+// stack and the calls are limited and the libraries that reach the host
+// are removed.
+func (le *LuaExtender) newState(cfg config.Config) *lua.LState {
+	if !cfg.Sandbox {
+		return lua.NewState()
+	}
+
+	// the stack has a fixed size, it grows only up to a configured size
+	// larger than the default
+	opts := lua.Options{
+		CallStackSize: maxCallDepth,
+		RegistrySize:  lua.RegistrySize,
+	}
+	switch {
+	case cfg.MaxStackSize > lua.RegistrySize:
+		opts.RegistryMaxSize = cfg.MaxStackSize
+	case cfg.MaxStackSize > 0:
+		opts.RegistrySize = cfg.MaxStackSize
+	}
+	l := lua.NewState(opts)
+
+	pkg := l.GetGlobal("package")
+	for _, name := range []string{"io", "debug", "dofile", "loadfile"} {
+		l.SetGlobal(name, lua.LNil)
+		l.SetField(l.GetField(pkg, "loaded"), name, lua.LNil)
+	}
+
+	// only the clock of the os library
+	if osLib, ok := l.GetGlobal("os").(*lua.LTable); ok {
+		keep := map[string]bool{"clock": true, "date": true, "difftime": true, "time": true}
+		var remove []lua.LValue
+		osLib.ForEach(func(k, _ lua.LValue) {
+			if !keep[lua.LVAsString(k)] {
+				remove = append(remove, k)
+			}
+		})
+		for _, k := range remove {
+			osLib.RawSet(k, lua.LNil)
+		}
+	}
+
+	l.SetField(pkg, "loadlib", lua.LNil)
+
+	str := l.GetGlobal("string")
+	rep := l.GetField(str, "rep")
+	l.SetField(str, "rep", l.NewFunction(func(l *lua.LState) int {
+		n := len(l.CheckString(1))
+		if n > 0 && l.CheckInt(2) > maxStringLength/n {
+			l.RaiseError("string.rep: string too long")
+		}
+		l.Insert(rep, 1)
+		l.Call(l.GetTop()-1, 1)
+		return 1
+	}))
+
+	if cfg.MaxInstructions > 0 || cfg.MaxMemory > 0 {
+		le.budget = newBudget(cfg.MaxInstructions, cfg.MaxMemory)
+		le.budget.usage = le.memoryUsage
+		le.setBudget(l)
+
+		// the coroutines run in their own state with the same budget,
+		// coroutine.wrap of the event loop uses coroutine.create
+		co := l.GetGlobal("coroutine")
+		create := l.GetField(co, "create")
+		l.SetField(co, "create", l.NewFunction(func(l *lua.LState) int {
+			l.Push(create)
+			l.Push(l.CheckFunction(1))
+			l.Call(1, 1)
+			if th, ok := l.Get(-1).(*lua.LState); ok {
+				le.setBudget(th)
+			}
+			return 1
+		}))
+	}
+	return l
+}
+
+// refillBudget gives the scripts a new instruction budget.
+func (le *LuaExtender) refillBudget() {
+	if le.budget != nil {
+		le.budget.refill()
+	}
+}
+
+// path returns the name of a file for the scripts, in sandbox mode the
+// file must be in the BBS directory.
+func (le *LuaExtender) path(name string) (string, error) {
+	if !le.cfg.Sandbox {
+		return name, nil
+	}
+
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(le.baseDir, p)
+	}
+	p = filepath.Clean(p)
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+
+	rel, err := filepath.Rel(le.baseDir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideBBSDir
+	}
+	return p, nil
+}
+
+// readBBSFile reads a file for the scripts, see path.
+func (le *LuaExtender) readBBSFile(name string) ([]byte, error) {
+	p, err := le.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// allowExec returns an error if the scripts can not run the command, in
+// sandbox mode only the commands in the allowlist can run.
+func (le *LuaExtender) allowExec(name string) error {
+	if !le.cfg.Sandbox || le.execAllow[name] {
+		return nil
+	}
+	return errExecNotAllowed
+}
+
+// loadModule is the package loader of the Lua files in sandbox mode,
+// the modules are searched in the BBS directory only.
+func (le *LuaExtender) loadModule(l *lua.LState) int {
+	name := l.CheckString(1)
+	var msg strings.Builder
+	for _, file := range moduleFiles(name) {
+		p, err := le.path(filepath.FromSlash(file))
+		if err != nil {
+			msg.WriteString("\n\t" + err.Error())
+			continue
+		}
+		if !fileExists(p) {
+			msg.WriteString("\n\tno file '" + p + "'")
+			continue
+		}
+
+		fn, err := l.LoadFile(p)
+		if err != nil {
+			l.RaiseError(err.Error())
+		}
+		l.Push(fn)
+		return 1
+	}
+	l.Push(lua.LString(msg.String()))
+	return 1
+}
+
+// parseAllowlist returns the commands of a comma separated list.
+func parseAllowlist(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			m[c] = true
+		}
+	}
+	return m
+}
+
+// baseDir returns the BBS directory with the links resolved.
+func baseDir(dir string) string {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		return real
+	}
+	return dir
+}
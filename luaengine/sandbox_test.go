@@ -0,0 +1,174 @@
+package luaengine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/config"
+)
+
+func newSandbox(t *testing.T, cfg config.Config) (*LuaExtender, string) {
+	dir := t.TempDir()
+	cfg.Sandbox = true
+	cfg.BaseBBSDir = dir
+	le := &LuaExtender{
+		cfg:       cfg,
+		baseDir:   baseDir(dir),
+		execAllow: parseAllowlist(cfg.ExecAllowlist),
+	}
+	le.luaState = le.newState(cfg)
+	le.installLoader()
+	le.initLoop()
+	t.Cleanup(le.luaState.Close)
+	return le, dir
+}
+
+func TestSandbox_Libraries(t *testing.T) {
+	le, dir := newSandbox(t, config.Config{})
+	os.WriteFile(filepath.Join(dir, "mod.lua"), []byte("return 42"), 0o644)
+	os.Mkdir(filepath.Join(dir, "lib"), 0o755)
+	os.WriteFile(filepath.Join(dir, "lib", "shared.lua"), []byte("return 7"), 0o644)
+
+	for _, code := range []string{
+		`assert(io == nil and debug == nil and dofile == nil and loadfile == nil)`,
+		`assert(os.execute == nil and os.exit == nil and os.remove == nil and os.getenv == nil)`,
+		`assert(type(os.time()) == "number")`,
+		`assert(require("mod") == 42)`,
+		`assert(require("shared") == 7)`,
+		`assert(not pcall(require, "..etc.passwd"))`,
+		`assert(not pcall(string.rep, "x", 1e9))`,
+		`assert(string.rep("ab", 2) == "abab")`,
+	} {
+		if err := le.luaState.DoString(code); err != nil {
+			t.Fatalf("%s: %v", code, err)
+		}
+	}
+}
+
+func TestSandbox_Path(t *testing.T) {
+	le, dir := newSandbox(t, config.Config{ExecAllowlist: "ls, iptclient"})
+
+	if p, err := le.path("fixtures/a.ans"); err != nil || p != filepath.Join(le.baseDir, "fixtures/a.ans") {
+		t.Fatalf("Unexpected path %q %v", p, err)
+	}
+	for _, name := range []string{"../x", "/etc/passwd", "a/../../x"} {
+		if _, err := le.path(name); err != errOutsideBBSDir {
+			t.Fatalf("Expected %q outside, got %v", name, err)
+		}
+	}
+
+	// a link to outside the directory
+	os.Symlink("/etc", filepath.Join(dir, "etc"))
+	if _, err := le.path("etc/passwd"); err != errOutsideBBSDir {
+		t.Fatalf("Expected the link outside, got %v", err)
+	}
+
+	if le.allowExec("ls") != nil || le.allowExec("sh") != errExecNotAllowed {
+		t.Fatal("Unexpected allowlist")
+	}
+}
+
+func TestSandbox_Instructions(t *testing.T) {
+	le, _ := newSandbox(t, config.Config{MaxInstructions: 10000})
+
+	if err := le.luaState.DoString(`for i = 1, 100 do end`); err != nil {
+		t.Fatal(err)
+	}
+
+	le.refillBudget()
+	err := le.luaState.DoString(`local co = coroutine.wrap(function() while true do end end) co()`)
+	if err == nil || !strings.Contains(err.Error(), errInstructionLimit.Error()) {
+		t.Fatalf("Expected the instruction limit, got %v", err)
+	}
+}
+
+func TestSandbox_Stack(t *testing.T) {
+	le, _ := newSandbox(t, config.Config{MaxStackSize: 5120})
+
+	opts := le.luaState.Options
+	if opts.RegistrySize != 5120 || opts.RegistryMaxSize != 0 || opts.CallStackSize != maxCallDepth {
+		t.Fatalf("Expected a fixed stack, got %+v", opts)
+	}
+
+	err := le.luaState.DoString(`local function f(n) return 1 + f(n + 1) end
+		local ok, err = pcall(f, 1)
+		assert(not ok and err:find("stack overflow"), err)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSandbox_Yield(t *testing.T) {
+	le, _ := newSandbox(t, config.Config{MaxInstructions: 10000})
+	le.done = make(chan struct{})
+	go le.loop()
+	defer le.Disconnected()
+
+	// the coroutine resumed after yielding keeps the budget it had
+	fn, err := le.luaState.LoadString(`while true do coroutine.yield() end`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	le.post(func() {
+		le.start(fn, func(err error) { done <- err })
+	})
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), errInstructionLimit.Error()) {
+			t.Fatalf("Expected the instruction limit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the coroutine stopped")
+	}
+}
+
+func TestSandbox_Memory(t *testing.T) {
+	le, _ := newSandbox(t, config.Config{MaxMemory: 1 << 20})
+
+	if err := le.luaState.DoString(`local t = {} for i = 1, 1000 do t[i] = "x" .. i end`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []string{
+		`local s = "x" while true do s = s .. s end`,
+		`local t = {} for i = 1, 1e7 do t[i] = i end`,
+		`big = {} local co = coroutine.wrap(function() for i = 1, 1e7 do big[i] = {} end end) co()`,
+	} {
+		le, _ := newSandbox(t, config.Config{MaxMemory: 1 << 20})
+		err := le.luaState.DoString(code)
+		if err == nil || !strings.Contains(err.Error(), errMemoryLimit.Error()) {
+			t.Fatalf("%s: expected the memory limit, got %v", code, err)
+		}
+	}
+}
+
+func TestSandbox_MemorySession(t *testing.T) {
+	le, dir := newSandbox(t, config.Config{MaxMemory: 1 << 20})
+	le.done = make(chan struct{})
+
+	// the script catches the error, the session ends anyway
+	writeScript(t, dir, "init.lua", `local s = "x"
+		pcall(function() while true do s = s .. s end end)
+		while true do end`, time.Now())
+	proto, err := Compile(filepath.Join(dir, "init.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.Proto = proto
+
+	done := make(chan error, 1)
+	go func() { done <- le.InitState() }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), errMemoryLimit.Error()) {
+			t.Fatalf("Expected the memory limit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the session ended")
+	}
+}
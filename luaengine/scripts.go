@@ -0,0 +1,353 @@
+package luaengine
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Compile reads a Lua file and compiles it.
+func Compile(filePath string) (*lua.FunctionProto, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(bufio.NewReader(file), filePath)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, filePath)
+}
+
+// ModulePath is where require searches the modules in the BBS
+// directory, the modules shared by the scripts go in lib.
+var ModulePath = []string{"lib/?.lua", "?.lua"}
+
+// Scripts keeps the compiled Lua files of the BBS directory for the new
+// sessions. The files that change together are compiled again and
+// swapped all at once, only when every one of them compiles. A file that
+// does not compile keeps its last good version and holds back only the
+// files changed with it.
+type Scripts struct {
+	dir         string
+	reloadMutex sync.Mutex // one reload at a time
+	mutex       sync.RWMutex
+	protos      map[string]*lua.FunctionProto // by the name relative to dir
+	mtimes      map[string]time.Time          // of the files seen by Reload
+	pending     map[string]*lua.FunctionProto // held by failed, nil for removed files
+	failed      map[string]error
+	loaded      bool // the first reload is done
+}
+
+// NewScripts returns the scripts of dir, call Reload to compile them.
+func NewScripts(dir string) *Scripts {
+	return &Scripts{
+		dir:     dir,
+		protos:  make(map[string]*lua.FunctionProto),
+		mtimes:  make(map[string]time.Time),
+		pending: make(map[string]*lua.FunctionProto),
+		failed:  make(map[string]error),
+	}
+}
+
+// Get returns the compiled script, name is relative to the BBS
+// directory as in "init.lua". The file is compiled again first when its
+// modification time is not the one seen by the last reload.
+func (s *Scripts) Get(name string) (*lua.FunctionProto, bool) {
+	name, ok := scriptName(name)
+	if !ok {
+		return nil, false
+	}
+
+	mtime, found := s.stat(name)
+	s.mutex.RLock()
+	seen, ok := s.mtimes[name]
+	s.mutex.RUnlock()
+	if ok != found || !seen.Equal(mtime) {
+		s.reloadFile(name)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	p, ok := s.protos[name]
+	return p, ok
+}
+
+// stat returns the modification time of a Lua file, found is false when
+// it is not a regular file.
+func (s *Scripts) stat(name string) (mtime time.Time, found bool) {
+	info, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if err != nil || !info.Mode().IsRegular() {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// scriptName returns the name of a file relative to the BBS directory
+// with slashes, ok is false for the files Reload does not load.
+func scriptName(name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		return "", false
+	}
+	name = filepath.ToSlash(filepath.Clean(name))
+	dirs := strings.Split(name, "/")
+	for _, d := range dirs[:len(dirs)-1] {
+		if strings.HasPrefix(d, ".") {
+			return "", false
+		}
+	}
+	return name, filepath.Ext(name) == ".lua"
+}
+
+// Module returns the compiled module, name is a module name as in
+// "util.strings" searched in ModulePath.
+func (s *Scripts) Module(name string) (*lua.FunctionProto, bool) {
+	for _, file := range moduleFiles(name) {
+		if p, ok := s.Get(file); ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// files returns the modification time of the Lua files in the top of
+// the BBS directory, in the directories of ModulePath and of the files
+// already loaded. The BBS directory can hold much more than the scripts,
+// the files in other directories are loaded by Get.
+func (s *Scripts) files() map[string]time.Time {
+	files := make(map[string]time.Time)
+	add := func(name string) {
+		if mtime, ok := s.stat(name); ok {
+			files[name] = mtime
+		}
+	}
+
+	entries, _ := os.ReadDir(s.dir)
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".lua" {
+			add(e.Name())
+		}
+	}
+
+	for _, dir := range moduleDirs() {
+		root := filepath.Join(s.dir, filepath.FromSlash(dir))
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if p != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(p) != ".lua" {
+				return nil
+			}
+			rel, err := filepath.Rel(s.dir, p)
+			if err == nil {
+				add(filepath.ToSlash(rel))
+			}
+			return nil
+		})
+	}
+
+	// mtimes changes with reloadMutex held, as by the callers
+	for name := range s.mtimes {
+		if _, ok := files[name]; !ok {
+			add(name)
+		}
+	}
+	return files
+}
+
+// Reload compiles the files changed since the last call. The errors are
+// logged once per change, the files changed with a file that does not
+// compile are held until it is fixed, the other files are swapped. The
+// first reload loads every file that compiles. It returns true when new
+// scripts were swapped in.
+func (s *Scripts) Reload() bool {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	return s.reload(s.files(), func(string) bool { return true })
+}
+
+// reloadFile compiles a file changed since the last reload as a batch of
+// its own, the other files wait for the next Reload.
+func (s *Scripts) reloadFile(name string) bool {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	if !s.loaded {
+		return s.reload(s.files(), func(string) bool { return true })
+	}
+	files := make(map[string]time.Time)
+	if mtime, ok := s.stat(name); ok {
+		files[name] = mtime
+	}
+	return s.reload(files, func(n string) bool { return n == name })
+}
+
+// reload compiles the files changed in files, the files of mtimes
+// missing from it are removed when scope returns true for them.
+func (s *Scripts) reload(files map[string]time.Time, scope func(string) bool) bool {
+	batch := make(map[string]*lua.FunctionProto)
+	failed := false
+
+	for name, mtime := range files {
+		if t, ok := s.mtimes[name]; ok && t.Equal(mtime) {
+			continue
+		}
+		s.mutex.Lock()
+		s.mtimes[name] = mtime
+		s.mutex.Unlock()
+
+		// a new version replaces the one held
+		delete(s.pending, name)
+		proto, err := Compile(filepath.Join(s.dir, filepath.FromSlash(name)))
+		if err != nil {
+			log.Printf("script %v not loaded: %v", name, err)
+			s.failed[name] = err
+			failed = true
+			continue
+		}
+		delete(s.failed, name)
+		batch[name] = proto
+	}
+
+	for name := range s.mtimes {
+		if _, ok := files[name]; !ok && scope(name) {
+			s.mutex.Lock()
+			delete(s.mtimes, name)
+			s.mutex.Unlock()
+			delete(s.failed, name)
+			delete(s.pending, name)
+			batch[name] = nil
+		}
+	}
+
+	switch {
+	case failed && s.loaded:
+		// the batch waits for the files that failed
+		for name, proto := range batch {
+			s.pending[name] = proto
+		}
+		batch = nil
+	case len(s.failed) == 0:
+		// the held files go with the batch that fixed them
+		for name, proto := range s.pending {
+			batch[name] = proto
+		}
+		s.pending = make(map[string]*lua.FunctionProto)
+	}
+	s.loaded = true
+
+	if len(batch) == 0 {
+		return false
+	}
+
+	s.mutex.Lock()
+	names := make([]string, 0, len(batch))
+	for name, proto := range batch {
+		if proto == nil {
+			delete(s.protos, name)
+		} else {
+			s.protos[name] = proto
+		}
+		names = append(names, name)
+	}
+	s.mutex.Unlock()
+
+	sort.Strings(names)
+	log.Printf("scripts loaded: %v", strings.Join(names, ", "))
+	return true
+}
+
+// Watch reloads the scripts every interval until ctx is done.
+func (s *Scripts) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.Reload()
+		}
+	}
+}
+
+// moduleDirs returns the directories of ModulePath, relative to the BBS
+// directory.
+func moduleDirs() []string {
+	var dirs []string
+	for _, p := range ModulePath {
+		dir := path.Dir(p)
+		if dir != "." && !strings.Contains(dir, "?") {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// moduleFiles returns the files of a module name in ModulePath.
+func moduleFiles(name string) []string {
+	name = strings.ReplaceAll(name, ".", "/")
+	files := make([]string, len(ModulePath))
+	for i, p := range ModulePath {
+		files[i] = strings.ReplaceAll(p, "?", name)
+	}
+	return files
+}
+
+// installLoader replaces the loader of the Lua files, the modules come
+// from the compiled scripts and then from the disk. The BBS directory
+// goes first in package.path.
+func (le *LuaExtender) installLoader() {
+	l := le.luaState
+	pkg := l.GetGlobal("package")
+	loaders, ok := l.GetField(pkg, "loaders").(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	path := make([]string, len(ModulePath))
+	for i, p := range ModulePath {
+		path[i] = filepath.Join(le.baseDir, filepath.FromSlash(p))
+	}
+	disk := loaders.RawGetInt(2)
+	if le.cfg.Sandbox {
+		disk = l.NewFunction(le.loadModule)
+	} else {
+		path = append(path, lua.LVAsString(l.GetField(pkg, "path")))
+	}
+	l.SetField(pkg, "path", lua.LString(strings.Join(path, ";")))
+
+	loaders.RawSetInt(2, l.NewFunction(func(l *lua.LState) int {
+		name := l.CheckString(1)
+		if le.Scripts != nil {
+			if proto, ok := le.Scripts.Module(name); ok {
+				l.Push(l.NewFunctionFromProto(proto))
+				return 1
+			}
+		}
+		l.Push(disk)
+		l.Push(lua.LString(name))
+		l.Call(1, 1)
+		return 1
+	}))
+}
@@ -0,0 +1,242 @@
+package luaengine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, dir, name, code string, mtime time.Time) {
+	p := filepath.Join(dir, name)
+	os.MkdirAll(filepath.Dir(p), 0o755)
+	if err := os.WriteFile(p, []byte(code), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(p, mtime, mtime)
+}
+
+func TestScripts_Reload(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, dir, "init.lua", "x = 1", start)
+	writeScript(t, dir, "lib/util.lua", "return {}", start)
+
+	s := NewScripts(dir)
+	if !s.Reload() {
+		t.Fatal("Expected the scripts loaded")
+	}
+	first, ok := s.Get("init.lua")
+	if !ok {
+		t.Fatal("Expected init.lua")
+	}
+	if _, ok := s.Get("lib/util.lua"); !ok {
+		t.Fatal("Expected lib/util.lua")
+	}
+	if s.Reload() {
+		t.Fatal("Expected nothing changed")
+	}
+
+	// a change with an error keeps the previous scripts, even the ones
+	// that compile
+	writeScript(t, dir, "init.lua", "x = 2", start.Add(time.Minute))
+	writeScript(t, dir, "lib/util.lua", "return {", start.Add(time.Minute))
+	if s.Reload() {
+		t.Fatal("Expected the scripts kept")
+	}
+	if p, _ := s.Get("init.lua"); p != first {
+		t.Fatal("Expected the previous init.lua")
+	}
+
+	writeScript(t, dir, "lib/util.lua", "return {}", start.Add(2*time.Minute))
+	if !s.Reload() {
+		t.Fatal("Expected the fixed scripts loaded")
+	}
+	if p, _ := s.Get("init.lua"); p == first {
+		t.Fatal("Expected the new init.lua")
+	}
+
+	os.Remove(filepath.Join(dir, "lib/util.lua"))
+	if !s.Reload() {
+		t.Fatal("Expected the removal loaded")
+	}
+	if _, ok := s.Get("lib/util.lua"); ok {
+		t.Fatal("Expected lib/util.lua removed")
+	}
+}
+
+func TestScripts_ReloadFailed(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, dir, "init.lua", "x = 1", start)
+	writeScript(t, dir, "broken.lua", "x = ", start)
+
+	// the first reload loads what compiles
+	s := NewScripts(dir)
+	if !s.Reload() {
+		t.Fatal("Expected the scripts loaded")
+	}
+	first, ok := s.Get("init.lua")
+	if !ok {
+		t.Fatal("Expected init.lua")
+	}
+	if _, ok := s.Get("broken.lua"); ok {
+		t.Fatal("Expected broken.lua not loaded")
+	}
+
+	// a broken file does not hold the changes of the others
+	writeScript(t, dir, "init.lua", "x = 2", start.Add(time.Minute))
+	if !s.Reload() {
+		t.Fatal("Expected init.lua loaded")
+	}
+	second, _ := s.Get("init.lua")
+	if second == first {
+		t.Fatal("Expected the new init.lua")
+	}
+
+	// a file that breaks keeps its last good version
+	writeScript(t, dir, "broken.lua", "x = 1", start.Add(2*time.Minute))
+	s.Reload()
+	good, ok := s.Get("broken.lua")
+	if !ok {
+		t.Fatal("Expected broken.lua fixed")
+	}
+	writeScript(t, dir, "broken.lua", "x = ", start.Add(3*time.Minute))
+	if s.Reload() {
+		t.Fatal("Expected nothing swapped")
+	}
+	if p, _ := s.Get("broken.lua"); p != good {
+		t.Fatal("Expected the last good broken.lua")
+	}
+	if p, _ := s.Get("init.lua"); p != second {
+		t.Fatal("Expected init.lua kept")
+	}
+}
+
+func TestScripts_Module(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, dir, "lib/util.lua", "return 1", start)
+	writeScript(t, dir, "util.lua", "return 2", start)
+	writeScript(t, dir, "menu.lua", "return 3", start)
+
+	s := NewScripts(dir)
+	s.Reload()
+	lib, ok := s.Module("util")
+	if !ok {
+		t.Fatal("Expected util")
+	}
+	if p, _ := s.Get("lib/util.lua"); p != lib {
+		t.Fatal("Expected util from lib")
+	}
+	if _, ok := s.Module("menu"); !ok {
+		t.Fatal("Expected menu")
+	}
+	if _, ok := s.Module("..etc.passwd"); ok {
+		t.Fatal("Expected no module")
+	}
+
+	// without a reload the changes are seen by the modification time
+	if p, _ := s.Module("util"); p != lib {
+		t.Fatal("Expected the cached util")
+	}
+	writeScript(t, dir, "lib/util.lua", "return 4", start.Add(time.Minute))
+	if p, _ := s.Module("util"); p == lib {
+		t.Fatal("Expected the new util")
+	}
+	writeScript(t, dir, "lib/new.lua", "return 5", start)
+	if _, ok := s.Module("new"); !ok {
+		t.Fatal("Expected the new module")
+	}
+}
+
+func TestScripts_Walk(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, dir, "init.lua", "x = 1", start)
+	writeScript(t, dir, "lib/util/strings.lua", "return {}", start)
+	writeScript(t, dir, "lib/.old/util.lua", "return {}", start)
+	writeScript(t, dir, "doors/game.lua", "return {}", start)
+
+	// the directories that are not of the modules are not walked
+	s := NewScripts(dir)
+	s.Reload()
+	s.mutex.RLock()
+	_, game := s.protos["doors/game.lua"]
+	_, strs := s.protos["lib/util/strings.lua"]
+	_, old := s.protos["lib/.old/util.lua"]
+	s.mutex.RUnlock()
+	if game || !strs || old {
+		t.Fatalf("Unexpected scripts loaded, game %v strings %v old %v", game, strs, old)
+	}
+
+	// Get loads them, then they are reloaded with the others
+	first, ok := s.Get("doors/game.lua")
+	if !ok {
+		t.Fatal("Expected doors/game.lua")
+	}
+	writeScript(t, dir, "doors/game.lua", "return 1", start.Add(time.Minute))
+	if !s.Reload() {
+		t.Fatal("Expected doors/game.lua reloaded")
+	}
+	s.mutex.RLock()
+	second := s.protos["doors/game.lua"]
+	s.mutex.RUnlock()
+	if second == first {
+		t.Fatal("Expected the new doors/game.lua")
+	}
+
+	os.Remove(filepath.Join(dir, "doors/game.lua"))
+	if !s.Reload() {
+		t.Fatal("Expected the removal loaded")
+	}
+	if _, ok := s.Get("doors/game.lua"); ok {
+		t.Fatal("Expected doors/game.lua removed")
+	}
+}
+
+func TestScripts_GetChanged(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeScript(t, dir, "init.lua", "x = 1", start)
+	writeScript(t, dir, "menu.lua", "x = 1", start)
+
+	s := NewScripts(dir)
+	s.Reload()
+	first, _ := s.Get("init.lua")
+	menu, _ := s.Get("menu.lua")
+
+	// Get compiles the file changed, the others wait for Reload
+	writeScript(t, dir, "init.lua", "x = 2", start.Add(time.Minute))
+	writeScript(t, dir, "menu.lua", "x = 2", start.Add(time.Minute))
+	if p, _ := s.Get("init.lua"); p == first {
+		t.Fatal("Expected the new init.lua")
+	}
+	s.mutex.RLock()
+	p := s.protos["menu.lua"]
+	s.mutex.RUnlock()
+	if p != menu {
+		t.Fatal("Expected menu.lua not compiled by Get of init.lua")
+	}
+	if !s.Reload() {
+		t.Fatal("Expected menu.lua reloaded")
+	}
+	if p, _ := s.Get("menu.lua"); p == menu {
+		t.Fatal("Expected the new menu.lua")
+	}
+
+	// a file that does not compile keeps its last good version
+	good, _ := s.Get("init.lua")
+	writeScript(t, dir, "init.lua", "x = ", start.Add(2*time.Minute))
+	if p, ok := s.Get("init.lua"); !ok || p != good {
+		t.Fatal("Expected the last good init.lua")
+	}
+
+	os.Remove(filepath.Join(dir, "menu.lua"))
+	if _, ok := s.Get("menu.lua"); ok {
+		t.Fatal("Expected menu.lua removed")
+	}
+	if p, _ := s.Get("init.lua"); p != good {
+		t.Fatal("Expected init.lua kept")
+	}
+}
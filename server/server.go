@@ -1,39 +1,61 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
+	"crg.eti.br/go/atomic/chat"
 	"crg.eti.br/go/atomic/config"
 	"crg.eti.br/go/atomic/database"
 	"crg.eti.br/go/atomic/luaengine"
+	"crg.eti.br/go/atomic/session"
 	"crg.eti.br/go/atomic/term"
-	lua "github.com/yuin/gopher-lua"
 	"golang.org/x/crypto/ssh"
 )
 
 type SSHServer struct {
 	mux      sync.Mutex
-	proto    *lua.FunctionProto
+	scripts  *luaengine.Scripts
 	cfg      config.Config
-	Sessions map[string]*database.User
+	db       *database.Database
+	chat     *chat.Hub
+	listener net.Listener
+	closing  bool
+	conns    map[*ssh.ServerConn]struct{}
+	wg       sync.WaitGroup
+	Sessions *session.Registry
 }
 
 const (
 	MaxAuthTries = 5
 )
 
+var (
+	// ErrServerClosed is returned by Serve after a call to Shutdown or
+	// when the context passed to Serve is done.
+	ErrServerClosed = errors.New("ssh: server closed")
+
+	validNickname = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]{1,31}$`)
+)
+
 func New(cfg config.Config) *SSHServer {
 	return &SSHServer{
 		cfg:      cfg,
-		Sessions: make(map[string]*database.User),
+		scripts:  luaengine.NewScripts(cfg.BaseBBSDir),
+		conns:    make(map[*ssh.ServerConn]struct{}),
+		Sessions: session.NewRegistry(),
 	}
 }
 
@@ -42,16 +64,13 @@ func (s *SSHServer) authLogCallback(c ssh.ConnMetadata, method string, err error
 		log.Printf("failed authentication for %q from %v, method %v, error: %v", c.User(), c.RemoteAddr(), method, err)
 		return
 	}
-	sessionID := fmt.Sprintf("%x", c.SessionID())
-	log.Println("auth log callback", s.Sessions[sessionID].Nickname)
 	log.Printf("successful authentication for %q from %v, method %v", c.User(), c.RemoteAddr(), method)
 }
 
 func (s *SSHServer) passwordCallback(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 	log.Println("password callback")
-	sessionID := fmt.Sprintf("%x", c.SessionID())
 
-	return s.validateLogin(sessionID, c.User(), string(password))
+	return s.validateLogin(c, string(password))
 }
 
 func (s *SSHServer) keyboardInteractiveCallback(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
@@ -63,51 +82,111 @@ func (s *SSHServer) keyboardInteractiveCallback(c ssh.ConnMetadata, client ssh.K
 	}
 
 	password := ""
-	if len(answers) != 1 {
+	if len(answers) == 1 {
 		password = answers[0]
 	}
-	sessionID := fmt.Sprintf("%x", c.SessionID())
-	return s.validateLogin(sessionID, c.User(), password)
+	return s.validateLogin(c, password)
 }
 
-func (s *SSHServer) validateLogin(sessionID, nickname, password string) (*ssh.Permissions, error) {
+func (s *SSHServer) validateLogin(c ssh.ConnMetadata, password string) (*ssh.Permissions, error) {
+	nickname := c.User()
 
 	if s.cfg.EnableGuestAccount &&
 		nickname == "guest" &&
 		password == "guest" {
+		return &ssh.Permissions{
+			Extensions: map[string]string{
+				"guest": "true",
+			},
+		}, nil
+	}
 
-		t := time.Now().Format("2006-01-02 15:04:05")
-		user := database.User{
+	user, err := s.db.CheckAndReturnUser(nickname, password)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCredentials) &&
+			s.canRegister(nickname) {
+			return s.startRegistration(c, "")
+		}
+		return nil, err
+	}
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"user-id": strconv.Itoa(user.ID),
+		},
+	}, nil
+}
+
+// connUser returns the user authenticated on the connection. The user
+// comes from the permissions returned by the callback that accepted the
+// connection, the callbacks also run for the keys the client only
+// queries and their results are cached by user and key.
+func (s *SSHServer) connUser(sshConn *ssh.ServerConn) (*database.User, error) {
+	if sshConn.Permissions == nil {
+		return nil, errors.New("no permissions")
+	}
+	ext := sshConn.Permissions.Extensions
+	t := time.Now().Format("2006-01-02 15:04:05")
+
+	switch {
+	case ext["guest"] != "":
+		return &database.User{
 			ID:        9900,
 			Nickname:  "guest",
 			Email:     "guest@localhost",
 			Groups:    "guest",
 			CreatedAt: t,
 			UpdatedAt: t,
-		}
-
-		s.mux.Lock()
-		s.Sessions[sessionID] = &user
-		s.mux.Unlock()
-		return nil, nil
+		}, nil
+	case ext["registration"] != "":
+		return &database.User{
+			Nickname:  ext["nickname"],
+			Groups:    "registration",
+			CreatedAt: t,
+			UpdatedAt: t,
+		}, nil
 	}
 
-	db, err := database.New()
+	id, err := strconv.Atoi(ext["user-id"])
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid user id %q", ext["user-id"])
 	}
-	defer db.Close()
-
-	user, err := db.CheckAndReturnUser(nickname, password)
+	user, err := s.db.GetUserByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if user.Nickname != sshConn.User() {
+		return nil, fmt.Errorf("user %q authenticated as %q", sshConn.User(), user.Nickname)
+	}
+	return &user, nil
+}
 
-	s.mux.Lock()
-	s.Sessions[sessionID] = &user
-	s.mux.Unlock()
+// canRegister reports whether an unknown nickname can connect to create a new account.
+func (s *SSHServer) canRegister(nickname string) bool {
+	if !s.cfg.EnableRegistration ||
+		nickname == "guest" ||
+		!validNickname.MatchString(nickname) {
+		return false
+	}
+
+	_, err := s.db.GetUserByNickname(nickname)
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// startRegistration accepts the connection of an unknown nickname in
+// registration mode, the BBS runs the registration script instead of
+// the init script and the public key offered by the client, if any,
+// is used to create the account.
+func (s *SSHServer) startRegistration(c ssh.ConnMetadata, publicKey string) (*ssh.Permissions, error) {
+	log.Printf("starting registration of %q", c.User())
 
-	return nil, nil
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"registration": "true",
+			"nickname":     c.User(),
+			"pubkey":       publicKey,
+		},
+	}, nil
 }
 
 func (s *SSHServer) publicKeyCallback(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
@@ -117,27 +196,22 @@ func (s *SSHServer) publicKeyCallback(c ssh.ConnMetadata, key ssh.PublicKey) (*s
 		key.Type(),
 		ssh.FingerprintSHA256(key))
 
-	sessionID := fmt.Sprintf("%x", c.SessionID())
-
-	db, err := database.New()
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	user, err := db.GetUserByNickname(c.User())
+	user, err := s.db.GetUserByNickname(c.User())
 	if err != nil {
+		if s.canRegister(c.User()) {
+			return s.startRegistration(c, string(ssh.MarshalAuthorizedKey(key)))
+		}
 		return nil, err
 	}
 
 	log.Printf("user %q, %q\n", user.Nickname, user.Email)
 
-	if user.SSHPublicKey == "" {
-		return nil, fmt.Errorf("user %q has no public key", c.User())
+	userKey, err := s.db.GetActiveUserKey(user.ID, ssh.FingerprintSHA256(key))
+	if err != nil {
+		return nil, fmt.Errorf("error validating public key for %q, %v", c.User(), err)
 	}
 
-	// TODO: support to multiple keys
-	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(user.SSHPublicKey))
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(userKey.PublicKey))
 	if err != nil {
 		return nil, err
 	}
@@ -146,22 +220,13 @@ func (s *SSHServer) publicKeyCallback(c ssh.ConnMetadata, key ssh.PublicKey) (*s
 		return nil, fmt.Errorf("error validating public key for %q", c.User())
 	}
 
-	s.mux.Lock()
-	s.Sessions[sessionID] = &user // TODO: add last login date time
-	s.mux.Unlock()
-
-	log.Printf("stu user %q, %q\n", user.Nickname, user.Email)
-	log.Printf("map user %q, %q\n", s.Sessions[sessionID].Nickname, s.Sessions[sessionID].Email)
-
-	// list all sessions
-	for k, u := range s.Sessions {
-		log.Printf("%v, user %q, %q\n", k, u.Nickname, u.Email)
-	}
-
+	// TODO: add last login date time
 	return &ssh.Permissions{
-		// Record the public key used for authentication.
+		// Record the user and the public key used for authentication.
 		Extensions: map[string]string{
+			"user-id":   strconv.Itoa(user.ID),
 			"pubkey-fp": ssh.FingerprintSHA256(key),
+			"key-id":    strconv.Itoa(userKey.ID),
 		},
 	}, nil
 }
@@ -216,46 +281,208 @@ func (s *SSHServer) newServerConfig() (*ssh.ServerConfig, error) {
 	return scfg, nil
 }
 
-func (s *SSHServer) ListenAndServe() error {
-
+// ListenAndServe listens on the configured address and serves the BBS
+// until ctx is done or Shutdown is called.
+func (s *SSHServer) ListenAndServe(ctx context.Context) error {
 	l, err := net.Listen("tcp", s.cfg.Listen)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %v, %v\n", s.cfg.Listen, err.Error())
 	}
 
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts incoming connections on the listener l until ctx is done
+// or Shutdown is called, in both cases it returns ErrServerClosed. The
+// sessions already connected are not affected, use Shutdown to drain them.
+func (s *SSHServer) Serve(ctx context.Context, l net.Listener) error {
+	defer l.Close()
+
 	scfg, err := s.newServerConfig()
 	if err != nil {
 		return err
 	}
 
-	log.Printf("listening at %v\n", s.cfg.Listen)
+	s.mux.Lock()
+	if s.closing {
+		s.mux.Unlock()
+		return ErrServerClosed
+	}
+	if s.db == nil {
+		s.db, err = database.New()
+		if err != nil {
+			s.mux.Unlock()
+			return err
+		}
+
+		var logger chat.Logger
+		if s.cfg.ChatLog {
+			logger = s.db
+		}
+		s.chat = chat.NewHub(s.cfg.ChatScrollback, logger)
+	}
+	s.listener = l
+	s.mux.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		l.Close()
+	})
+	defer stop()
+
+	s.scripts.Reload()
+	if s.cfg.ReloadInterval > 0 {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go s.scripts.Watch(watchCtx, time.Duration(s.cfg.ReloadInterval)*time.Second)
+	}
+
+	log.Printf("listening at %v\n", l.Addr())
 
 	for {
 		conn, err := l.Accept()
 		if err != nil {
+			if ctx.Err() != nil || s.isClosing() {
+				return ErrServerClosed
+			}
 			log.Println("failed to accept incoming conn", err.Error())
 			continue
 		}
 
 		log.Println("ip:", conn.RemoteAddr())
 
-		// Before use, a handshake must be performed on the incoming net.Conn.
-		sshConn, chans, reqs, err := ssh.NewServerConn(conn, scfg)
-		if err != nil {
-			log.Printf("failed to handshake, %v", err.Error())
-			continue
+		go s.handleConn(conn, scfg)
+	}
+}
+
+// disconnectTimeout is how long Shutdown waits for the Lua sessions to
+// end after closing the connections, the onDisconnect hooks run then.
+const disconnectTimeout = 5 * time.Second
+
+// Shutdown stops accepting new connections, sends the shutdown message to
+// every connected user and waits for the Lua sessions to finish. When ctx
+// is done before that the remaining connections are closed and the
+// sessions have disconnectTimeout to end. The database is closed at the
+// end.
+func (s *SSHServer) Shutdown(ctx context.Context) error {
+	s.mux.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mux.Unlock()
+
+	s.Sessions.Broadcast("\r\n" + s.cfg.ShutdownMessage + "\r\n")
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("timeout waiting for sessions to finish")
+		err = ctx.Err()
+
+		s.mux.Lock()
+		for c := range s.conns {
+			c.Close()
 		}
+		s.mux.Unlock()
 
-		//sshConn.SessionID()
-		//sshConn.User()
+		select {
+		case <-done:
+		case <-time.After(disconnectTimeout):
+			log.Println("timeout waiting for sessions to disconnect")
+		}
+	}
 
-		log.Printf("new SSH connection from %s, %s",
-			sshConn.RemoteAddr(),
-			sshConn.ClientVersion())
-		// Discard all global out-of-band Requests
-		go ssh.DiscardRequests(reqs)
-		// Accept all channels
-		go s.handleChannels(sshConn, chans)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+	if s.db != nil {
+		dbErr := s.db.Close()
+		if err == nil {
+			err = dbErr
+		}
+		s.db = nil
+	}
+
+	return err
+}
+
+func (s *SSHServer) isClosing() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.closing
+}
+
+func (s *SSHServer) handleConn(conn net.Conn, scfg *ssh.ServerConfig) {
+	// Before use, a handshake must be performed on the incoming net.Conn.
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, scfg)
+	if err != nil {
+		log.Printf("failed to handshake, %v", err.Error())
+		return
+	}
+
+	user, err := s.connUser(sshConn)
+	if err != nil {
+		log.Printf("no user authenticated for %v, %v", sshConn.RemoteAddr(), err.Error())
+		sshConn.Close()
+		return
+	}
+
+	s.mux.Lock()
+	if s.closing {
+		s.mux.Unlock()
+		sshConn.Close()
+		return
+	}
+	s.conns[sshConn] = struct{}{}
+	s.mux.Unlock()
+
+	sessionID := fmt.Sprintf("%x", sshConn.SessionID())
+	s.Sessions.Add(session.New(sessionID, user, sshConn.RemoteAddr(), sshConn))
+
+	log.Printf("new SSH connection from %s, %s",
+		sshConn.RemoteAddr(),
+		sshConn.ClientVersion())
+
+	s.touchUserKey(sshConn)
+
+	// Discard all global out-of-band Requests
+	go ssh.DiscardRequests(reqs)
+	// Accept all channels
+	go s.handleChannels(sshConn, chans)
+
+	sshConn.Wait()
+
+	s.Sessions.Remove(sessionID)
+	s.mux.Lock()
+	delete(s.conns, sshConn)
+	s.mux.Unlock()
+}
+
+// touchUserKey records the use of the public key that authenticated the connection.
+// It is not done in the public key callback because the callback is also called
+// when the client only queries if a key would be accepted.
+func (s *SSHServer) touchUserKey(sshConn *ssh.ServerConn) {
+	if sshConn.Permissions == nil {
+		return
+	}
+
+	keyID, err := strconv.Atoi(sshConn.Permissions.Extensions["key-id"])
+	if err != nil {
+		return
+	}
+
+	err = s.db.TouchUserKey(keyID)
+	if err != nil {
+		log.Printf("failed to update last use of key %v, %v", keyID, err.Error())
 	}
 }
 
@@ -278,36 +505,60 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 
 	term := term.Term{
 		C:              conn,
-		InputTrigger:   make(chan struct{}),
 		OutputMode:     term.UTF8,
 		MaxInputLength: 80,
 	}
 
 	sessionID := fmt.Sprintf("%x", serverConn.SessionID())
+	sess, ok := s.Sessions.Get(sessionID)
+	if !ok {
+		log.Printf("session %v of user %v not found\n", sessionID, serverConn.User())
+		conn.Close()
+		return
+	}
+
 	le := luaengine.New(
 		s.cfg,
-		&s.Sessions,
-		s.Sessions[sessionID],
+		s.Sessions,
+		sess,
 		&term,
 		serverConn,
 		conn,
 	)
 
-	if s.proto == nil {
-		log.Printf("compiling init BBS code\n")
-		s.proto, err = le.Compile("init.lua")
-		if err != nil {
-			log.Println(err.Error())
-			os.Exit(1)
-		}
+	le.DB = s.db
+	le.Chat = s.chat
+	le.Scripts = s.scripts
+
+	script := "init.lua"
+	if serverConn.Permissions != nil &&
+		serverConn.Permissions.Extensions["registration"] != "" {
+		script = "register.lua"
+	}
+
+	proto, ok := s.scripts.Get(script)
+	if !ok {
+		log.Printf("script %v not loaded, closing the connection\n", script)
+		conn.Close()
+		return
 	}
-	le.Proto = s.proto
+	le.Proto = proto
 
 	go func() {
+		// the requests are handled until the channel closes, only the
+		// window-change and env requests after the session started
+		started := false
 		for req := range requests {
 			switch req.Type {
 			case "shell":
 				log.Println("shell request")
+				if started {
+					log.Println("session already started")
+					req.Reply(false, nil)
+					continue
+				}
+				started = true
+
 				// We only accept the default shell
 				// (i.e. no command in the Payload)
 				if len(req.Payload) == 0 {
@@ -318,31 +569,28 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 					}
 				}
 
-				//////////////////////////////
-
-				_, ok := s.Sessions[sessionID]
-				if !ok {
-					log.Printf("user %v not found, recreating\n", serverConn.User())
-					// TODO: user is reconnecting, but not found in the list
-					return
-				}
-
 				// list users
 				log.Println("users:")
-				for _, u := range s.Sessions {
-					log.Printf("  %v\n", u.Nickname)
+				for _, ss := range s.Sessions.List() {
+					log.Printf("  %v\n", ss.User().Nickname)
 				}
 
-				//////////////////////////////
+				s.mux.Lock()
+				if s.closing {
+					s.mux.Unlock()
+					conn.Close()
+					return
+				}
+				s.wg.Add(1)
+				s.mux.Unlock()
+
+				term.DetectColorDepth(le.Environment["COLORTERM"])
+				sess.Attach(&term, le)
 
 				go func() {
 					b := make([]byte, 1024)
 
 					for {
-						if le.ExternalExec {
-							time.Sleep(100 * time.Millisecond)
-							continue
-						}
 						n, err := conn.Read(b)
 						if err != nil {
 							if err != io.EOF {
@@ -350,37 +598,47 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 							}
 							break
 						}
-						k := string(b[:n])
-						ok, err := le.RunTrigger(k)
-						if err != nil {
-							log.Println("error RunTrigger", err.Error())
-							break
-						}
-						if !ok {
-							le.Input(k)
-						}
+						sess.Touch()
+						le.HandleInput(string(b[:n]))
 					}
 					le.ClearTriggers(nil)
-					le.IsConnected = false
+					le.Disconnected()
 					le.Conn.Close()
 					serverConn.Conn.Close() // TODO: detect multiple connections
-					delete(s.Sessions, sessionID)
 				}()
 
-				err = le.InitState()
-				if err != nil {
-					log.Printf("error %v\n", err.Error())
-					os.Exit(1)
-				}
-
-				return
+				// keep reading the requests, the window-change
+				// requests arrive while the script is running
+				go func() {
+					defer s.wg.Done()
+					err := le.InitState()
+					if err != nil {
+						log.Printf("error %v\n", err.Error())
+						conn.Close()
+					}
+					le.Close()
+				}()
 
 			case "pty-req":
 				log.Println("pty-req request")
-				termLen := req.Payload[3]
-				s.mux.Lock()
-				term.Width, term.Height = parseDims(req.Payload[termLen+4:])
-				s.mux.Unlock()
+				if started {
+					req.Reply(false, nil)
+					continue
+				}
+				termType, dims, ok := parsePtyReq(req.Payload)
+				if !ok {
+					log.Println("invalid pty-req payload")
+					req.Reply(false, nil)
+					continue
+				}
+				w, h, ok := parseDims(dims)
+				if !ok {
+					log.Println("invalid pty-req dimensions")
+					req.Reply(false, nil)
+					continue
+				}
+				term.TermType = termType
+				term.SetSize(w, h)
 				err := req.Reply(true, nil)
 				if err != nil {
 					log.Println(err.Error())
@@ -388,24 +646,28 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 				}
 			case "window-change":
 				log.Println("window-change request")
-				s.mux.Lock()
-				term.Width, term.Height = parseDims(req.Payload)
-				s.mux.Unlock()
+				w, h, ok := parseDims(req.Payload)
+				if !ok {
+					log.Println("invalid window-change payload")
+					continue
+				}
+				term.SetSize(w, h)
+				le.Resized()
 			case "env":
-				err := req.Reply(true, nil)
-				if err != nil {
+				// the scripts read the environment while the session
+				// runs, it can not change after the session started
+				if started || len(le.Environment) > 1000 {
+					log.Println("env request refused")
 					req.Reply(false, nil)
-					log.Println(err.Error())
-					return
-				}
-
-				if len(le.Environment) > 1000 {
-					log.Println("too many env vars")
-					return
+					continue
 				}
 
 				var p luaengine.KeyValue
-				ssh.Unmarshal(req.Payload, &p)
+				err := ssh.Unmarshal(req.Payload, &p)
+				if err != nil {
+					req.Reply(false, nil)
+					continue
+				}
 				log.Printf("env: %s = %s", p.Key, p.Value)
 				le.Environment[p.Key] = p.Value
 				req.Reply(true, nil)
@@ -422,11 +684,9 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 				case "sftp":
 					log.Println("sftp request unimplemented")
 					req.Reply(false, nil)
-					return
 				default:
 					log.Printf("unknown subsystem request: %q", subsystem)
 					req.Reply(false, nil)
-					return
 				}
 			default:
 				log.Println("default request")
@@ -441,9 +701,25 @@ func (s *SSHServer) handleChannel(serverConn *ssh.ServerConn, newChannel ssh.New
 
 }
 
+// parsePtyReq extracts the terminal type and the buffer with the
+// dimensions from the payload of a pty-req request.
+func parsePtyReq(b []byte) (string, []byte, bool) {
+	if len(b) < 4 {
+		return "", nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return "", nil, false
+	}
+	return string(b[4 : 4+n]), b[4+n:], true
+}
+
 // parseDims extracts terminal dimensions (width x height) from the provided buffer.
-func parseDims(b []byte) (int, int) {
+func parseDims(b []byte) (int, int, bool) {
+	if len(b) < 8 {
+		return 0, 0, false
+	}
 	w := int(binary.BigEndian.Uint32(b))
 	h := int(binary.BigEndian.Uint32(b[4:]))
-	return w, h
+	return w, h, true
 }
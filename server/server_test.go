@@ -0,0 +1,368 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/config"
+	"crg.eti.br/go/atomic/database"
+	"golang.org/x/crypto/ssh"
+	_ "modernc.org/sqlite"
+)
+
+// fakeConn is a ssh.Conn with only the user name and address.
+type fakeConn struct {
+	ssh.Conn
+	user string
+}
+
+func (c fakeConn) User() string         { return c.user }
+func (c fakeConn) RemoteAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2200} }
+
+// newTestServer returns a server with a new database in a temporary
+// directory, the directory of the BBS.
+func newTestServer(t *testing.T, cfg config.Config) *SSHServer {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db, err := database.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = db.RunMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.BaseBBSDir = dir
+	s := New(cfg)
+	s.db = db
+	return s
+}
+
+// addUser creates a user with a new public key and returns the key.
+func addUser(t *testing.T, s *SSHServer, nickname string) ssh.PublicKey {
+	user, err := s.db.CreateUser(nickname, nickname+"@localhost", "password123", "", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.AddUserKey(user.ID, "test", string(ssh.MarshalAuthorizedKey(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSSHServer_connUser(t *testing.T) {
+	s := newTestServer(t, config.Config{})
+	aliceKey := addUser(t, s, "alice")
+	bobKey := addUser(t, s, "bob")
+
+	// the client queries its key and then the key of another user on the
+	// same connection, the signed request with its own key gets the
+	// cached permissions of the first query
+	alice, err := s.publicKeyCallback(fakeConn{user: "alice"}, aliceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.publicKeyCallback(fakeConn{user: "bob"}, bobKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.connUser(&ssh.ServerConn{Conn: fakeConn{user: "alice"}, Permissions: alice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Nickname != "alice" {
+		t.Fatalf("Expected alice, got %q", user.Nickname)
+	}
+
+	_, err = s.connUser(&ssh.ServerConn{Conn: fakeConn{user: "bob"}, Permissions: alice})
+	if err == nil {
+		t.Fatal("Expected an error for permissions of another user")
+	}
+	_, err = s.connUser(&ssh.ServerConn{Conn: fakeConn{user: "alice"}})
+	if err == nil {
+		t.Fatal("Expected an error without permissions")
+	}
+}
+
+func TestSSHServer_canRegister(t *testing.T) {
+	s := newTestServer(t, config.Config{EnableRegistration: true})
+	addUser(t, s, "alice")
+
+	tests := []struct {
+		nickname string
+		want     bool
+	}{
+		{"bob", true},
+		{"bob_2.x-y", true},
+		{"alice", false},
+		{"guest", false},
+		{"b", false},
+		{"2bob", false},
+		{"bob smith", false},
+		{"bob\x1b[2J", false},
+	}
+	for _, tt := range tests {
+		if got := s.canRegister(tt.nickname); got != tt.want {
+			t.Fatalf("canRegister(%q) = %v, expected %v", tt.nickname, got, tt.want)
+		}
+	}
+
+	s.cfg.EnableRegistration = false
+	if s.canRegister("bob") {
+		t.Fatal("Expected no registration when it is disabled")
+	}
+}
+
+func TestSSHServer_startRegistration(t *testing.T) {
+	s := newTestServer(t, config.Config{EnableRegistration: true})
+	aliceKey := addUser(t, s, "alice")
+	bobKey := addUser(t, s, "bob_key")
+
+	// an unknown nickname with a key registers with the key
+	perms, err := s.publicKeyCallback(fakeConn{user: "bob"}, bobKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := perms.Extensions
+	if ext["registration"] == "" || ext["nickname"] != "bob" ||
+		ext["pubkey"] != string(ssh.MarshalAuthorizedKey(bobKey)) {
+		t.Fatalf("Expected the registration with the key, got %v", ext)
+	}
+	user, err := s.connUser(&ssh.ServerConn{Conn: fakeConn{user: "bob"}, Permissions: perms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 0 || user.Nickname != "bob" || user.Groups != "registration" {
+		t.Fatalf("Expected a user in registration, got %+v", user)
+	}
+
+	// with a password the account is created without a key
+	perms, err = s.passwordCallback(fakeConn{user: "carol"}, []byte("anything"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perms.Extensions["registration"] == "" || perms.Extensions["pubkey"] != "" {
+		t.Fatalf("Expected the registration without a key, got %v", perms.Extensions)
+	}
+
+	// a known nickname does not register
+	_, err = s.passwordCallback(fakeConn{user: "alice"}, []byte("wrong password"))
+	if err == nil {
+		t.Fatal("Expected an error for a wrong password")
+	}
+	_, err = s.publicKeyCallback(fakeConn{user: "alice"}, bobKey)
+	if err == nil {
+		t.Fatal("Expected an error for the key of another user")
+	}
+	perms, err = s.publicKeyCallback(fakeConn{user: "alice"}, aliceKey)
+	if err != nil || perms.Extensions["registration"] != "" {
+		t.Fatalf("Expected alice logged in, got %v %v", perms, err)
+	}
+
+	s.cfg.EnableRegistration = false
+	_, err = s.publicKeyCallback(fakeConn{user: "bob"}, bobKey)
+	if err == nil {
+		t.Fatal("Expected an error when the registration is disabled")
+	}
+}
+
+func TestParsePtyReq(t *testing.T) {
+	payload := ssh.Marshal(struct {
+		Term          string
+		Width, Height uint32
+		PixelWidth    uint32
+		PixelHeight   uint32
+		Modes         string
+	}{"xterm", 100, 40, 0, 0, ""})
+
+	termType, dims, ok := parsePtyReq(payload)
+	if !ok || termType != "xterm" {
+		t.Fatalf("Expected xterm, got %q %v", termType, ok)
+	}
+	w, h, ok := parseDims(dims)
+	if !ok || w != 100 || h != 40 {
+		t.Fatalf("Expected 100x40, got %vx%v %v", w, h, ok)
+	}
+
+	for _, b := range [][]byte{nil, {0, 0}, {0, 0, 0, 200, 'x'}, {255, 255, 255, 255}} {
+		if _, _, ok := parsePtyReq(b); ok {
+			t.Fatalf("Expected %v rejected", b)
+		}
+	}
+	if _, _, ok := parseDims([]byte{0, 0, 0, 80}); ok {
+		t.Fatal("Expected short dimensions rejected")
+	}
+}
+
+// serveTest runs a server with guest access and the init.lua script, it
+// returns the address it listens on and the result of Serve.
+func serveTest(t *testing.T, s *SSHServer, script string) (string, chan error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile("host_key", pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile("init.lua", []byte(script), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(context.Background(), l) }()
+	return l.Addr().String(), served
+}
+
+// startShell connects as guest and starts the shell, then waits for the
+// script to create the started file.
+func startShell(t *testing.T, addr string) *ssh.Session {
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "guest",
+		Auth:            []ssh.AuthMethod{ssh.Password("guest")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the input stays open, without it the client sends EOF
+	stdin, _ := io.Pipe()
+	sess.Stdin = stdin
+	err = sess.RequestPty("xterm", 24, 80, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sess.Shell()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat("started"); err == nil {
+			return sess
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the script started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testConfig() config.Config {
+	return config.Config{
+		PrivateKey:         "host_key",
+		EnableGuestAccount: true,
+		ShutdownMessage:    "bye",
+	}
+}
+
+func TestSSHServer_Shutdown(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	addr, served := serveTest(t, s, `onDisconnect(function()
+			local f = io.open("disconnected", "w")
+			f:write("ok")
+			f:close()
+		end)
+		io.open("started", "w"):close()`)
+	startShell(t, addr)
+
+	// the user does not leave, the connection is closed at the timeout
+	// and the hook runs before the database is closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the timeout, got %v", err)
+	}
+	if b, _ := os.ReadFile("disconnected"); string(b) != "ok" {
+		t.Fatal("Expected the onDisconnect hook run before Shutdown returned")
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestSSHServer_SecondShell(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	addr, _ := serveTest(t, s, `io.open("started", "w"):close()
+		onResize(function(w, h)
+			local f = io.open("resized", "w")
+			f:write(w .. "x" .. h)
+			f:close()
+		end)`)
+	sess := startShell(t, addr)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	for _, req := range []string{"shell", "pty-req", "env", "exec"} {
+		ok, err := sess.SendRequest(req, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatalf("Expected the %v request refused", req)
+		}
+	}
+
+	// the window changes are still handled
+	err := sess.WindowChange(30, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if b, _ := os.ReadFile("resized"); string(b) == "100x30" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the window change handled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,128 @@
+package session
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Registry holds the sessions connected to the BBS, it is safe for concurrent use.
+type Registry struct {
+	mutex    sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Add adds a session to the registry and assigns it the lowest free node number.
+func (r *Registry) Add(s *Session) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	used := make(map[int]bool, len(r.sessions))
+	for _, ss := range r.sessions {
+		used[ss.Node] = true
+	}
+
+	s.Node = 1
+	for used[s.Node] {
+		s.Node++
+	}
+
+	r.sessions[s.ID] = s
+}
+
+// Remove removes the session with the given id from the registry.
+func (r *Registry) Remove(id string) {
+	r.mutex.Lock()
+	delete(r.sessions, id)
+	r.mutex.Unlock()
+}
+
+// Get returns the session with the given id.
+func (r *Registry) Get(id string) (*Session, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// Len returns the number of sessions.
+func (r *Registry) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.sessions)
+}
+
+// List returns the sessions ordered by node number.
+func (r *Registry) List() []*Session {
+	r.mutex.RLock()
+	list := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		list = append(list, s)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Node < list[j].Node
+	})
+
+	return list
+}
+
+// Kick closes the connection of the session with the given id.
+func (r *Registry) Kick(id string) error {
+	s, ok := r.Get(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return s.Kick()
+}
+
+// Broadcast writes the message to the terminal of every session.
+func (r *Registry) Broadcast(msg string) {
+	for _, s := range r.List() {
+		t := s.Term()
+		if t == nil {
+			continue
+		}
+		t.WriteString(msg)
+	}
+}
+
+// Send delivers the message to every session of the user with the
+// given nickname and returns the number of sessions reached.
+func (r *Registry) Send(nickname, from, text string) int {
+	n := 0
+	for _, s := range r.List() {
+		e := s.Engine()
+		if e == nil || s.User().Nickname != nickname {
+			continue
+		}
+		e.Message(from, text)
+		n++
+	}
+	return n
+}
+
+// SendAll delivers the message to every session and returns the
+// number of sessions reached.
+func (r *Registry) SendAll(from, text string) int {
+	n := 0
+	for _, s := range r.List() {
+		e := s.Engine()
+		if e == nil {
+			continue
+		}
+		e.Message(from, text)
+		n++
+	}
+	return n
+}
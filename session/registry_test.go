@@ -0,0 +1,114 @@
+package session
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/term"
+)
+
+type fakeConn struct {
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakeEngine struct {
+	messages []string
+}
+
+func (e *fakeEngine) Close() error {
+	return nil
+}
+
+func (e *fakeEngine) Message(from, text string) {
+	e.messages = append(e.messages, from+": "+text)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2200}
+
+	c1 := &fakeConn{}
+	s1 := New("s1", &database.User{Nickname: "user1"}, addr, c1)
+	r.Add(s1)
+
+	c2 := &fakeConn{}
+	s2 := New("s2", &database.User{Nickname: "user2"}, addr, c2)
+	r.Add(s2)
+
+	if r.Len() != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", r.Len())
+	}
+
+	list := r.List()
+	if list[0].Node != 1 || list[1].Node != 2 {
+		t.Fatal("Expected sessions ordered by node")
+	}
+
+	s, ok := r.Get("s2")
+	if !ok || s.User().Nickname != "user2" {
+		t.Fatal("Expected session s2")
+	}
+
+	s.SetActivity("reading mail")
+	if s.Activity() != "reading mail" {
+		t.Fatal("Activity not equal")
+	}
+
+	var out bytes.Buffer
+	s1.Attach(&term.Term{C: &out}, nil)
+	r.Broadcast("hello")
+	if out.String() != "hello" {
+		t.Fatalf("Expected broadcast message, got %q", out.String())
+	}
+
+	e1, e2 := &fakeEngine{}, &fakeEngine{}
+	s1.Attach(&term.Term{C: &out}, e1)
+	s2.Attach(&term.Term{C: &out}, e2)
+
+	n := r.Send("user2", "user1", "hi")
+	if n != 1 || len(e2.messages) != 1 || e2.messages[0] != "user1: hi" {
+		t.Fatalf("Expected message delivered to user2, got %v", e2.messages)
+	}
+
+	n = r.SendAll("sysop", "going down")
+	if n != 2 || len(e1.messages) != 1 || len(e2.messages) != 2 {
+		t.Fatal("Expected message delivered to all sessions")
+	}
+
+	err := r.Kick("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c1.closed {
+		t.Fatal("Expected connection closed")
+	}
+
+	err = r.Kick("unknown")
+	if err != ErrSessionNotFound {
+		t.Fatal("Expected ErrSessionNotFound")
+	}
+
+	r.Remove("s1")
+	if _, ok := r.Get("s1"); ok {
+		t.Fatal("Expected session removed")
+	}
+
+	// the node of a removed session is reused
+	s3 := New("s3", &database.User{Nickname: "user3"}, addr, &fakeConn{})
+	r.Add(s3)
+	if s3.Node != 1 {
+		t.Fatalf("Expected node 1, got %d", s3.Node)
+	}
+
+	if s3.Idle() > time.Second {
+		t.Fatal("Expected new session not idle")
+	}
+}
@@ -0,0 +1,127 @@
+package session
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"crg.eti.br/go/atomic/database"
+	"crg.eti.br/go/atomic/term"
+)
+
+// Engine is the script engine running the BBS for a session,
+// usually a *luaengine.LuaExtender.
+type Engine interface {
+	Close() error
+	// Message delivers a message sent by another user.
+	Message(from, text string)
+}
+
+// Session holds the state of a connected user.
+type Session struct {
+	mutex       sync.RWMutex
+	ID          string
+	Node        int
+	RemoteAddr  net.Addr
+	ConnectedAt time.Time
+	lastInput   time.Time
+	user        *database.User
+	conn        io.Closer
+	term        *term.Term
+	engine      Engine
+	activity    string
+}
+
+// New creates a new session, conn is closed when the session is kicked.
+func New(id string, user *database.User, remoteAddr net.Addr, conn io.Closer) *Session {
+	now := time.Now()
+	return &Session{
+		ID:          id,
+		RemoteAddr:  remoteAddr,
+		ConnectedAt: now,
+		lastInput:   now,
+		user:        user,
+		conn:        conn,
+		activity:    "logging in",
+	}
+}
+
+// User returns the user logged in the session.
+func (s *Session) User() *database.User {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.user
+}
+
+// SetUser changes the user logged in the session, used when a new user registers.
+func (s *Session) SetUser(user *database.User) {
+	s.mutex.Lock()
+	s.user = user
+	s.mutex.Unlock()
+}
+
+// Attach sets the terminal and the script engine of the session,
+// they are only available after the client requests a shell.
+func (s *Session) Attach(t *term.Term, e Engine) {
+	s.mutex.Lock()
+	s.term = t
+	s.engine = e
+	s.mutex.Unlock()
+}
+
+// Term returns the terminal of the session or nil if there is no shell yet.
+func (s *Session) Term() *term.Term {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.term
+}
+
+// Engine returns the script engine of the session or nil if there is no shell yet.
+func (s *Session) Engine() Engine {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.engine
+}
+
+// Activity returns what the user is doing, e.g. "main menu".
+func (s *Session) Activity() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.activity
+}
+
+// SetActivity changes what the user is doing.
+func (s *Session) SetActivity(activity string) {
+	s.mutex.Lock()
+	s.activity = activity
+	s.mutex.Unlock()
+}
+
+// Touch records that the user sent some input.
+func (s *Session) Touch() {
+	s.mutex.Lock()
+	s.lastInput = time.Now()
+	s.mutex.Unlock()
+}
+
+// Idle returns how long the user has been without sending any input.
+func (s *Session) Idle() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return time.Since(s.lastInput)
+}
+
+// Size returns the terminal width and height of the session.
+func (s *Session) Size() (int, int) {
+	t := s.Term()
+	if t == nil {
+		return 0, 0
+	}
+	return t.GetSize()
+}
+
+// Kick closes the connection of the session.
+func (s *Session) Kick() error {
+	return s.conn.Close()
+}
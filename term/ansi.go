@@ -0,0 +1,209 @@
+package term
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	sauceLength   = 128
+	commentLength = 64
+)
+
+// maxRenderLines limits the lines of a rendered text.
+const maxRenderLines = 10000
+
+// Sauce is the metadata record at the end of ANSI art files.
+type Sauce struct {
+	Title     string
+	Author    string
+	Group     string
+	Date      string // CCYYMMDD
+	FileSize  uint32
+	DataType  byte
+	FileType  byte
+	Width     int
+	Height    int
+	ICEColors bool // blink means a bright background
+	Font      string
+	Comments  []string
+}
+
+// sauceString trims the padding of a field.
+func sauceString(b []byte) string {
+	return strings.TrimRight(DecodeCP437(bytes.TrimRight(b, "\x00")), " ")
+}
+
+// ParseSauce returns the content of the file without the SAUCE record,
+// the comments and the end of file character, and the record if there
+// is one. Without a record the content ends at the first end of file
+// character.
+func ParseSauce(b []byte) ([]byte, *Sauce) {
+	if len(b) < sauceLength || !bytes.HasPrefix(b[len(b)-sauceLength:], []byte("SAUCE00")) {
+		if i := bytes.IndexByte(b, 0x1a); i >= 0 {
+			b = b[:i]
+		}
+		return b, nil
+	}
+
+	r := b[len(b)-sauceLength:]
+	s := &Sauce{
+		Title:    sauceString(r[7:42]),
+		Author:   sauceString(r[42:62]),
+		Group:    sauceString(r[62:82]),
+		Date:     sauceString(r[82:90]),
+		FileSize: binary.LittleEndian.Uint32(r[90:94]),
+		DataType: r[94],
+		FileType: r[95],
+		Font:     sauceString(r[106:128]),
+	}
+
+	// the width and height are only defined for character files
+	if s.DataType == 1 {
+		s.Width = int(binary.LittleEndian.Uint16(r[96:98]))
+		s.Height = int(binary.LittleEndian.Uint16(r[98:100]))
+	}
+	if s.DataType == 1 || s.DataType == 5 {
+		s.ICEColors = r[105]&1 != 0
+	}
+
+	data := b[:len(b)-sauceLength]
+	if n := int(r[104]); n > 0 {
+		size := 5 + n*commentLength
+		if len(data) >= size && bytes.HasPrefix(data[len(data)-size:], []byte("COMNT")) {
+			c := data[len(data)-size+5:]
+			for i := 0; i < n; i++ {
+				s.Comments = append(s.Comments, sauceString(c[i*commentLength:(i+1)*commentLength]))
+			}
+			data = data[:len(data)-size]
+		}
+	}
+
+	if i := bytes.IndexByte(data, 0x1a); i >= 0 {
+		data = data[:i]
+	}
+	return data, s
+}
+
+// ANSIArt is a CP437 ANSI art rendered in its width.
+type ANSIArt struct {
+	Sauce *Sauce
+	Width int
+	Lines [][]Cell
+}
+
+// ParseANSI decodes and renders a CP437 ANSI art. The width declared in
+// the SAUCE record is used, 80 columns without it.
+func ParseANSI(b []byte) *ANSIArt {
+	data, sauce := ParseSauce(b)
+
+	a := &ANSIArt{
+		Sauce: sauce,
+		Width: artWidth,
+	}
+	if sauce != nil && sauce.Width > 0 {
+		a.Width = sauce.Width
+	}
+
+	a.Lines = render(DecodeCP437(data), a.Width)
+	if sauce != nil && sauce.ICEColors {
+		iceColors(a.Lines)
+	}
+	return a
+}
+
+// LoadANSI reads and renders an ANSI art file.
+func LoadANSI(name string) (*ANSIArt, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseANSI(b), nil
+}
+
+// iceColors turns the blink attribute in bright backgrounds.
+func iceColors(lines [][]Cell) {
+	for _, line := range lines {
+		for i, c := range line {
+			if c.Attr&AttrBlink == 0 {
+				continue
+			}
+			c.Attr &^= AttrBlink
+			switch {
+			case c.Bg == ColorDefault:
+				c.Bg = 8
+			case c.Bg < 8:
+				c.Bg += 8
+			}
+			line[i] = c
+		}
+	}
+}
+
+// Text returns the art as lines of text with the colors, cut at width
+// columns. Each line ends with the default colors and a line break.
+func (a *ANSIArt) Text(width int) string {
+	var b strings.Builder
+	for _, line := range a.Lines {
+		line = line[:min(len(line), width)]
+
+		// trailing blanks are not written
+		end := len(line)
+		for end > 0 && line[end-1] == defaultPen {
+			end--
+		}
+
+		pen := defaultPen
+		for _, c := range line[:end] {
+			if !sameStyle(c, pen) {
+				b.WriteString(sgrSequence(c))
+				pen = c
+			}
+			b.WriteRune(c.Rune)
+		}
+		if pen != defaultPen {
+			b.WriteString("\033[0m")
+		}
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// render interprets the text in a screen as tall as the text and keeps
+// the rows up to the last one written.
+func render(text string, width int) [][]Cell {
+	n := strings.Count(text, "\n") + utf8.RuneCountInString(text)/width + 2
+	n = min(n, maxRenderLines)
+
+	s := NewScreen(width, n)
+	s.Write(text)
+
+	last := 0
+	for r := 0; r < n; r++ {
+		for _, c := range s.cells[r*width : (r+1)*width] {
+			if c != defaultPen {
+				last = r + 1
+				break
+			}
+		}
+	}
+
+	lines := make([][]Cell, last)
+	for r := range lines {
+		lines[r] = s.cells[r*width : (r+1)*width]
+	}
+	return lines
+}
+
+// WriteANSI writes the art from the start of the line, the lines wider
+// than the terminal are cut.
+func (t *Term) WriteANSI(a *ANSIArt) {
+	w, _ := t.GetSize()
+	if w <= 0 {
+		w = artWidth
+	}
+	t.WriteString("\r" + a.Text(w))
+}
@@ -0,0 +1,124 @@
+package term
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// sauceRecord returns the end of file character, the comments and the
+// SAUCE record of a character file.
+func sauceRecord(title string, width int, flags byte, comments ...string) []byte {
+	pad := func(s string, n int) []byte {
+		return []byte(s + strings.Repeat(" ", n-len(s)))
+	}
+
+	b := []byte{0x1a}
+	if len(comments) > 0 {
+		b = append(b, "COMNT"...)
+		for _, c := range comments {
+			b = append(b, pad(c, commentLength)...)
+		}
+	}
+
+	r := make([]byte, sauceLength)
+	copy(r, "SAUCE00")
+	copy(r[7:], pad(title, 35))
+	copy(r[42:], pad("artist", 20))
+	copy(r[62:], pad("group", 20))
+	copy(r[82:], "20240101")
+	r[94] = 1 // character
+	r[95] = 1 // ANSi
+	binary.LittleEndian.PutUint16(r[96:], uint16(width))
+	binary.LittleEndian.PutUint16(r[98:], 2)
+	r[104] = byte(len(comments))
+	r[105] = flags
+	copy(r[106:], "IBM VGA")
+	return append(b, r...)
+}
+
+func TestParseSauce(t *testing.T) {
+	art := []byte("\xdb\xdb\r\n")
+	b := append(append([]byte{}, art...), sauceRecord("squiddy", 40, 1, "first", "second")...)
+
+	data, s := ParseSauce(b)
+	if !bytes.Equal(data, art) {
+		t.Fatalf("Unexpected data %q", data)
+	}
+	if s == nil {
+		t.Fatal("Expected a SAUCE record")
+	}
+	if s.Title != "squiddy" || s.Author != "artist" || s.Group != "group" || s.Date != "20240101" {
+		t.Fatalf("Unexpected record %+v", s)
+	}
+	if s.Width != 40 || s.Height != 2 || !s.ICEColors || s.Font != "IBM VGA" {
+		t.Fatalf("Unexpected record %+v", s)
+	}
+	if len(s.Comments) != 2 || s.Comments[1] != "second" {
+		t.Fatalf("Unexpected comments %q", s.Comments)
+	}
+
+	// without a record the text ends at the end of file character
+	data, s = ParseSauce([]byte("abc\x1atrailing"))
+	if s != nil || string(data) != "abc" {
+		t.Fatalf("Unexpected data %q %+v", data, s)
+	}
+}
+
+func TestParseANSI(t *testing.T) {
+	// the art wraps at the declared width
+	b := append([]byte(strings.Repeat("x", 50)), sauceRecord("wide", 40, 0)...)
+	a := ParseANSI(b)
+	if a.Width != 40 || len(a.Lines) != 2 {
+		t.Fatalf("Expected 2 lines of 40 columns, got %d of %d", len(a.Lines), a.Width)
+	}
+
+	// without a record it wraps at 80 columns
+	a = ParseANSI([]byte(strings.Repeat("x", 100)))
+	if a.Width != 80 || len(a.Lines) != 2 {
+		t.Fatalf("Expected 2 lines of 80 columns, got %d of %d", len(a.Lines), a.Width)
+	}
+
+	// with iCE colors blink is a bright background
+	b = append([]byte("\x1b[5;44mA\x1b[0;5mB\x1b[0;5;31mC"), sauceRecord("ice", 80, 1)...)
+	a = ParseANSI(b)
+	line := a.Lines[0]
+	if line[0].Bg != 12 || line[0].Attr&AttrBlink != 0 {
+		t.Fatalf("Expected a bright blue background, got %+v", line[0])
+	}
+	if line[1].Bg != 8 || line[2].Fg != 1 || line[2].Bg != 8 {
+		t.Fatalf("Unexpected cells %+v %+v", line[1], line[2])
+	}
+
+	// without it blink stays
+	b = append([]byte("\x1b[5;44mA"), sauceRecord("blink", 80, 0)...)
+	a = ParseANSI(b)
+	if a.Lines[0][0].Bg != 4 || a.Lines[0][0].Attr&AttrBlink == 0 {
+		t.Fatalf("Expected blink, got %+v", a.Lines[0][0])
+	}
+}
+
+func TestANSIArt_Text(t *testing.T) {
+	a := ParseANSI([]byte("\x1b[31mred\x1b[0m plain   \r\n\xdbx"))
+
+	s := a.Text(80)
+	want := "\x1b[0;31mred\x1b[0m plain\r\n█x\r\n"
+	if s != want {
+		t.Fatalf("Expected %q, got %q", want, s)
+	}
+
+	// lines are cut at the width
+	if s = a.Text(2); s != "\x1b[0;31mre\x1b[0m\r\n█x\r\n" {
+		t.Fatalf("Unexpected text %q", s)
+	}
+}
+
+func TestTerm_WriteFromASCII(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 40, Height: 10}
+
+	if err := term.WriteFromASCII("testdata/missing.ans"); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
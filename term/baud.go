@@ -0,0 +1,120 @@
+package term
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Baud rates accepted by SetBaudRate.
+const (
+	MinBaudRate = 300
+	MaxBaudRate = 115200
+)
+
+var ErrInvalidBaudRate = errors.New("invalid baud rate")
+
+// throttleSlice is the time of the bytes written at once, the sleeps
+// shorter than that are not precise.
+const throttleSlice = 10 * time.Millisecond
+
+// Throttle is a writer that sends the bytes at the speed of a serial
+// line, a byte takes 10 bits with the start and stop bits.
+type Throttle struct {
+	w        io.Writer
+	byteTime time.Duration
+	next     time.Time // when the line is free
+}
+
+// NewThrottle returns a writer to w at baud bits per second.
+func NewThrottle(w io.Writer, baud int) *Throttle {
+	return &Throttle{
+		w:        w,
+		byteTime: 10 * time.Second / time.Duration(baud),
+	}
+}
+
+// chunk returns the bytes written at once.
+func (t *Throttle) chunk() int {
+	return max(1, int(throttleSlice/t.byteTime))
+}
+
+// Write sends p in chunks waiting the time the line takes to send the
+// previous ones.
+func (t *Throttle) Write(p []byte) (int, error) {
+	if now := time.Now(); t.next.Before(now) {
+		t.next = now
+	}
+
+	n := 0
+	for n < len(p) {
+		c := p[n:min(n+t.chunk(), len(p))]
+		time.Sleep(time.Until(t.next))
+
+		w, err := t.w.Write(c)
+		n += w
+		if err != nil {
+			return n, err
+		}
+		t.next = t.next.Add(time.Duration(len(c)) * t.byteTime)
+	}
+	return n, nil
+}
+
+// SetBaudRate emulates a line of baud bits per second, 0 turns it off.
+func (t *Term) SetBaudRate(baud int) error {
+	if baud != 0 && (baud < MinBaudRate || baud > MaxBaudRate) {
+		return ErrInvalidBaudRate
+	}
+
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	t.throttle = nil
+	if baud > 0 {
+		t.throttle = NewThrottle(t.C, baud)
+	}
+	return nil
+}
+
+// PlayANSI writes an ANSI art as it comes in a line of baud bits per
+// second, the art made with cursor positioning is animated. When skip
+// is closed the rest is written at once. It returns false if skipped or
+// if the connection fails.
+func (t *Term) PlayANSI(a []byte, baud int, skip <-chan struct{}) bool {
+	if baud < MinBaudRate || baud > MaxBaudRate {
+		baud = 9600
+	}
+	data, _ := ParseSauce(a)
+	text := []rune(DecodeCP437(data))
+
+	th := NewThrottle(t.C, baud)
+	for len(text) > 0 {
+		select {
+		case <-skip:
+			t.Update(func() {
+				t.WriteString(string(text))
+			})
+			return false
+		default:
+		}
+
+		n := min(th.chunk(), len(text))
+		s := string(text[:n])
+		text = text[n:]
+
+		var err error
+		t.outMutex.Lock()
+		if t.buffered {
+			t.writeString(s)
+		} else {
+			t.getScreen().Write(s)
+			_, err = th.Write(t.encode(s))
+		}
+		t.outMutex.Unlock()
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
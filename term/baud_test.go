@@ -0,0 +1,70 @@
+package term
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	var out bytes.Buffer
+	th := NewThrottle(&out, 9600)
+
+	// 120 bytes of 10 bits take 125ms
+	start := time.Now()
+	n, err := th.Write(bytes.Repeat([]byte("x"), 120))
+	elapsed := time.Since(start)
+	if err != nil || n != 120 || out.Len() != 120 {
+		t.Fatalf("Expected 120 bytes written, got %d %v", n, err)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("Expected about 125ms, got %v", elapsed)
+	}
+}
+
+func TestTerm_SetBaudRate(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 40, Height: 10, OutputMode: CP437}
+
+	if err := term.SetBaudRate(100); err != ErrInvalidBaudRate {
+		t.Fatalf("Expected ErrInvalidBaudRate, got %v", err)
+	}
+	if err := term.SetBaudRate(115200); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bytes are counted after the conversion
+	term.WriteString("█é")
+	if !bytes.Equal(out.Bytes(), []byte{0xdb, 0x82}) {
+		t.Fatalf("Unexpected output %q", out.Bytes())
+	}
+
+	if err := term.SetBaudRate(0); err != nil || term.throttle != nil {
+		t.Fatalf("Expected the throttle off, got %v", err)
+	}
+}
+
+func TestTerm_PlayANSI(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 40, Height: 10}
+
+	art := []byte("\x1b[2;3Hhello\x1b[1;1Hworld\x1a")
+	if !term.PlayANSI(art, 115200, nil) {
+		t.Fatal("Expected played to the end")
+	}
+	s := term.Screen()
+	if s.Line(1) != "world" || s.Line(2) != "  hello" {
+		t.Fatalf("Unexpected screen %q %q", s.Line(1), s.Line(2))
+	}
+
+	// skipped at the start, the art is written at once
+	term = &Term{C: &bytes.Buffer{}, Width: 40, Height: 10}
+	skip := make(chan struct{})
+	close(skip)
+	if term.PlayANSI(art, 300, skip) {
+		t.Fatal("Expected skipped")
+	}
+	if s := term.Screen(); s.Line(1) != "world" {
+		t.Fatalf("Unexpected screen %q", s.Line(1))
+	}
+}
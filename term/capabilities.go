@@ -0,0 +1,194 @@
+package term
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProbeTimeout is how long the probe waits for the replies of the
+// terminal, terminals that do not answer are detected by the variables
+// only.
+var ProbeTimeout = 500 * time.Millisecond
+
+// Capabilities of the terminal of the user.
+type Capabilities struct {
+	TermType     string
+	Version      string // name and version replied to XTVERSION
+	Encoding     OutputMode
+	ColorDepth   ColorDepth
+	InlineImages bool // iTerm2 inline images protocol
+	Sixel        bool
+	Mouse        bool
+	Responded    bool // the terminal answered the queries
+}
+
+// terminals that show true colors and iTerm2 inline images, by the
+// TERM_PROGRAM variable or the XTVERSION reply
+var (
+	trueColorTerminals    = []string{"iterm", "wezterm", "kitty", "foot", "contour", "mintty", "vscode", "alacritty", "ghostty"}
+	inlineImageTerminals  = []string{"iterm", "wezterm", "mintty", "konsole"}
+	mouseTerminalPrefixes = []string{"xterm", "screen", "tmux", "rxvt", "putty", "alacritty", "kitty", "foot", "wezterm", "linux"}
+)
+
+func containsAny(s string, list []string) bool {
+	s = strings.ToLower(s)
+	for _, v := range list {
+		if strings.Contains(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// localeEncoding returns the encoding of the locale variables, as in
+// pt_BR.UTF-8 or ru_RU.CP866, found is false without a locale or with
+// an unknown charset.
+func localeEncoding(env map[string]string) (m OutputMode, found bool) {
+	for _, k := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		v := env[k]
+		if v == "" {
+			continue
+		}
+		_, charset, _ := strings.Cut(v, ".")
+		charset, _, _ = strings.Cut(charset, "@")
+		return ParseOutputMode(charset)
+	}
+	return UTF8, false
+}
+
+// passiveCapabilities detects the capabilities from the TERM value of
+// the pty-req and the variables sent by the SSH client. Without a
+// locale with a known charset the terminal is taken as a CP437 one.
+func passiveCapabilities(termType string, env map[string]string) Capabilities {
+	c := Capabilities{
+		TermType:   termType,
+		Encoding:   CP437,
+		ColorDepth: DetectColorDepth(termType, env["COLORTERM"]),
+	}
+
+	if m, ok := localeEncoding(env); ok {
+		c.Encoding = m
+	}
+
+	program := env["TERM_PROGRAM"]
+	if containsAny(program, trueColorTerminals) {
+		c.ColorDepth = TrueColor
+	}
+	c.InlineImages = containsAny(program, inlineImageTerminals)
+
+	t := strings.ToLower(termType)
+	for _, p := range mouseTerminalPrefixes {
+		if strings.HasPrefix(t, p) {
+			c.Mouse = true
+		}
+	}
+	return c
+}
+
+// reply applies the reply of the terminal to a query, it returns true
+// for the primary device attributes, the last reply of the probe.
+func (c *Capabilities) reply(r string) bool {
+	c.Responded = true
+
+	switch {
+	case strings.HasPrefix(r, "\x1bP>|"):
+		// XTVERSION
+		c.Version = strings.TrimSuffix(r[4:], "\x1b\\")
+		if containsAny(c.Version, trueColorTerminals) {
+			c.ColorDepth = TrueColor
+		}
+		if containsAny(c.Version, inlineImageTerminals) {
+			c.InlineImages = true
+		}
+	case strings.HasPrefix(r, "\x1b[>") && strings.HasSuffix(r, "c"):
+		// secondary device attributes, only xterm compatible terminals answer
+		c.Mouse = true
+	case strings.HasPrefix(r, "\x1b[?") && strings.HasSuffix(r, "c"):
+		for _, p := range splitParams(r[3 : len(r)-1]) {
+			if p == 4 {
+				c.Sixel = true
+			}
+		}
+		return true
+	case strings.HasSuffix(r, "R"):
+		// the cursor position after a two bytes character, one column
+		// in a UTF-8 terminal
+		p := splitParams(r[2 : len(r)-1])
+		if len(p) == 2 {
+			switch p[1] {
+			case 2:
+				c.Encoding = UTF8
+			case 3:
+				// a single byte charset of the locale is kept
+				if c.Encoding == UTF8 {
+					c.Encoding = CP437
+				}
+			}
+		}
+	}
+	return false
+}
+
+// probeQueries writes "é" on the last row and asks the cursor position,
+// then the version and the device attributes. The cursor and the row
+// are restored after.
+func probeQueries(row int) string {
+	return "\0337\033[" + strconv.Itoa(row) + ";1Hé\033[6n" +
+		"\033[>0q\033[>c\033[c" +
+		"\r\033[2K\0338"
+}
+
+// Capabilities detects the capabilities of the terminal, env are the
+// variables sent by the SSH client. The first call queries the terminal
+// and waits up to ProbeTimeout for the replies, the next calls return
+// the same result. The color depth of the terminal is updated.
+func (t *Term) Capabilities(env map[string]string) Capabilities {
+	t.mutex.RLock()
+	caps := t.caps
+	t.mutex.RUnlock()
+	if caps != nil {
+		return *caps
+	}
+
+	c := passiveCapabilities(t.TermType, env)
+
+	replies := make(chan string, 8)
+	t.inMutex.Lock()
+	t.replies = replies
+	t.inMutex.Unlock()
+
+	_, h := t.GetSize()
+	t.outMutex.Lock()
+	// written as it is, the query must be UTF-8 in any output mode
+	_, err := io.WriteString(t.C, probeQueries(max(h, 2)))
+	if err == nil && t.screen != nil && t.screen.touched {
+		// the probe cleared the last row
+		t.emitString(t.screen.Repaint())
+	}
+	t.outMutex.Unlock()
+
+	timeout := time.After(ProbeTimeout)
+wait:
+	for err == nil {
+		select {
+		case r := <-replies:
+			if c.reply(r) {
+				break wait
+			}
+		case <-timeout:
+			break wait
+		}
+	}
+
+	t.inMutex.Lock()
+	t.replies = nil
+	t.inMutex.Unlock()
+
+	t.mutex.Lock()
+	t.caps = &c
+	t.ColorDepth = c.ColorDepth
+	t.mutex.Unlock()
+	return c
+}
@@ -0,0 +1,103 @@
+package term
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// notifyWriter signals each write.
+type notifyWriter struct {
+	b     strings.Builder
+	wrote chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.b.Write(p)
+	select {
+	case w.wrote <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+func TestPassiveCapabilities(t *testing.T) {
+	c := passiveCapabilities("xterm-256color", map[string]string{
+		"LANG":         "pt_BR.UTF-8",
+		"TERM_PROGRAM": "iTerm.app",
+	})
+	if c.Encoding != UTF8 || c.ColorDepth != TrueColor || !c.InlineImages || !c.Mouse {
+		t.Fatalf("Unexpected capabilities %+v", c)
+	}
+
+	c = passiveCapabilities("ansi", map[string]string{})
+	if c.Encoding != CP437 || c.ColorDepth != Colors16 || c.InlineImages || c.Mouse {
+		t.Fatalf("Unexpected capabilities %+v", c)
+	}
+
+	c = passiveCapabilities("xterm", map[string]string{"LC_ALL": "C", "LANG": "en_US.UTF-8"})
+	if c.Encoding != CP437 {
+		t.Fatal("Expected LC_ALL to override LANG")
+	}
+
+	c = passiveCapabilities("ansi", map[string]string{"LANG": "ru_RU.CP866"})
+	if c.Encoding != CP866 {
+		t.Fatalf("Expected CP866, got %v", c.Encoding)
+	}
+}
+
+func TestTerm_Capabilities(t *testing.T) {
+	w := &notifyWriter{wrote: make(chan struct{}, 1)}
+	term := &Term{C: w, Width: 80, Height: 24, TermType: "xterm"}
+
+	result := make(chan Capabilities)
+	go func() {
+		result <- term.Capabilities(map[string]string{})
+	}()
+
+	<-w.wrote
+	if !strings.Contains(w.b.String(), "\033[24;1Hé\033[6n") {
+		t.Fatalf("Unexpected queries %q", w.b.String())
+	}
+
+	events := term.Decode("a\x1b[24;2R\x1bP>|WezTerm 20240203\x1b\\\x1b[>1;10;0c\x1b[?62;4;22c")
+	if len(events) != 1 || events[0].String() != "a" {
+		t.Fatalf("Expected the replies removed from the input, got %v", events)
+	}
+
+	var c Capabilities
+	select {
+	case c = <-result:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the probe to end after the device attributes")
+	}
+
+	if !c.Responded || c.Encoding != UTF8 || !c.Sixel || !c.Mouse || !c.InlineImages {
+		t.Fatalf("Unexpected capabilities %+v", c)
+	}
+	if c.Version != "WezTerm 20240203" || c.ColorDepth != TrueColor {
+		t.Fatalf("Unexpected capabilities %+v", c)
+	}
+	if term.ColorDepth != TrueColor {
+		t.Fatal("Expected the color depth of the terminal updated")
+	}
+
+	// the result is kept
+	if term.Capabilities(nil) != c {
+		t.Fatal("Expected the same capabilities")
+	}
+}
+
+func TestTerm_CapabilitiesTimeout(t *testing.T) {
+	timeout := ProbeTimeout
+	ProbeTimeout = 10 * time.Millisecond
+	defer func() {
+		ProbeTimeout = timeout
+	}()
+
+	term := &Term{C: &strings.Builder{}, TermType: "vt100"}
+	c := term.Capabilities(map[string]string{"LANG": "en_US.UTF-8"})
+	if c.Responded || c.Encoding != UTF8 || c.Mouse {
+		t.Fatalf("Unexpected capabilities %+v", c)
+	}
+}
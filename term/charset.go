@@ -0,0 +1,257 @@
+package term
+
+import "strings"
+
+var (
+	CP852_TO_UTF8      [256]rune
+	CP866_TO_UTF8      [256]rune
+	ISO8859_1_TO_UTF8  [256]rune
+	ISO8859_15_TO_UTF8 [256]rune
+	AMIGA_TO_UTF8      [256]rune
+	PETSCII_TO_UTF8    [256]rune
+)
+
+// upper halves of the DOS code pages, the lower half is the one of CP437
+var (
+	cp852High = [128]rune{
+		'Ç', 'ü', 'é', 'â', 'ä', 'ů', 'ć', 'ç', 'ł', 'ë', 'Ő', 'ő', 'î', 'Ź', 'Ä', 'Ć',
+		'É', 'Ĺ', 'ĺ', 'ô', 'ö', 'Ľ', 'ľ', 'Ś', 'ś', 'Ö', 'Ü', 'Ť', 'ť', 'Ł', '×', 'č',
+		'á', 'í', 'ó', 'ú', 'Ą', 'ą', 'Ž', 'ž', 'Ę', 'ę', '¬', 'ź', 'Č', 'ş', '«', '»',
+		'░', '▒', '▓', '│', '┤', 'Á', 'Â', 'Ě', 'Ş', '╣', '║', '╗', '╝', 'Ż', 'ż', '┐',
+		'└', '┴', '┬', '├', '─', '┼', 'Ă', 'ă', '╚', '╔', '╩', '╦', '╠', '═', '╬', '¤',
+		'đ', 'Đ', 'Ď', 'Ë', 'ď', 'Ň', 'Í', 'Î', 'ě', '┘', '┌', '█', '▄', 'Ţ', 'Ů', '▀',
+		'Ó', 'ß', 'Ô', 'Ń', 'ń', 'ň', 'Š', 'š', 'Ŕ', 'Ú', 'ŕ', 'Ű', 'ý', 'Ý', 'ţ', '´',
+		'\u00ad', '˝', '˛', 'ˇ', '˘', '§', '÷', '¸', '°', '¨', '˙', 'ű', 'Ř', 'ř', '■', '\u00a0',
+	}
+
+	cp866High = [128]rune{
+		'А', 'Б', 'В', 'Г', 'Д', 'Е', 'Ж', 'З', 'И', 'Й', 'К', 'Л', 'М', 'Н', 'О', 'П',
+		'Р', 'С', 'Т', 'У', 'Ф', 'Х', 'Ц', 'Ч', 'Ш', 'Щ', 'Ъ', 'Ы', 'Ь', 'Э', 'Ю', 'Я',
+		'а', 'б', 'в', 'г', 'д', 'е', 'ж', 'з', 'и', 'й', 'к', 'л', 'м', 'н', 'о', 'п',
+		'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+		'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+		'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+		'р', 'с', 'т', 'у', 'ф', 'х', 'ц', 'ч', 'ш', 'щ', 'ъ', 'ы', 'ь', 'э', 'ю', 'я',
+		'Ё', 'ё', 'Є', 'є', 'Ї', 'ї', 'Ў', 'ў', '°', '∙', '·', '√', '№', '¤', '■', '\u00a0',
+	}
+
+	// graphics of the PETSCII lower case set from 0xa0, repeated from 0xe0
+	petsciiGraphics = [32]rune{
+		' ', '▌', '▄', '▔', '▁', '▏', '▒', '▕', '▒', '◤', '▕', '├', '▗', '└', '┐', '▂',
+		'┌', '┴', '┬', '┤', '▎', '▍', '▐', '▔', '▀', '▃', '✓', '▖', '▝', '┘', '▘', '▚',
+	}
+)
+
+// petsciiKeys are the PETSCII control codes sent by the keys.
+var petsciiKeys = map[byte]string{
+	0x11: "\x1b[B",
+	0x91: "\x1b[A",
+	0x1d: "\x1b[C",
+	0x9d: "\x1b[D",
+	0x13: "\x1b[H",
+	0x14: "\x7f",
+	0x94: "\x1b[2~",
+}
+
+// codePage converts text between UTF-8 and a single byte character set.
+type codePage struct {
+	toUTF8   *[256]rune
+	fromUTF8 map[rune]byte
+	keys     map[byte]string // input bytes that are keys
+}
+
+var codePages map[OutputMode]*codePage
+
+func init() {
+	for i := 0; i < 128; i++ {
+		CP852_TO_UTF8[i] = CP437_TO_UTF8[i]
+		CP852_TO_UTF8[i+128] = cp852High[i]
+		CP866_TO_UTF8[i] = CP437_TO_UTF8[i]
+		CP866_TO_UTF8[i+128] = cp866High[i]
+	}
+
+	for i := range ISO8859_1_TO_UTF8 {
+		ISO8859_1_TO_UTF8[i] = rune(i)
+	}
+	ISO8859_15_TO_UTF8 = ISO8859_1_TO_UTF8
+	for b, r := range map[byte]rune{
+		0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž',
+		0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+	} {
+		ISO8859_15_TO_UTF8[b] = r
+	}
+
+	// the Topaz font draws ISO-8859-1 and a shaded block for 0x7f
+	AMIGA_TO_UTF8 = ISO8859_1_TO_UTF8
+	AMIGA_TO_UTF8[0x7f] = '░'
+
+	// the lower case set of the Commodore 8 bit computers, the upper
+	// case letters are in 0xc1 to 0xda and repeated in 0x61 to 0x7a
+	for i := range PETSCII_TO_UTF8 {
+		PETSCII_TO_UTF8[i] = rune(i)
+	}
+	for i := 0; i < 26; i++ {
+		PETSCII_TO_UTF8[0x41+i] = 'a' + rune(i)
+		PETSCII_TO_UTF8[0x61+i] = 'A' + rune(i)
+		PETSCII_TO_UTF8[0xc1+i] = 'A' + rune(i)
+	}
+	for b, r := range map[byte]rune{
+		0x5c: '£', 0x5e: '↑', 0x5f: '←', 0x60: '─', 0x7b: '┼',
+		0x7c: '▒', 0x7d: '│', 0x7e: '▒', 0x7f: '▒', 0xc0: '─',
+		0xdb: '┼', 0xdc: '▒', 0xdd: '│', 0xde: '▒', 0xdf: '▒',
+	} {
+		PETSCII_TO_UTF8[b] = r
+	}
+	for i, r := range petsciiGraphics {
+		PETSCII_TO_UTF8[0xa0+i] = r
+		PETSCII_TO_UTF8[0xe0+i] = r
+	}
+
+	codePages = map[OutputMode]*codePage{
+		CP437:      {toUTF8: &CP437_TO_UTF8, fromUTF8: UTF8_TO_CP437},
+		CP850:      {toUTF8: &CP850_TO_UTF8, fromUTF8: UTF8_TO_CP850},
+		CP852:      newCodePage(&CP852_TO_UTF8),
+		CP866:      newCodePage(&CP866_TO_UTF8),
+		ISO8859_1:  newCodePage(&ISO8859_1_TO_UTF8),
+		ISO8859_15: newCodePage(&ISO8859_15_TO_UTF8),
+		Amiga:      newCodePage(&AMIGA_TO_UTF8),
+		PETSCII:    newCodePage(&PETSCII_TO_UTF8),
+	}
+	codePages[PETSCII].keys = petsciiKeys
+}
+
+func newCodePage(table *[256]rune) *codePage {
+	cp := &codePage{
+		toUTF8:   table,
+		fromUTF8: make(map[rune]byte, 256),
+	}
+	for i, r := range table {
+		cp.fromUTF8[r] = byte(i)
+	}
+	return cp
+}
+
+// appendRune appends the byte of the rune, a similar character when the
+// code page does not have it or '?'. The control characters are sent as
+// they are.
+func (cp *codePage) appendRune(b []byte, r rune) []byte {
+	if c, ok := cp.fromUTF8[r]; ok {
+		return append(b, c)
+	}
+	if r < 0x20 || r == 0x7f {
+		return append(b, byte(r))
+	}
+
+next:
+	for _, f := range fallback(r) {
+		n := len(b)
+		for _, fr := range f {
+			c, ok := cp.fromUTF8[fr]
+			if !ok {
+				b = b[:n]
+				continue next
+			}
+			b = append(b, c)
+		}
+		return b
+	}
+	return append(b, cp.fromUTF8['?'])
+}
+
+// decode converts the input to UTF-8, the control characters and the
+// escape sequences are kept.
+func (cp *codePage) decode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if k, ok := cp.keys[c]; ok {
+			sb.WriteString(k)
+			continue
+		}
+		if c < 0x20 || c == 0x7f {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteRune(cp.toUTF8[c])
+	}
+	return sb.String()
+}
+
+// fallbacks are the replacements of the characters missing in a code
+// page, in order of preference.
+var fallbacks = map[rune][]string{
+	'‘': {"'"}, '’': {"'"}, '‚': {","}, '′': {"'"},
+	'“': {"\""}, '”': {"\""}, '„': {"\""}, '″': {"\""},
+	'«': {"<<"}, '»': {">>"},
+	'‐': {"-"}, '–': {"-"}, '—': {"-"}, '―': {"-"}, '−': {"-"},
+	'…': {"..."}, '•': {"·", "*"}, '·': {"∙", "."}, '∙': {"·", "."},
+	'€': {"EUR"}, '£': {"L"}, '¥': {"Y"}, '¢': {"c"},
+	'©': {"(c)"}, '®': {"(R)"}, '™': {"TM"},
+	'×': {"x"}, '÷': {"/"}, '±': {"+-"}, '°': {"o"},
+	'¦': {"|"}, '¬': {"-"}, '§': {"S"}, '¶': {"P"},
+	'\u00a0': {" "}, '\u00ad': {"-"},
+	'←': {"<-"}, '→': {"->"}, '↑': {"^"}, '↓': {"v"},
+	'✓': {"√", "v"},
+
+	// ASCII missing in PETSCII
+	'|': {"│"}, '_': {"▁", "-"}, '~': {"-"}, '^': {"↑"}, '`': {"'"},
+	'\\': {"/"}, '{': {"("}, '}': {")"},
+
+	'─': {"-"}, '│': {"|"},
+	'┌': {"+"}, '┐': {"+"}, '└': {"+"}, '┘': {"+"},
+	'├': {"+"}, '┤': {"+"}, '┬': {"+"}, '┴': {"+"}, '┼': {"+"},
+	'═': {"─", "="}, '║': {"│", "|"},
+	'╔': {"┌", "+"}, '╗': {"┐", "+"}, '╚': {"└", "+"}, '╝': {"┘", "+"},
+	'╠': {"├", "+"}, '╣': {"┤", "+"}, '╦': {"┬", "+"}, '╩': {"┴", "+"}, '╬': {"┼", "+"},
+	'╒': {"┌", "+"}, '╓': {"┌", "+"}, '╕': {"┐", "+"}, '╖': {"┐", "+"},
+	'╘': {"└", "+"}, '╙': {"└", "+"}, '╛': {"┘", "+"}, '╜': {"┘", "+"},
+	'╞': {"├", "+"}, '╟': {"├", "+"}, '╡': {"┤", "+"}, '╢': {"┤", "+"},
+	'╤': {"┬", "+"}, '╥': {"┬", "+"}, '╧': {"┴", "+"}, '╨': {"┴", "+"},
+	'╪': {"┼", "+"}, '╫': {"┼", "+"},
+	'█': {"#"}, '▓': {"▒", "█", "#"}, '▒': {"▓", "░", "#"}, '░': {"▒", ":"},
+	'▀': {"█", "\""}, '▄': {"█", "_"}, '▌': {"█", "|"}, '▐': {"█", "|"},
+	'■': {"█", "#"}, '⌂': {"^"},
+
+	'ß': {"ss"}, 'Æ': {"AE"}, 'æ': {"ae"}, 'Œ': {"OE"}, 'œ': {"oe"},
+	'Ø': {"O"}, 'ø': {"o"}, 'Þ': {"Th"}, 'þ': {"th"}, 'ı': {"i"},
+}
+
+// letters are the base letters of the letters with diacritics.
+var letters = map[rune]string{
+	'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+	'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+	'D': "ĎĐÐ", 'd': "ďđð",
+	'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+	'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+	'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭį",
+	'L': "ĹĻĽĿŁ", 'l': "ĺļľŀł",
+	'N': "ÑŃŅŇ", 'n': "ñńņň",
+	'O': "ÒÓÔÕÖŌŎŐ", 'o': "òóôõöōŏő",
+	'R': "ŔŖŘ", 'r': "ŕŗř",
+	'S': "ŚŜŞŠ", 's': "śŝşš",
+	'T': "ŢŤ", 't': "ţť",
+	'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+	'Y': "ÝŶŸ", 'y': "ýÿŷ",
+	'Z': "ŹŻŽ", 'z': "źżž",
+}
+
+var baseLetters = make(map[rune]rune)
+
+func init() {
+	for base, s := range letters {
+		for _, r := range s {
+			baseLetters[r] = base
+		}
+	}
+}
+
+// fallback returns the replacements of a character.
+func fallback(r rune) []string {
+	if f, ok := fallbacks[r]; ok {
+		return f
+	}
+	if base, ok := baseLetters[r]; ok {
+		return []string{string(base)}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package term
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseOutputMode(t *testing.T) {
+	for name, want := range map[string]OutputMode{
+		"utf-8":      UTF8,
+		"cp437":      CP437,
+		"ISO-8859-1": ISO8859_1,
+		"iso8859_15": ISO8859_15,
+		"Amiga":      Amiga,
+		"petscii":    PETSCII,
+	} {
+		if m, ok := ParseOutputMode(name); !ok || m != want {
+			t.Fatalf("Expected %v for %q, got %v", want, name, m)
+		}
+	}
+	if _, ok := ParseOutputMode("EBCDIC"); ok {
+		t.Fatal("Expected an unknown mode")
+	}
+}
+
+func TestCodePages_RoundTrip(t *testing.T) {
+	for m, cp := range codePages {
+		for i := 0x20; i < 0x100; i++ {
+			if i == 0x7f {
+				continue
+			}
+			r := cp.toUTF8[i]
+			b := cp.appendRune(nil, r)
+			if len(b) != 1 || cp.toUTF8[b[0]] != r {
+				t.Fatalf("%v: %q of 0x%02x encoded as %q", m, r, i, b)
+			}
+		}
+	}
+}
+
+func TestTerm_Encode(t *testing.T) {
+	term := &Term{}
+	tests := []struct {
+		mode OutputMode
+		in   string
+		want []byte
+	}{
+		{CP437, "█é\a", []byte{0xdb, 0x82, 0x07}},
+		{CP437, "“™”", []byte("\"TM\"")},
+		{CP850, "╒═╕", []byte{0xda, 0xcd, 0xbf}},
+		{CP852, "Łódź", []byte{0x9d, 0xa2, 'd', 0xab}},
+		{CP866, "Привет", []byte{0x8f, 0xe0, 0xa8, 0xa2, 0xa5, 0xe2}},
+		{ISO8859_1, "ação€", []byte{'a', 0xe7, 0xe3, 'o', 'E', 'U', 'R'}},
+		{ISO8859_15, "€Š", []byte{0xa4, 0xa6}},
+		{Amiga, "ñ─", []byte{0xf1, '-'}},
+		{PETSCII, "Hi! ─|", []byte{0xc8, 0x49, '!', ' ', 0xc0, 0xdd}},
+		{CP437, "日", []byte{'?'}},
+	}
+	for _, tt := range tests {
+		term.OutputMode = tt.mode
+		if b := term.encode(tt.in); !bytes.Equal(b, tt.want) {
+			t.Fatalf("%v: expected % x for %q, got % x", tt.mode, tt.want, tt.in, b)
+		}
+	}
+}
+
+func TestTerm_DecodeInput(t *testing.T) {
+	term := &Term{OutputMode: CP437}
+	events := term.Decode("\x82\x1b[A")
+	if len(events) != 2 || events[0].Rune != 'é' || events[1].Key != KeyUp {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+
+	// the cursor keys of a Commodore are sent as control codes
+	term = &Term{OutputMode: PETSCII}
+	events = term.Decode("\xc8\x49\x91\x14\r")
+	if len(events) != 5 || events[0].Rune != 'H' || events[1].Rune != 'i' {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+	if events[2].Key != KeyUp || events[3].Key != KeyBackspace || events[4].Key != KeyEnter {
+		t.Fatalf("Unexpected keys %+v", events[2:])
+	}
+}
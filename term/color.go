@@ -0,0 +1,270 @@
+package term
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Color of a cell, the values from 0 to 255 are the indexed colors of
+// the terminal, RGB returns a true color.
+type Color int32
+
+const (
+	ColorDefault Color = -1
+	rgbColor     Color = 1 << 24
+)
+
+// RGB returns a true color.
+func RGB(r, g, b uint8) Color {
+	return rgbColor | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// IsRGB reports whether the color is a true color.
+func (c Color) IsRGB() bool {
+	return c >= rgbColor
+}
+
+// Components returns the red, green and blue of a true color.
+func (c Color) Components() (r, g, b uint8) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c)
+}
+
+// ColorDepth is the number of colors the terminal of the user shows.
+type ColorDepth int
+
+const (
+	Colors16 ColorDepth = iota
+	Colors256
+	TrueColor
+)
+
+// Colors returns the number of colors of the depth.
+func (d ColorDepth) Colors() int {
+	switch d {
+	case Colors256:
+		return 256
+	case TrueColor:
+		return 1 << 24
+	}
+	return 16
+}
+
+var ErrInvalidColor = errors.New("invalid color")
+
+var colorNames = map[string]Color{
+	"black":         0,
+	"red":           1,
+	"green":         2,
+	"yellow":        3,
+	"blue":          4,
+	"magenta":       5,
+	"cyan":          6,
+	"white":         7,
+	"gray":          8,
+	"grey":          8,
+	"brightblack":   8,
+	"brightred":     9,
+	"brightgreen":   10,
+	"brightyellow":  11,
+	"brightblue":    12,
+	"brightmagenta": 13,
+	"brightcyan":    14,
+	"brightwhite":   15,
+	"default":       ColorDefault,
+}
+
+// ParseColor returns the color of a name like "red" or "brightblue", a
+// number from 0 to 255 or a "#rrggbb" true color.
+func ParseColor(s string) (Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(s)
+
+	if c, ok := colorNames[s]; ok {
+		return c, nil
+	}
+
+	if strings.HasPrefix(s, "#") && len(s) == 7 {
+		v, err := strconv.ParseUint(s[1:], 16, 32)
+		if err != nil {
+			return ColorDefault, ErrInvalidColor
+		}
+		return RGB(uint8(v>>16), uint8(v>>8), uint8(v)), nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return ColorDefault, ErrInvalidColor
+	}
+	return Color(n), nil
+}
+
+// DetectColorDepth returns the color depth of a terminal from the TERM
+// and COLORTERM variables.
+func DetectColorDepth(termType, colorTerm string) ColorDepth {
+	colorTerm = strings.ToLower(colorTerm)
+	if colorTerm == "truecolor" || colorTerm == "24bit" {
+		return TrueColor
+	}
+
+	termType = strings.ToLower(termType)
+	switch {
+	case strings.Contains(termType, "truecolor") || strings.Contains(termType, "direct"):
+		return TrueColor
+	case strings.Contains(termType, "256color"):
+		return Colors256
+	}
+	return Colors16
+}
+
+// palette16 is the xterm RGB of the first 16 colors.
+var palette16 = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// rgb returns the components of an indexed or true color.
+func (c Color) rgb() (r, g, b uint8) {
+	switch {
+	case c.IsRGB():
+		return c.Components()
+	case c < 16:
+		p := palette16[c]
+		return p[0], p[1], p[2]
+	case c < 232:
+		i := int(c) - 16
+		return cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6]
+	}
+	v := uint8(8 + (int(c)-232)*10)
+	return v, v, v
+}
+
+func distance(r1, g1, b1, r2, g2, b2 uint8) int {
+	dr, dg, db := int(r1)-int(r2), int(g1)-int(g2), int(b1)-int(b2)
+	return dr*dr + dg*dg + db*db
+}
+
+// nearest returns the closest color from first to last.
+func nearest(c Color, first, last Color) Color {
+	r, g, b := c.rgb()
+	best, bestDist := first, -1
+	for i := first; i <= last; i++ {
+		ir, ig, ib := i.rgb()
+		d := distance(r, g, b, ir, ig, ib)
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// Convert returns the closest color the depth can show.
+func (d ColorDepth) Convert(c Color) Color {
+	switch {
+	case c == ColorDefault:
+		return c
+	case d == TrueColor:
+		return c
+	case d == Colors256 && c.IsRGB():
+		return nearest(c, 16, 255)
+	case d == Colors16 && (c.IsRGB() || c > 15):
+		return nearest(c, 0, 15)
+	}
+	return c
+}
+
+// colorParams returns the SGR parameters of a foreground color, base
+// is 30, or background color, base is 40.
+func colorParams(c Color, base int) string {
+	switch {
+	case c == ColorDefault:
+		return strconv.Itoa(base + 9)
+	case c.IsRGB():
+		r, g, b := c.Components()
+		return strconv.Itoa(base+8) + ";2;" +
+			strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" + strconv.Itoa(int(b))
+	case c < 8:
+		return strconv.Itoa(base + int(c))
+	case c < 16:
+		return strconv.Itoa(base + 60 + int(c) - 8)
+	}
+	return strconv.Itoa(base+8) + ";5;" + strconv.Itoa(int(c))
+}
+
+// colorDepth returns the depth used for the output, the code pages of
+// the old terminals only have 16 colors.
+func (t *Term) colorDepth() ColorDepth {
+	if t.OutputMode != UTF8 {
+		return Colors16
+	}
+	return t.ColorDepth
+}
+
+// DetectColorDepth sets the color depth from the terminal type sent in
+// the pty-req and the COLORTERM variable.
+func (t *Term) DetectColorDepth(colorTerm string) {
+	t.ColorDepth = DetectColorDepth(t.TermType, colorTerm)
+}
+
+func (t *Term) sgr(params string) {
+	t.WriteString("\033[" + params + "m")
+}
+
+// SetColor changes the foreground color.
+func (t *Term) SetColor(c Color) {
+	t.sgr(colorParams(t.colorDepth().Convert(c), 30))
+}
+
+// SetBackgroundColor changes the background color.
+func (t *Term) SetBackgroundColor(c Color) {
+	t.sgr(colorParams(t.colorDepth().Convert(c), 40))
+}
+
+// SetColorRGB changes the foreground to a true color, or the closest
+// color the terminal shows.
+func (t *Term) SetColorRGB(r, g, b uint8) {
+	t.SetColor(RGB(r, g, b))
+}
+
+// SetBackgroundColorRGB changes the background to a true color, or the
+// closest color the terminal shows.
+func (t *Term) SetBackgroundColorRGB(r, g, b uint8) {
+	t.SetBackgroundColor(RGB(r, g, b))
+}
+
+func (t *Term) SetBold() {
+	t.sgr("1")
+}
+
+func (t *Term) SetUnderline() {
+	t.sgr("4")
+}
+
+func (t *Term) SetBlink() {
+	t.sgr("5")
+}
+
+func (t *Term) SetReverse() {
+	t.sgr("7")
+}
+
+func (t *Term) SetInvisible() {
+	t.sgr("8")
+}
+
+// Reset restores the default colors and attributes.
+func (t *Term) Reset() {
+	t.sgr("0")
+}
+
+func (t *Term) SetCursorVisible(visible bool) {
+	if visible {
+		t.WriteString("\033[?25h")
+		return
+	}
+	t.WriteString("\033[?25l")
+}
@@ -0,0 +1,93 @@
+package term
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Color
+	}{
+		{"red", 1},
+		{"Bright Blue", 12},
+		{"bright_white", 15},
+		{"200", 200},
+		{"#0a0b0c", RGB(10, 11, 12)},
+		{"default", ColorDefault},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseColor(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != tt.want {
+			t.Fatalf("%q: expected %v, got %v", tt.s, tt.want, c)
+		}
+	}
+
+	for _, s := range []string{"", "purple", "256", "#12345"} {
+		_, err := ParseColor(s)
+		if err != ErrInvalidColor {
+			t.Fatalf("%q: expected ErrInvalidColor", s)
+		}
+	}
+}
+
+func TestColorDepth_Convert(t *testing.T) {
+	tests := []struct {
+		depth ColorDepth
+		c     Color
+		want  Color
+	}{
+		{TrueColor, RGB(1, 2, 3), RGB(1, 2, 3)},
+		{Colors256, RGB(255, 0, 0), 196},
+		{Colors256, RGB(128, 128, 128), 244},
+		{Colors256, 3, 3},
+		{Colors16, RGB(250, 0, 0), 9},
+		{Colors16, 196, 9},
+		{Colors16, 232, 0},
+		{Colors16, ColorDefault, ColorDefault},
+	}
+
+	for _, tt := range tests {
+		c := tt.depth.Convert(tt.c)
+		if c != tt.want {
+			t.Fatalf("%v %v: expected %v, got %v", tt.depth, tt.c, tt.want, c)
+		}
+	}
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	if DetectColorDepth("xterm-256color", "truecolor") != TrueColor {
+		t.Fatal("Expected TrueColor")
+	}
+	if DetectColorDepth("xterm-256color", "") != Colors256 {
+		t.Fatal("Expected Colors256")
+	}
+	if DetectColorDepth("ansi", "") != Colors16 {
+		t.Fatal("Expected Colors16")
+	}
+}
+
+func TestTerm_SetColor(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, ColorDepth: TrueColor}
+
+	term.SetColorRGB(1, 2, 3)
+	term.SetBackgroundColor(4)
+	if out.String() != "\033[38;2;1;2;3m\033[44m" {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+
+	// the code pages only have 16 colors
+	out.Reset()
+	term.OutputMode = CP437
+	term.SetColor(RGB(0, 0, 0))
+	term.SetColor(15)
+	if out.String() != "\033[30m\033[97m" {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+}
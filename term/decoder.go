@@ -0,0 +1,488 @@
+package term
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// EscapeTimeout is how long a lone escape waits for the rest of a
+// sequence before it is taken as the escape key.
+const EscapeTimeout = 50 * time.Millisecond
+
+// maxPasteLength limits the bracketed paste kept in memory.
+const maxPasteLength = 64 * 1024
+
+type EventType int
+
+const (
+	EventKey EventType = iota
+	EventMouse
+	EventPaste
+	EventReply
+)
+
+type Key int
+
+const (
+	KeyUnknown Key = iota
+	KeyRune
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
+
+var keyNames = map[Key]string{
+	KeyUnknown:   "unknown",
+	KeyEnter:     "enter",
+	KeyTab:       "tab",
+	KeyBackspace: "backspace",
+	KeyEscape:    "esc",
+	KeyUp:        "up",
+	KeyDown:      "down",
+	KeyRight:     "right",
+	KeyLeft:      "left",
+	KeyHome:      "home",
+	KeyEnd:       "end",
+	KeyInsert:    "insert",
+	KeyDelete:    "delete",
+	KeyPageUp:    "pgup",
+	KeyPageDown:  "pgdn",
+	KeyF1:        "f1",
+	KeyF2:        "f2",
+	KeyF3:        "f3",
+	KeyF4:        "f4",
+	KeyF5:        "f5",
+	KeyF6:        "f6",
+	KeyF7:        "f7",
+	KeyF8:        "f8",
+	KeyF9:        "f9",
+	KeyF10:       "f10",
+	KeyF11:       "f11",
+	KeyF12:       "f12",
+}
+
+// Mod is a set of modifier keys, the values are the same used by xterm
+// in the parameters of the sequences.
+type Mod int
+
+const (
+	ModShift Mod = 1 << iota
+	ModAlt
+	ModCtrl
+)
+
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	MouseNone
+	MouseWheelUp
+	MouseWheelDown
+)
+
+type MouseAction int
+
+const (
+	MousePress MouseAction = iota
+	MouseRelease
+	MouseMotion
+)
+
+// Event is a key press, a mouse report or a bracketed paste decoded
+// from the input of the user, or the reply of the terminal to a query.
+type Event struct {
+	Type   EventType
+	Key    Key
+	Rune   rune
+	Mod    Mod
+	Button MouseButton
+	Action MouseAction
+	X, Y   int    // column and row of the mouse, starting at 1
+	Text   string // pasted text or reply
+	Raw    string // bytes of the event as received
+}
+
+// String returns the name of the event as used by the Lua triggers,
+// the character for plain keys, "space", "ctrl+a", "alt+x", "shift+up",
+// "f1", "mouse", "paste" or "reply".
+func (ev Event) String() string {
+	switch ev.Type {
+	case EventMouse:
+		return "mouse"
+	case EventPaste:
+		return "paste"
+	case EventReply:
+		return "reply"
+	}
+
+	var b strings.Builder
+	if ev.Mod&ModCtrl != 0 {
+		b.WriteString("ctrl+")
+	}
+	if ev.Mod&ModAlt != 0 {
+		b.WriteString("alt+")
+	}
+	if ev.Mod&ModShift != 0 && ev.Key != KeyRune {
+		b.WriteString("shift+")
+	}
+
+	if ev.Key == KeyRune {
+		if ev.Rune == ' ' {
+			b.WriteString("space")
+			return b.String()
+		}
+		b.WriteRune(ev.Rune)
+		return b.String()
+	}
+
+	b.WriteString(keyNames[ev.Key])
+	return b.String()
+}
+
+// Decoder turns the raw bytes read from the connection in events, a
+// sequence split between reads is kept until the rest arrives.
+type Decoder struct {
+	buf []byte
+}
+
+// Feed decodes the input and returns the complete events.
+func (d *Decoder) Feed(s string) []Event {
+	d.buf = append(d.buf, s...)
+	return d.decodeAll(false)
+}
+
+// Pending reports whether part of a sequence is waiting for more input.
+func (d *Decoder) Pending() bool {
+	return len(d.buf) > 0
+}
+
+// Flush decodes the pending input as it is, a lone escape becomes the
+// escape key. An unfinished paste is kept.
+func (d *Decoder) Flush() []Event {
+	return d.decodeAll(true)
+}
+
+func (d *Decoder) decodeAll(flush bool) []Event {
+	var events []Event
+	for len(d.buf) > 0 {
+		ev, n := decode(d.buf, flush)
+		if n == 0 {
+			break
+		}
+		ev.Raw = string(d.buf[:n])
+		events = append(events, ev)
+		d.buf = d.buf[n:]
+	}
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+	return events
+}
+
+// decode returns the first event of b and its length, 0 when the
+// event is not complete.
+func decode(b []byte, flush bool) (Event, int) {
+	c := b[0]
+	switch {
+	case c == '\x1b':
+		return decodeEscape(b, flush)
+	case c == '\r':
+		// some clients send \r\n or \r\0 for enter
+		if len(b) > 1 && (b[1] == '\n' || b[1] == 0) {
+			return Event{Key: KeyEnter}, 2
+		}
+		return Event{Key: KeyEnter}, 1
+	case c == '\n':
+		return Event{Key: KeyEnter}, 1
+	case c == '\t':
+		return Event{Key: KeyTab}, 1
+	case c == '\x7f' || c == '\b':
+		return Event{Key: KeyBackspace}, 1
+	case c == 0:
+		return Event{Key: KeyRune, Rune: ' ', Mod: ModCtrl}, 1
+	case c < 0x1b:
+		return Event{Key: KeyRune, Rune: rune('a' + c - 1), Mod: ModCtrl}, 1
+	case c < ' ':
+		return Event{Key: KeyRune, Rune: rune(c + 0x40), Mod: ModCtrl}, 1
+	}
+
+	if !utf8.FullRune(b) && !flush {
+		return Event{}, 0
+	}
+	r, n := utf8.DecodeRune(b)
+	return Event{Key: KeyRune, Rune: r}, n
+}
+
+func decodeEscape(b []byte, flush bool) (Event, int) {
+	if len(b) == 1 {
+		if flush {
+			return Event{Key: KeyEscape}, 1
+		}
+		return Event{}, 0
+	}
+
+	switch b[1] {
+	case '[':
+		ev, n := decodeCSI(b, flush)
+		if n == 0 && flush && !bytes.HasPrefix(b, pasteStart) {
+			return Event{Key: KeyEscape}, 1
+		}
+		return ev, n
+	case 'O':
+		if len(b) < 3 {
+			if flush {
+				return Event{Key: KeyRune, Rune: 'O', Mod: ModAlt}, 2
+			}
+			return Event{}, 0
+		}
+		return decodeSS3(b[2]), 3
+	case 'P':
+		// device control string, the terminal replies XTVERSION with it
+		i := bytes.Index(b, stringTerminator)
+		if i < 0 {
+			if flush {
+				return Event{Key: KeyRune, Rune: 'P', Mod: ModAlt}, 2
+			}
+			if len(b) > maxReplyLength {
+				return Event{Type: EventReply, Text: string(b)}, len(b)
+			}
+			return Event{}, 0
+		}
+		n := i + len(stringTerminator)
+		return Event{Type: EventReply, Text: string(b[:n])}, n
+	case '\x1b':
+		return Event{Key: KeyEscape}, 1
+	}
+
+	// escape followed by a key is the key with alt
+	ev, n := decode(b[1:], flush)
+	if n == 0 {
+		return Event{}, 0
+	}
+	ev.Mod |= ModAlt
+	return ev, n + 1
+}
+
+var (
+	pasteStart       = []byte("\x1b[200~")
+	pasteEnd         = []byte("\x1b[201~")
+	stringTerminator = []byte("\x1b\\")
+)
+
+// maxReplyLength limits a device control string without terminator.
+const maxReplyLength = 256
+
+func decodeCSI(b []byte, flush bool) (Event, int) {
+	if bytes.HasPrefix(b, pasteStart) {
+		i := bytes.Index(b, pasteEnd)
+		if i < 0 {
+			if len(b) > maxPasteLength {
+				return Event{Type: EventPaste, Text: string(b[len(pasteStart):])}, len(b)
+			}
+			return Event{}, 0
+		}
+		return Event{Type: EventPaste, Text: string(b[len(pasteStart):i])}, i + len(pasteEnd)
+	}
+
+	// X10 mouse report, three bytes after ESC [ M
+	if len(b) > 2 && b[2] == 'M' {
+		if len(b) < 6 {
+			return Event{}, 0
+		}
+		return mouseEvent(int(b[3])-32, int(b[4])-32, int(b[5])-32, false), 6
+	}
+
+	j := 2
+	for j < len(b) && b[j] >= 0x20 && b[j] <= 0x3f {
+		j++
+	}
+	if j >= len(b) {
+		return Event{}, 0
+	}
+	if b[j] < 0x40 || b[j] > 0x7e {
+		// not a valid sequence, take the escape alone
+		return Event{Key: KeyEscape}, 1
+	}
+
+	params := string(b[2:j])
+	final := b[j]
+	n := j + 1
+
+	if strings.HasPrefix(params, "<") && (final == 'M' || final == 'm') {
+		p := splitParams(params[1:])
+		if len(p) != 3 {
+			return Event{Key: KeyUnknown}, n
+		}
+		return mouseEvent(p[0], p[1], p[2], final == 'm'), n
+	}
+
+	// the keyboard does not send private parameters, these are replies
+	// like the device attributes
+	if strings.HasPrefix(params, "?") || strings.HasPrefix(params, ">") {
+		return Event{Type: EventReply, Text: string(b[:n])}, n
+	}
+
+	p := splitParams(params)
+
+	// cursor position report, the first row is ambiguous with F3 with
+	// modifiers and is taken as the key
+	if final == 'R' && len(p) == 2 && p[0] > 1 {
+		return Event{Type: EventReply, Text: string(b[:n])}, n
+	}
+
+	mod := Mod(0)
+	if len(p) > 1 && p[1] > 1 {
+		mod = Mod(p[1] - 1)
+	}
+
+	var key Key
+	switch final {
+	case 'A':
+		key = KeyUp
+	case 'B':
+		key = KeyDown
+	case 'C':
+		key = KeyRight
+	case 'D':
+		key = KeyLeft
+	case 'H':
+		key = KeyHome
+	case 'F':
+		key = KeyEnd
+	case 'P', 'Q', 'R', 'S':
+		key = KeyF1 + Key(final-'P')
+	case 'Z':
+		return Event{Key: KeyTab, Mod: ModShift}, n
+	case '~':
+		if len(p) > 0 {
+			key = tildeKeys[p[0]]
+		}
+	}
+
+	if key == KeyUnknown {
+		return Event{Key: KeyUnknown}, n
+	}
+	return Event{Key: key, Mod: mod}, n
+}
+
+var tildeKeys = map[int]Key{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+}
+
+func decodeSS3(c byte) Event {
+	switch c {
+	case 'A':
+		return Event{Key: KeyUp}
+	case 'B':
+		return Event{Key: KeyDown}
+	case 'C':
+		return Event{Key: KeyRight}
+	case 'D':
+		return Event{Key: KeyLeft}
+	case 'H':
+		return Event{Key: KeyHome}
+	case 'F':
+		return Event{Key: KeyEnd}
+	case 'M':
+		return Event{Key: KeyEnter}
+	case 'P', 'Q', 'R', 'S':
+		return Event{Key: KeyF1 + Key(c-'P')}
+	}
+	return Event{Key: KeyUnknown}
+}
+
+// splitParams parses the numeric parameters of a sequence, a missing
+// parameter is 0.
+func splitParams(s string) []int {
+	if s == "" {
+		return nil
+	}
+	var p []int
+	for _, v := range strings.Split(s, ";") {
+		n, _ := strconv.Atoi(v)
+		p = append(p, n)
+	}
+	return p
+}
+
+// mouseEvent decodes the button byte of the mouse reports.
+func mouseEvent(cb, x, y int, release bool) Event {
+	ev := Event{Type: EventMouse, X: x, Y: y}
+
+	if cb&4 != 0 {
+		ev.Mod |= ModShift
+	}
+	if cb&8 != 0 {
+		ev.Mod |= ModAlt
+	}
+	if cb&16 != 0 {
+		ev.Mod |= ModCtrl
+	}
+
+	switch {
+	case cb&64 != 0:
+		ev.Button = MouseWheelUp + MouseButton(cb&1)
+	case cb&3 == 3:
+		// X10 reports the release without the button
+		ev.Button = MouseNone
+		release = true
+	default:
+		ev.Button = MouseButton(cb & 3)
+	}
+
+	switch {
+	case cb&32 != 0:
+		ev.Action = MouseMotion
+	case release:
+		ev.Action = MouseRelease
+	}
+
+	return ev
+}
@@ -0,0 +1,167 @@
+package term
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Feed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"runes", "ab1", []string{"a", "b", "1"}},
+		{"utf8", "ção", []string{"ç", "ã", "o"}},
+		{"enter", "x\r\ny\r", []string{"x", "enter", "y", "enter"}},
+		{"control", "\x01\x1a\x7f\t", []string{"ctrl+a", "ctrl+z", "backspace", "tab"}},
+		{"arrows", "\x1b[A\x1b[B\x1b[C\x1b[D", []string{"up", "down", "right", "left"}},
+		{"modifiers", "\x1b[1;5C\x1b[1;2A\x1b[3;3~", []string{"ctrl+right", "shift+up", "alt+delete"}},
+		{"ss3", "\x1bOP\x1bOS\x1bOH", []string{"f1", "f4", "home"}},
+		{"tilde", "\x1b[2~\x1b[5~\x1b[6~\x1b[15~\x1b[24~", []string{"insert", "pgup", "pgdn", "f5", "f12"}},
+		{"shift tab", "\x1b[Z", []string{"shift+tab"}},
+		{"alt", "\x1bx\x1b\x01", []string{"alt+x", "ctrl+alt+a"}},
+		{"unknown", "\x1b[9x", []string{"unknown"}},
+		{"replies", "\x1b[?1;2c\x1b[>0;276;0c\x1b[24;2R\x1b[1;5R\x1bP>|XTerm(372)\x1b\\", []string{"reply", "reply", "reply", "ctrl+f3", "reply"}},
+		{"paste", "\x1b[200~1\r2\x1b[201~3", []string{"paste", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Decoder
+			events := d.Feed(tt.input)
+			if len(events) != len(tt.want) {
+				t.Fatalf("Expected %d events, got %d: %v", len(tt.want), len(events), events)
+			}
+			for i, ev := range events {
+				if ev.String() != tt.want[i] {
+					t.Fatalf("Expected %q, got %q", tt.want[i], ev.String())
+				}
+			}
+			if d.Pending() {
+				t.Fatal("Expected no pending input")
+			}
+		})
+	}
+}
+
+func TestDecoder_SplitReads(t *testing.T) {
+	var d Decoder
+
+	events := d.Feed("a\x1b[1;")
+	if len(events) != 1 || !d.Pending() {
+		t.Fatal("Expected the sequence to be pending")
+	}
+
+	events = d.Feed("5D\xc3")
+	if len(events) != 1 || events[0].Key != KeyLeft || events[0].Mod != ModCtrl {
+		t.Fatalf("Expected ctrl+left, got %v", events)
+	}
+
+	if events[0].Raw != "\x1b[1;5D" {
+		t.Fatalf("Unexpected raw %q", events[0].Raw)
+	}
+
+	events = d.Feed("\xa7")
+	if len(events) != 1 || events[0].Rune != 'ç' {
+		t.Fatalf("Expected ç, got %v", events)
+	}
+
+	events = d.Feed("\x1b[200~hello ")
+	if len(events) != 0 {
+		t.Fatal("Expected the paste to be pending")
+	}
+
+	// an unfinished paste is not flushed
+	if len(d.Flush()) != 0 {
+		t.Fatal("Expected the paste to be pending")
+	}
+
+	events = d.Feed("world\x1b[201~")
+	if len(events) != 1 || events[0].Text != "hello world" {
+		t.Fatalf("Expected the paste, got %v", events)
+	}
+}
+
+func TestDecoder_Flush(t *testing.T) {
+	var d Decoder
+
+	events := d.Feed("\x1b")
+	if len(events) != 0 {
+		t.Fatal("Expected the escape to be pending")
+	}
+
+	events = d.Flush()
+	if len(events) != 1 || events[0].Key != KeyEscape {
+		t.Fatalf("Expected esc, got %v", events)
+	}
+
+	if d.Pending() {
+		t.Fatal("Expected no pending input")
+	}
+}
+
+func TestDecoder_Mouse(t *testing.T) {
+	var d Decoder
+
+	events := d.Feed("\x1b[<0;10;5M\x1b[<0;10;5m\x1b[<65;1;2M\x1b[<35;3;4M\x1b[M !\"")
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events, got %d", len(events))
+	}
+
+	ev := events[0]
+	if ev.Type != EventMouse || ev.Button != MouseLeft || ev.Action != MousePress || ev.X != 10 || ev.Y != 5 {
+		t.Fatalf("Unexpected press %+v", ev)
+	}
+
+	if events[1].Action != MouseRelease {
+		t.Fatalf("Unexpected release %+v", events[1])
+	}
+
+	if events[2].Button != MouseWheelDown {
+		t.Fatalf("Unexpected wheel %+v", events[2])
+	}
+
+	if events[3].Action != MouseMotion || events[3].Button != MouseNone {
+		t.Fatalf("Unexpected motion %+v", events[3])
+	}
+
+	ev = events[4]
+	if ev.Button != MouseLeft || ev.X != 1 || ev.Y != 2 {
+		t.Fatalf("Unexpected X10 report %+v", ev)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"1", []string{"1"}},
+		{" ", []string{"space"}},
+		{"Up", []string{"up"}},
+		{"Ctrl+C", []string{"ctrl+c"}},
+		{"shift+ctrl+PageUp", []string{"ctrl+shift+pgup"}},
+		{"escape", []string{"esc"}},
+		{"shift+a", []string{"A"}},
+		{"ctrl++", []string{"ctrl++"}},
+		{"ctrl+x ctrl+s", []string{"ctrl+x", "ctrl+s"}},
+		{"g g", []string{"g", "g"}},
+		{"\x1b[A", []string{"up"}},
+		{"\x1bOP", []string{"f1"}},
+		{"ctrl+i", []string{"tab"}},
+		{"Ctrl+M", []string{"enter"}},
+		{"ctrl+h", []string{"backspace"}},
+		{"ctrl+alt+h", []string{"ctrl+alt+h"}},
+		{"help", []string{"h", "e", "l", "p"}},
+		{"PageDown", []string{"pgdn"}},
+		{"F12", []string{"f12"}},
+	}
+
+	for _, tt := range tests {
+		got := ParseKeys(tt.input)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Fatalf("ParseKeys(%q) = %q, expected %q", tt.input, got, tt.want)
+		}
+	}
+}
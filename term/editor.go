@@ -0,0 +1,396 @@
+package term
+
+import (
+	"fmt"
+	"strings"
+)
+
+const editorHelp = " ^Z save  ^C abort  ^K cut  ^U paste  ^V ins/ovr"
+
+// Editor is a full-screen multi-line text editor, the first row of the
+// screen shows the status and the keys, the text uses the rest.
+type Editor struct {
+	lines     [][]rune
+	row, col  int
+	top       int
+	overwrite bool
+	clipboard []rune
+	width     int
+	height    int
+	full      bool
+	quit      func(saved bool)
+}
+
+// NewEditor returns an editor with the initial text for a screen of
+// width x height.
+func NewEditor(initial string, width, height int) *Editor {
+	e := &Editor{}
+
+	initial = strings.ReplaceAll(initial, "\r\n", "\n")
+	for _, l := range strings.Split(initial, "\n") {
+		e.lines = append(e.lines, []rune(l))
+	}
+
+	e.resize(width, height)
+	return e
+}
+
+// String returns the text, lines are separated by "\n".
+func (e *Editor) String() string {
+	s := make([]string, len(e.lines))
+	for i, l := range e.lines {
+		s[i] = string(l)
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e *Editor) resize(width, height int) {
+	if width < 20 {
+		width = 80
+	}
+	if height < 4 {
+		height = 24
+	}
+	e.width, e.height = width, height
+	e.full = true
+
+	for i := 0; i < len(e.lines); i++ {
+		e.wrapLine(i)
+	}
+	e.scroll()
+}
+
+// maxLen is the longest line, the last column is not used to avoid the
+// automatic wrap of the terminal.
+func (e *Editor) maxLen() int {
+	return e.width - 1
+}
+
+func (e *Editor) textHeight() int {
+	return e.height - 1
+}
+
+// event applies an event to the buffer, it returns true when the
+// editor is done and if the text was saved.
+func (e *Editor) event(ev Event) (done bool, saved bool) {
+	switch ev.Type {
+	case EventMouse:
+		return false, false
+	case EventPaste:
+		for _, r := range ev.Text {
+			switch {
+			case r == '\n':
+				e.splitLine()
+			case r >= ' ':
+				e.insertRune(r)
+			}
+		}
+		e.scroll()
+		return false, false
+	}
+
+	key := ev.Key
+	if key == KeyRune && ev.Mod&ModCtrl != 0 {
+		switch ev.Rune {
+		case 'z':
+			return true, true
+		case 'c':
+			return true, false
+		case 'k':
+			e.cutLine()
+		case 'u':
+			e.pasteLine()
+		case 'v':
+			e.overwrite = !e.overwrite
+		case 'a':
+			key = KeyHome
+		case 'e':
+			key = KeyEnd
+		}
+	}
+
+	switch key {
+	case KeyRune:
+		if ev.Mod&(ModCtrl|ModAlt) == 0 {
+			e.insertRune(ev.Rune)
+		}
+	case KeyTab:
+		e.insertRune(' ')
+		for e.col%4 != 0 {
+			e.insertRune(' ')
+		}
+	case KeyEnter:
+		e.splitLine()
+	case KeyBackspace:
+		e.backspace()
+	case KeyDelete:
+		e.delete()
+	case KeyUp:
+		e.moveTo(e.row-1, e.col)
+	case KeyDown:
+		e.moveTo(e.row+1, e.col)
+	case KeyLeft:
+		if e.col == 0 && e.row > 0 {
+			e.moveTo(e.row-1, len(e.lines[e.row-1]))
+			break
+		}
+		e.moveTo(e.row, e.col-1)
+	case KeyRight:
+		if e.col == len(e.lines[e.row]) && e.row < len(e.lines)-1 {
+			e.moveTo(e.row+1, 0)
+			break
+		}
+		e.moveTo(e.row, e.col+1)
+	case KeyHome:
+		e.col = 0
+	case KeyEnd:
+		e.col = len(e.lines[e.row])
+	case KeyPageUp:
+		e.moveTo(e.row-e.textHeight(), e.col)
+	case KeyPageDown:
+		e.moveTo(e.row+e.textHeight(), e.col)
+	case KeyInsert:
+		e.overwrite = !e.overwrite
+	}
+
+	e.scroll()
+	return false, false
+}
+
+func (e *Editor) moveTo(row, col int) {
+	if row < 0 {
+		row = 0
+	}
+	if row > len(e.lines)-1 {
+		row = len(e.lines) - 1
+	}
+	if col < 0 {
+		col = 0
+	}
+	if col > len(e.lines[row]) {
+		col = len(e.lines[row])
+	}
+	e.row, e.col = row, col
+}
+
+// scroll keeps the cursor row visible.
+func (e *Editor) scroll() {
+	if e.row < e.top {
+		e.top = e.row
+		e.full = true
+	}
+	if e.row >= e.top+e.textHeight() {
+		e.top = e.row - e.textHeight() + 1
+		e.full = true
+	}
+}
+
+func (e *Editor) insertRune(r rune) {
+	line := e.lines[e.row]
+	if e.overwrite && e.col < len(line) {
+		line[e.col] = r
+	} else {
+		n := make([]rune, 0, len(line)+1)
+		n = append(n, line[:e.col]...)
+		n = append(n, r)
+		n = append(n, line[e.col:]...)
+		e.lines[e.row] = n
+	}
+	e.col++
+
+	if len(e.lines[e.row]) > e.maxLen() {
+		e.wrapLine(e.row)
+	}
+}
+
+// wrapLine breaks a line longer than the screen at the last space,
+// moving the last word to a new line below.
+func (e *Editor) wrapLine(i int) {
+	line := e.lines[i]
+	if len(line) <= e.maxLen() {
+		return
+	}
+
+	cut, skip := e.maxLen(), 0
+	for j := e.maxLen(); j > 0; j-- {
+		if line[j] == ' ' {
+			cut, skip = j, 1
+			break
+		}
+	}
+
+	head := append([]rune{}, line[:cut]...)
+	tail := append([]rune{}, line[cut+skip:]...)
+	e.lines[i] = head
+	e.insertLine(i+1, tail)
+
+	if e.row == i && e.col > cut {
+		e.row++
+		e.col -= cut + skip
+		if e.col < 0 {
+			e.col = 0
+		}
+	} else if e.row > i {
+		e.row++
+	}
+	e.full = true
+
+	e.wrapLine(i + 1)
+}
+
+func (e *Editor) insertLine(i int, line []rune) {
+	e.lines = append(e.lines, nil)
+	copy(e.lines[i+1:], e.lines[i:])
+	e.lines[i] = line
+}
+
+func (e *Editor) removeLine(i int) {
+	e.lines = append(e.lines[:i], e.lines[i+1:]...)
+	if len(e.lines) == 0 {
+		e.lines = [][]rune{{}}
+	}
+}
+
+func (e *Editor) splitLine() {
+	line := e.lines[e.row]
+	head := append([]rune{}, line[:e.col]...)
+	tail := append([]rune{}, line[e.col:]...)
+	e.lines[e.row] = head
+	e.insertLine(e.row+1, tail)
+	e.row++
+	e.col = 0
+	e.full = true
+}
+
+// joinLine appends the next line to line i.
+func (e *Editor) joinLine(i int) {
+	if i >= len(e.lines)-1 {
+		return
+	}
+	e.lines[i] = append(e.lines[i], e.lines[i+1]...)
+	e.removeLine(i + 1)
+	e.full = true
+
+	e.wrapLine(i)
+}
+
+func (e *Editor) backspace() {
+	if e.col == 0 {
+		if e.row == 0 {
+			return
+		}
+		e.row--
+		e.col = len(e.lines[e.row])
+		e.joinLine(e.row)
+		return
+	}
+
+	line := e.lines[e.row]
+	e.lines[e.row] = append(line[:e.col-1], line[e.col:]...)
+	e.col--
+}
+
+func (e *Editor) delete() {
+	line := e.lines[e.row]
+	if e.col == len(line) {
+		e.joinLine(e.row)
+		return
+	}
+	e.lines[e.row] = append(line[:e.col], line[e.col+1:]...)
+}
+
+func (e *Editor) cutLine() {
+	e.clipboard = e.lines[e.row]
+	e.removeLine(e.row)
+	e.moveTo(e.row, 0)
+	e.full = true
+}
+
+func (e *Editor) pasteLine() {
+	if e.clipboard == nil {
+		return
+	}
+	e.insertLine(e.row, append([]rune{}, e.clipboard...))
+	e.col = 0
+	e.full = true
+}
+
+func (e *Editor) status() string {
+	mode := "INS"
+	if e.overwrite {
+		mode = "OVR"
+	}
+	pos := fmt.Sprintf("%s %d:%d ", mode, e.row+1, e.col+1)
+
+	help := editorHelp
+	pad := e.width - len([]rune(help)) - len(pos)
+	if pad < 1 {
+		help = ""
+		pad = e.width - len(pos)
+	}
+	if pad < 0 {
+		pad = 0
+	}
+	return help + strings.Repeat(" ", pad) + pos
+}
+
+// draw writes the editor to the terminal, the whole screen when the
+// layout changed or only the line of the cursor.
+func (e *Editor) draw(t *Term) {
+	t.writeString("\033[1;1H\033[0;7m" + e.status() + "\033[0m")
+
+	if e.full {
+		for i := 0; i < e.textHeight(); i++ {
+			e.drawLine(t, e.top+i)
+		}
+		e.full = false
+	} else {
+		e.drawLine(t, e.row)
+	}
+
+	t.writeString(fmt.Sprintf("\033[%d;%dH", e.row-e.top+2, e.col+1))
+}
+
+func (e *Editor) drawLine(t *Term, i int) {
+	t.writeString(fmt.Sprintf("\033[%d;1H\033[K", i-e.top+2))
+	if i < len(e.lines) {
+		t.writeString(string(e.lines[i]))
+	}
+}
+
+// EditText shows a full-screen editor with the initial text and blocks
+// until the user saves or aborts, it returns the text and true if saved.
+func (t *Term) EditText(initial string) (string, bool) {
+	type result struct {
+		text  string
+		saved bool
+	}
+	done := make(chan result, 1)
+	t.StartEditText(initial, func(text string, saved bool) {
+		done <- result{text, saved}
+	})
+	r := <-done
+	return r.text, r.saved
+}
+
+// StartEditText shows a full-screen editor with the initial text, done
+// is called with the text and true when the user saves, with the
+// initial text and false when the user aborts.
+func (t *Term) StartEditText(initial string, done func(text string, saved bool)) {
+	w, h := t.GetSize()
+	e := NewEditor(initial, w, h)
+	e.quit = func(saved bool) {
+		t.WriteString("\033[2J\033[1;1H")
+		if !saved {
+			done(initial, false)
+			return
+		}
+		done(e.String(), true)
+	}
+
+	t.outMutex.Lock()
+	t.editor = e
+	t.writeString("\033[2J")
+	e.draw(t)
+	t.outMutex.Unlock()
+}
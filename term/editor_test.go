@@ -0,0 +1,82 @@
+package term
+
+import "testing"
+
+// feed decodes the input and sends the events to the editor.
+func feed(e *Editor, s string) (done, saved bool) {
+	var d Decoder
+	for _, ev := range d.Feed(s) {
+		done, saved = e.event(ev)
+		if done {
+			break
+		}
+	}
+	return done, saved
+}
+
+func TestEditor_Input(t *testing.T) {
+	e := NewEditor("", 80, 24)
+
+	done, _ := feed(e, "hello\rworld")
+	if done {
+		t.Fatal("Expected editor not done")
+	}
+
+	if e.String() != "hello\nworld" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+
+	// up, end, backspace
+	feed(e, "\x1b[A\x1b[F\x7f")
+	if e.String() != "hell\nworld" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+
+	// delete at the end of the line joins the next line
+	feed(e, "\x1b[3~")
+	if e.String() != "hellworld" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+
+	// overwrite
+	feed(e, "\x1b[H\x16J")
+	if e.String() != "Jellworld" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+
+	done, saved := feed(e, "\x1a")
+	if !done || !saved {
+		t.Fatal("Expected saved")
+	}
+
+	done, saved = feed(e, "\x03")
+	if !done || saved {
+		t.Fatal("Expected aborted")
+	}
+}
+
+func TestEditor_CutPaste(t *testing.T) {
+	e := NewEditor("one\ntwo\nthree", 80, 24)
+
+	feed(e, "\x0b\x1b[B\x15")
+	if e.String() != "two\none\nthree" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+}
+
+func TestEditor_WordWrap(t *testing.T) {
+	e := NewEditor("", 20, 24)
+
+	feed(e, "the quick brown fox jumps")
+	if len(e.lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(e.lines))
+	}
+
+	if string(e.lines[0]) != "the quick brown fox" || string(e.lines[1]) != "jumps" {
+		t.Fatalf("Unexpected text %q", e.String())
+	}
+
+	if e.row != 1 || e.col != 5 {
+		t.Fatalf("Unexpected cursor %d:%d", e.row, e.col)
+	}
+}
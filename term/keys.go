@@ -0,0 +1,147 @@
+package term
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+var keyAliases = map[string]string{
+	"escape":    "esc",
+	"return":    "enter",
+	"pageup":    "pgup",
+	"pagedown":  "pgdn",
+	"del":       "delete",
+	"ins":       "insert",
+	"bs":        "backspace",
+	"spacebar":  "space",
+	"arrowup":   "up",
+	"arrowdown": "down",
+}
+
+// ctrlKeys are the keys the terminal sends with the byte of a letter
+// with ctrl, the trigger "ctrl+i" is the tab key.
+var ctrlKeys = map[string]string{
+	"i": "tab",
+	"j": "enter",
+	"m": "enter",
+	"h": "backspace",
+}
+
+var modNames = map[string]Mod{
+	"ctrl":    ModCtrl,
+	"control": ModCtrl,
+	"alt":     ModAlt,
+	"meta":    ModAlt,
+	"shift":   ModShift,
+}
+
+// ParseKeys returns the names of a sequence of keys separated by spaces,
+// like "ctrl+x ctrl+s", in the same form returned by Event.String. A
+// string with raw escape sequences is decoded.
+func ParseKeys(s string) []string {
+	if strings.ContainsFunc(s, func(r rune) bool { return r < ' ' || r == '\x7f' }) {
+		var d Decoder
+		events := append(d.Feed(s), d.Flush()...)
+		names := make([]string, len(events))
+		for i, ev := range events {
+			names[i] = ev.String()
+		}
+		return names
+	}
+
+	if s != "" && strings.TrimSpace(s) == "" {
+		return []string{"space"}
+	}
+
+	var names []string
+	for _, f := range strings.Fields(s) {
+		if isWord(f) {
+			// a word that is not a key is typed letter by letter, as
+			// the triggers of the older scripts
+			for _, r := range f {
+				names = append(names, string(r))
+			}
+			continue
+		}
+		names = append(names, keyName(f))
+	}
+	return names
+}
+
+// isWord reports whether s has more than one letter and is not the name
+// of a key.
+func isWord(s string) bool {
+	if utf8.RuneCountInString(s) == 1 || strings.Contains(s, "+") {
+		return false
+	}
+	name := strings.ToLower(s)
+	if _, ok := keyAliases[name]; ok {
+		return false
+	}
+	switch name {
+	case "space", "mouse", "paste", "reply":
+		return false
+	}
+	for _, n := range keyNames {
+		if n == name {
+			return false
+		}
+	}
+	return true
+}
+
+// keyName returns the canonical name of a key with its modifiers,
+// "Ctrl+Shift+PageUp" is "ctrl+shift+pgup".
+func keyName(s string) string {
+	if utf8.RuneCountInString(s) == 1 {
+		return s
+	}
+
+	parts := strings.Split(s, "+")
+	key, mods := parts[len(parts)-1], parts[:len(parts)-1]
+	if key == "" && len(mods) > 0 {
+		// the plus key itself, as in "ctrl++"
+		key, mods = "+", mods[:len(mods)-1]
+	}
+
+	var mod Mod
+	for _, m := range mods {
+		v, ok := modNames[strings.ToLower(m)]
+		if !ok {
+			return s
+		}
+		mod |= v
+	}
+
+	if utf8.RuneCountInString(key) > 1 {
+		key = strings.ToLower(key)
+		if a, ok := keyAliases[key]; ok {
+			key = a
+		}
+	} else {
+		// the terminal sends shift with letters as the upper case letter
+		if mod&ModShift != 0 {
+			key = strings.ToUpper(key)
+			mod &^= ModShift
+		}
+		if mod&ModCtrl != 0 {
+			key = strings.ToLower(key)
+			if k, ok := ctrlKeys[key]; ok && mod == ModCtrl {
+				return k
+			}
+		}
+	}
+
+	var b strings.Builder
+	if mod&ModCtrl != 0 {
+		b.WriteString("ctrl+")
+	}
+	if mod&ModAlt != 0 {
+		b.WriteString("alt+")
+	}
+	if mod&ModShift != 0 {
+		b.WriteString("shift+")
+	}
+	b.WriteString(key)
+	return b.String()
+}
@@ -0,0 +1,319 @@
+package term
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// artWidth is the width of the ANSI art without a SAUCE record.
+const artWidth = 80
+
+// Pager shows a long text one page at a time, the last row of the
+// screen shows the position and the keys. ANSI sequences in the text
+// are interpreted, each cell keeps its colors across the pages.
+type Pager struct {
+	text     string
+	lines    [][]Cell
+	top      int
+	width    int
+	height   int
+	art      bool // rendered once in the width of the art
+	query    []rune
+	search   bool // typing the search
+	notFound bool
+	quit     func()
+}
+
+// NewPager returns a pager with the text for a screen of width x height.
+func NewPager(text string, width, height int) *Pager {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+
+	p := &Pager{
+		text: text,
+	}
+	p.resize(width, height)
+	return p
+}
+
+// NewArtPager returns a pager with the ANSI art for a screen of
+// width x height.
+func NewArtPager(a *ANSIArt, width, height int) *Pager {
+	p := &Pager{
+		lines: a.Lines,
+		art:   true,
+	}
+	p.resize(width, height)
+	return p
+}
+
+func (p *Pager) resize(width, height int) {
+	if width < 20 {
+		width = 80
+	}
+	if height < 4 {
+		height = 24
+	}
+
+	if !p.art && (width != p.width || p.lines == nil) {
+		p.lines = render(p.text, width)
+	}
+	p.width, p.height = width, height
+	p.scroll(0)
+}
+
+func (p *Pager) pageHeight() int {
+	return p.height - 1
+}
+
+// scroll moves the top line by n keeping the last page full.
+func (p *Pager) scroll(n int) {
+	p.top = min(p.top+n, len(p.lines)-p.pageHeight())
+	p.top = max(p.top, 0)
+}
+
+// lineText returns the characters of a line.
+func lineText(line []Cell) string {
+	r := make([]rune, len(line))
+	for i, c := range line {
+		r[i] = c.Rune
+	}
+	return string(r)
+}
+
+// find moves to the next line with the query after from.
+func (p *Pager) find(from int) {
+	q := strings.ToLower(string(p.query))
+	p.notFound = false
+	if q == "" {
+		return
+	}
+	for i := from; i < len(p.lines); i++ {
+		if strings.Contains(strings.ToLower(lineText(p.lines[i])), q) {
+			p.top = 0
+			p.scroll(i)
+			return
+		}
+	}
+	p.notFound = true
+}
+
+// event applies an event to the pager, it returns true when the user quits.
+func (p *Pager) event(ev Event) bool {
+	if ev.Type != EventKey {
+		if ev.Type == EventMouse {
+			switch ev.Button {
+			case MouseWheelUp:
+				p.scroll(-3)
+			case MouseWheelDown:
+				p.scroll(3)
+			}
+		}
+		return false
+	}
+
+	if p.search {
+		switch ev.Key {
+		case KeyEnter:
+			p.search = false
+			p.find(p.top)
+		case KeyEscape:
+			p.search = false
+			p.query = nil
+		case KeyBackspace:
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+			}
+		case KeyRune:
+			if ev.Mod&(ModCtrl|ModAlt) == 0 {
+				p.query = append(p.query, ev.Rune)
+			}
+		}
+		return false
+	}
+
+	key := ev.Key
+	if key == KeyRune && ev.Mod == 0 {
+		switch ev.Rune {
+		case 'q', 'Q':
+			return true
+		case ' ':
+			key = KeyPageDown
+		case 'b':
+			key = KeyPageUp
+		case 'j':
+			key = KeyDown
+		case 'k':
+			key = KeyUp
+		case 'g':
+			key = KeyHome
+		case 'G':
+			key = KeyEnd
+		case '/':
+			p.search = true
+			p.query = nil
+			p.notFound = false
+		case 'n':
+			p.find(p.top + 1)
+		}
+	}
+
+	switch key {
+	case KeyEscape:
+		return true
+	case KeyUp:
+		p.scroll(-1)
+	case KeyDown, KeyEnter:
+		p.scroll(1)
+	case KeyPageUp:
+		p.scroll(-p.pageHeight())
+	case KeyPageDown:
+		p.scroll(p.pageHeight())
+	case KeyHome:
+		p.top = 0
+	case KeyEnd:
+		p.scroll(len(p.lines))
+	}
+	return false
+}
+
+func (p *Pager) status() string {
+	if p.search {
+		return "/" + string(p.query)
+	}
+
+	last := min(p.top+p.pageHeight(), len(p.lines))
+	percent := 100
+	if len(p.lines) > 0 {
+		percent = last * 100 / len(p.lines)
+	}
+	s := fmt.Sprintf(" %d-%d/%d %d%%  ↑↓ PgUp PgDn Home End  / search  n next  q quit",
+		min(p.top+1, last), last, len(p.lines), percent)
+	if p.notFound {
+		s = fmt.Sprintf(" not found: %s", string(p.query))
+	}
+	return s
+}
+
+// draw writes the page and the status line.
+func (p *Pager) draw(t *Term) {
+	var b strings.Builder
+	for i := 0; i < p.pageHeight(); i++ {
+		fmt.Fprintf(&b, "\033[%d;1H\033[0m", i+1)
+		if p.top+i >= len(p.lines) {
+			b.WriteString("\033[K")
+			continue
+		}
+
+		pen := defaultPen
+		line := p.lines[p.top+i]
+		for _, c := range line[:min(len(line), p.width)] {
+			if !sameStyle(c, pen) {
+				b.WriteString(sgrSequence(c))
+				pen = c
+			}
+			b.WriteRune(c.Rune)
+		}
+		b.WriteString("\033[0m\033[K")
+	}
+
+	status := []rune(p.status())
+	if len(status) > p.width {
+		status = status[:p.width]
+	}
+	fmt.Fprintf(&b, "\033[%d;1H\033[0;7m%s\033[K\033[0m", p.height, string(status))
+	if p.search {
+		fmt.Fprintf(&b, "\033[%d;%dH", p.height, len(status)+1)
+	}
+	t.writeString(b.String())
+}
+
+// isArt reports whether a file is ANSI art in CP437.
+func isArt(name string, b []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ans", ".asc", ".nfo", ".diz":
+		return true
+	}
+	return !utf8.Valid(b)
+}
+
+// DecodeCP437 converts CP437 text to UTF-8, the text ends at the
+// end of file character used before the SAUCE record.
+func DecodeCP437(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == 0x1a {
+			break
+		}
+		sb.WriteRune(CP437_TO_UTF8[c])
+	}
+	return sb.String()
+}
+
+// Page shows the text in the pager and blocks until the user quits,
+// see ShowPage.
+func (t *Term) Page(text string) {
+	done := make(chan struct{})
+	t.ShowPage(text, func() { close(done) })
+	<-done
+}
+
+// PageFile shows a file in the pager and blocks until the user quits,
+// see ShowPageFile.
+func (t *Term) PageFile(name string) error {
+	done := make(chan struct{})
+	if err := t.ShowPageFile(name, func() { close(done) }); err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// ShowPage shows the text in the pager, done is called when the user
+// quits and the screen is restored. A text that is not UTF-8 is taken
+// as CP437 ANSI art.
+func (t *Term) ShowPage(text string, done func()) {
+	w, h := t.GetSize()
+	if !utf8.ValidString(text) {
+		t.page(NewArtPager(ParseANSI([]byte(text)), w, h), done)
+		return
+	}
+	t.page(NewPager(text, w, h), done)
+}
+
+// ShowPageFile shows a file in the pager as ShowPage, CP437 ANSI art
+// is converted and shown in the width of its SAUCE record.
+func (t *Term) ShowPageFile(name string, done func()) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	w, h := t.GetSize()
+	if isArt(name, b) {
+		t.page(NewArtPager(ParseANSI(b), w, h), done)
+		return nil
+	}
+	t.page(NewPager(string(b), w, h), done)
+	return nil
+}
+
+func (t *Term) page(p *Pager, done func()) {
+	saved := t.Screen()
+	p.quit = func() {
+		t.Restore(saved)
+		if done != nil {
+			done()
+		}
+	}
+
+	t.outMutex.Lock()
+	t.pager = p
+	t.updateLocked(func() {
+		t.writeString("\033[?25l")
+		p.draw(t)
+	})
+	t.outMutex.Unlock()
+}
@@ -0,0 +1,136 @@
+package term
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedPager decodes the input and sends the events to the pager.
+func feedPager(p *Pager, s string) (done bool) {
+	var d Decoder
+	for _, ev := range append(d.Feed(s), d.Flush()...) {
+		if p.event(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+func numberedText(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func TestPager_Render(t *testing.T) {
+	// the color set in the first line is kept in the next ones
+	p := NewPager("\033[31mred\nstill red\033[0m\nplain", 40, 10)
+
+	if len(p.lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(p.lines))
+	}
+	if p.lines[1][0].Fg != 1 || p.lines[1][0].Rune != 's' {
+		t.Fatalf("Unexpected cell %+v", p.lines[1][0])
+	}
+	if p.lines[2][0].Fg != ColorDefault {
+		t.Fatalf("Unexpected cell %+v", p.lines[2][0])
+	}
+
+	// long lines wrap
+	p = NewPager(strings.Repeat("x", 50), 40, 10)
+	if len(p.lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(p.lines))
+	}
+}
+
+func TestPager_Keys(t *testing.T) {
+	p := NewPager(numberedText(100), 40, 10)
+
+	feedPager(p, " ")
+	if p.top != 9 {
+		t.Fatalf("Expected top 9, got %d", p.top)
+	}
+
+	feedPager(p, "\x1b[A\x1b[A")
+	if p.top != 7 {
+		t.Fatalf("Expected top 7, got %d", p.top)
+	}
+
+	// the last page is full
+	feedPager(p, "\x1b[F")
+	if p.top != 91 {
+		t.Fatalf("Expected top 91, got %d", p.top)
+	}
+
+	feedPager(p, "\x1b[H/line 5\r")
+	if p.top != 4 {
+		t.Fatalf("Expected top 4, got %d", p.top)
+	}
+
+	// the next match of "line 5" is line 50
+	feedPager(p, "n")
+	if p.top != 49 {
+		t.Fatalf("Expected top 49, got %d", p.top)
+	}
+
+	feedPager(p, "/nothing\r")
+	if !p.notFound || !strings.Contains(p.status(), "not found") {
+		t.Fatalf("Expected not found, got %q", p.status())
+	}
+
+	if !feedPager(p, "q") {
+		t.Fatal("Expected the pager done")
+	}
+}
+
+func TestDecodeCP437(t *testing.T) {
+	s := DecodeCP437([]byte{0xdb, 'a', '\r', '\n', 0x1a, 'S', 'A', 'U', 'C', 'E'})
+	if s != "█a\r\n" {
+		t.Fatalf("Unexpected text %q", s)
+	}
+}
+
+func TestTerm_Page(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 40, Height: 10}
+	term.WriteString("before")
+
+	done := make(chan struct{})
+	go func() {
+		term.Page(numberedText(30))
+		close(done)
+	}()
+
+	for {
+		term.outMutex.Lock()
+		p := term.pager
+		term.outMutex.Unlock()
+		if p != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	term.Input(" ")
+	s := term.Screen()
+	if s.Line(1) != "line 10" || !strings.Contains(s.Line(10), "10-18/30") {
+		t.Fatalf("Unexpected screen %q %q", s.Line(1), s.Line(10))
+	}
+
+	term.Input("q")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the pager closed")
+	}
+
+	s = term.Screen()
+	if s.Line(1) != "before" || s.Line(10) != "" {
+		t.Fatalf("Expected the screen restored, got %q", s.Line(1))
+	}
+}
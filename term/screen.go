@@ -0,0 +1,739 @@
+package term
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Attr is a set of text attributes.
+type Attr uint8
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+)
+
+// Cell is a character of the screen with its colors and attributes.
+type Cell struct {
+	Rune rune
+	Fg   Color
+	Bg   Color
+	Attr Attr
+}
+
+var defaultPen = Cell{Rune: ' ', Fg: ColorDefault, Bg: ColorDefault}
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+// Screen is the in-memory copy of the terminal screen, it interprets
+// the text and escape sequences written to the terminal to know the
+// content of each cell. Sequences that do not change cells, like the
+// title or inline images, are ignored.
+type Screen struct {
+	Width  int
+	Height int
+
+	cells     []Cell
+	altCells  []Cell
+	altScreen bool
+
+	row, col    int
+	wrapPending bool
+	pen         Cell
+	hidden      bool // cursor visibility
+	top, bottom int  // scroll region
+	savedRow    int
+	savedCol    int
+	savedPen    Cell
+
+	state  int
+	params []byte
+
+	// what the terminal shows, used by the diff when the writes are buffered
+	synced      bool
+	full        bool
+	shown       []Cell
+	shownTop    int
+	shownBottom int
+	shownHidden bool
+	shownAlt    bool
+	touched     bool
+}
+
+// NewScreen returns a blank screen of width x height.
+func NewScreen(width, height int) *Screen {
+	s := &Screen{pen: defaultPen}
+	s.Resize(width, height)
+	s.synced, s.full = true, false
+	return s
+}
+
+func blank(n int, pen Cell) []Cell {
+	c := make([]Cell, n)
+	fill(c, pen)
+	return c
+}
+
+func fill(c []Cell, pen Cell) {
+	b := Cell{Rune: ' ', Fg: pen.Fg, Bg: pen.Bg}
+	for i := range c {
+		c[i] = b
+	}
+}
+
+// Resize changes the size of the screen keeping the content at the top
+// left, the next diff redraws the whole screen.
+func (s *Screen) Resize(width, height int) {
+	if width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	resize := func(old []Cell) []Cell {
+		c := blank(width*height, defaultPen)
+		for r := 0; r < height && r < s.Height; r++ {
+			for col := 0; col < width && col < s.Width; col++ {
+				c[r*width+col] = old[r*s.Width+col]
+			}
+		}
+		return c
+	}
+
+	s.cells = resize(s.cells)
+	if s.altCells != nil {
+		s.altCells = resize(s.altCells)
+	}
+
+	s.Width, s.Height = width, height
+	s.top, s.bottom = 0, height-1
+	s.row = min(s.row, height-1)
+	s.col = min(s.col, width-1)
+	s.wrapPending = false
+	s.synced = false
+	s.full = true
+}
+
+// Cell returns the cell at row and col, starting at 1.
+func (s *Screen) Cell(row, col int) Cell {
+	if row < 1 || col < 1 || row > s.Height || col > s.Width {
+		return defaultPen
+	}
+	return s.cells[(row-1)*s.Width+col-1]
+}
+
+// Cursor returns the position of the cursor, starting at 1.
+func (s *Screen) Cursor() (row, col int) {
+	return s.row + 1, s.col + 1
+}
+
+// Line returns the text of a row, starting at 1, without the trailing spaces.
+func (s *Screen) Line(row int) string {
+	if row < 1 || row > s.Height {
+		return ""
+	}
+	r := make([]rune, s.Width)
+	for i, c := range s.cells[(row-1)*s.Width : row*s.Width] {
+		r[i] = c.Rune
+	}
+	return strings.TrimRight(string(r), " ")
+}
+
+// Write interprets the text written to the terminal.
+func (s *Screen) Write(text string) {
+	s.touched = true
+	for _, r := range text {
+		s.writeRune(r)
+	}
+}
+
+// buffer keeps a copy of what the terminal shows before the first
+// buffered write, the changes are sent later by Diff.
+func (s *Screen) buffer() {
+	if !s.synced {
+		return
+	}
+	s.shown = append(s.shown[:0], s.cells...)
+	s.shownTop, s.shownBottom = s.top, s.bottom
+	s.shownHidden = s.hidden
+	s.shownAlt = s.altScreen
+	s.synced = false
+}
+
+func (s *Screen) writeRune(r rune) {
+	switch s.state {
+	case stateEscape:
+		s.escape(r)
+		return
+	case stateCharset:
+		s.state = stateGround
+		return
+	case stateCSI:
+		if r >= 0x40 && r <= 0x7e {
+			s.state = stateGround
+			s.csi(r)
+			return
+		}
+		if len(s.params) < 64 {
+			s.params = append(s.params, byte(r))
+		}
+		return
+	case stateString:
+		switch r {
+		case '\a':
+			s.state = stateGround
+		case '\x1b':
+			s.state = stateStringEscape
+		}
+		return
+	case stateStringEscape:
+		// ESC \ ends the string
+		s.state = stateString
+		if r == '\\' {
+			s.state = stateGround
+		}
+		return
+	}
+
+	switch r {
+	case '\x1b':
+		s.state = stateEscape
+	case '\r':
+		s.col = 0
+		s.wrapPending = false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\b':
+		if s.col > 0 {
+			s.col--
+		}
+		s.wrapPending = false
+	case '\t':
+		s.col = min((s.col/8+1)*8, s.Width-1)
+	default:
+		if r < ' ' || r == '\x7f' {
+			return
+		}
+		s.put(r)
+	}
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrapPending {
+		s.col = 0
+		s.lineFeed()
+	}
+
+	c := s.pen
+	c.Rune = r
+	s.cells[s.row*s.Width+s.col] = c
+
+	if s.col == s.Width-1 {
+		s.wrapPending = true
+		return
+	}
+	s.col++
+}
+
+func (s *Screen) lineFeed() {
+	s.wrapPending = false
+	if s.row == s.bottom {
+		s.scrollUp(1)
+		return
+	}
+	if s.row < s.Height-1 {
+		s.row++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	s.wrapPending = false
+	if s.row == s.top {
+		s.scrollDown(1)
+		return
+	}
+	if s.row > 0 {
+		s.row--
+	}
+}
+
+// scrollUp moves the lines of the scroll region up, the new lines at
+// the bottom are blank.
+func (s *Screen) scrollUp(n int) {
+	s.scrollLines(s.top, n)
+}
+
+func (s *Screen) scrollDown(n int) {
+	s.scrollLines(s.top, -n)
+}
+
+// scrollLines scrolls the lines from row to the bottom of the scroll
+// region, up when n is positive and down when negative.
+func (s *Screen) scrollLines(row, n int) {
+	if row < s.top || row > s.bottom {
+		return
+	}
+	w := s.Width
+	lines := s.bottom - row + 1
+	region := s.cells[row*w : (s.bottom+1)*w]
+
+	if n > 0 {
+		n = min(n, lines)
+		copy(region, region[n*w:])
+		fill(region[(lines-n)*w:], s.pen)
+		return
+	}
+
+	n = min(-n, lines)
+	copy(region[n*w:], region[:(lines-n)*w])
+	fill(region[:n*w], s.pen)
+}
+
+func (s *Screen) escape(r rune) {
+	s.state = stateGround
+	switch r {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+	case ']', 'P', '_', '^', 'X':
+		// OSC, DCS, APC, PM and SOS strings
+		s.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		s.state = stateCharset
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	}
+}
+
+func (s *Screen) saveCursor() {
+	s.savedRow, s.savedCol, s.savedPen = s.row, s.col, s.pen
+}
+
+func (s *Screen) restoreCursor() {
+	s.row, s.col, s.pen = s.savedRow, s.savedCol, s.savedPen
+	s.row = min(s.row, s.Height-1)
+	s.col = min(s.col, s.Width-1)
+	s.wrapPending = false
+}
+
+func (s *Screen) reset() {
+	s.pen = defaultPen
+	fill(s.cells, s.pen)
+	s.row, s.col = 0, 0
+	s.top, s.bottom = 0, s.Height-1
+	s.hidden = false
+	s.altScreen = false
+	s.wrapPending = false
+}
+
+func (s *Screen) csi(final rune) {
+	params := string(s.params)
+	private := strings.HasPrefix(params, "?")
+	if private {
+		params = params[1:]
+	} else if params != "" && (params[0] < '0' || params[0] > ';') {
+		// other private markers are not used
+		return
+	}
+
+	p := splitParams(params)
+	arg := func(i, def int) int {
+		if i < len(p) && p[i] > 0 {
+			return p[i]
+		}
+		return def
+	}
+
+	if private {
+		if final == 'h' || final == 'l' {
+			for _, m := range p {
+				s.mode(m, final == 'h')
+			}
+		}
+		return
+	}
+
+	s.wrapPending = false
+	switch final {
+	case 'A':
+		s.row = max(s.row-arg(0, 1), 0)
+	case 'B', 'e':
+		s.row = min(s.row+arg(0, 1), s.Height-1)
+	case 'C', 'a':
+		s.col = min(s.col+arg(0, 1), s.Width-1)
+	case 'D':
+		s.col = max(s.col-arg(0, 1), 0)
+	case 'E':
+		s.row = min(s.row+arg(0, 1), s.Height-1)
+		s.col = 0
+	case 'F':
+		s.row = max(s.row-arg(0, 1), 0)
+		s.col = 0
+	case 'G', '`':
+		s.col = min(arg(0, 1), s.Width) - 1
+	case 'd':
+		s.row = min(arg(0, 1), s.Height) - 1
+	case 'H', 'f':
+		s.row = min(arg(0, 1), s.Height) - 1
+		s.col = min(arg(1, 1), s.Width) - 1
+	case 'J':
+		s.eraseDisplay(arg(0, 0))
+	case 'K':
+		s.eraseLine(arg(0, 0))
+	case 'X':
+		n := min(arg(0, 1), s.Width-s.col)
+		i := s.row*s.Width + s.col
+		fill(s.cells[i:i+n], s.pen)
+	case 'P':
+		n := min(arg(0, 1), s.Width-s.col)
+		line := s.cells[s.row*s.Width+s.col : (s.row+1)*s.Width]
+		copy(line, line[n:])
+		fill(line[len(line)-n:], s.pen)
+	case '@':
+		n := min(arg(0, 1), s.Width-s.col)
+		line := s.cells[s.row*s.Width+s.col : (s.row+1)*s.Width]
+		copy(line[n:], line)
+		fill(line[:n], s.pen)
+	case 'L':
+		s.scrollLines(s.row, -arg(0, 1))
+	case 'M':
+		s.scrollLines(s.row, arg(0, 1))
+	case 'S':
+		s.scrollUp(arg(0, 1))
+	case 'T':
+		s.scrollDown(arg(0, 1))
+	case 'm':
+		s.sgr(p)
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.Height)-1
+		if top < bottom && bottom < s.Height {
+			s.top, s.bottom = top, bottom
+			s.row, s.col = 0, 0
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+func (s *Screen) mode(m int, set bool) {
+	switch m {
+	case 25:
+		s.hidden = !set
+	case 47, 1047, 1049:
+		if set == s.altScreen {
+			return
+		}
+		if set && m == 1049 {
+			s.saveCursor()
+		}
+		if s.altCells == nil {
+			s.altCells = blank(len(s.cells), defaultPen)
+		}
+		s.cells, s.altCells = s.altCells, s.cells
+		s.altScreen = set
+		if set {
+			fill(s.cells, defaultPen)
+		}
+		if !set && m == 1049 {
+			s.restoreCursor()
+		}
+	}
+}
+
+func (s *Screen) eraseDisplay(n int) {
+	i := s.row*s.Width + s.col
+	switch n {
+	case 0:
+		fill(s.cells[i:], s.pen)
+	case 1:
+		fill(s.cells[:i+1], s.pen)
+	case 2, 3:
+		fill(s.cells, s.pen)
+	}
+}
+
+func (s *Screen) eraseLine(n int) {
+	start := s.row * s.Width
+	i := start + s.col
+	switch n {
+	case 0:
+		fill(s.cells[i:start+s.Width], s.pen)
+	case 1:
+		fill(s.cells[start:i+1], s.pen)
+	case 2:
+		fill(s.cells[start:start+s.Width], s.pen)
+	}
+}
+
+func (s *Screen) sgr(p []int) {
+	if len(p) == 0 {
+		p = []int{0}
+	}
+
+	for i := 0; i < len(p); i++ {
+		switch v := p[i]; {
+		case v == 0:
+			s.pen = defaultPen
+		case v == 1:
+			s.pen.Attr |= AttrBold
+		case v == 2:
+			s.pen.Attr |= AttrDim
+		case v == 3:
+			s.pen.Attr |= AttrItalic
+		case v == 4:
+			s.pen.Attr |= AttrUnderline
+		case v == 5 || v == 6:
+			s.pen.Attr |= AttrBlink
+		case v == 7:
+			s.pen.Attr |= AttrReverse
+		case v == 8:
+			s.pen.Attr |= AttrHidden
+		case v == 22:
+			s.pen.Attr &^= AttrBold | AttrDim
+		case v == 23:
+			s.pen.Attr &^= AttrItalic
+		case v == 24:
+			s.pen.Attr &^= AttrUnderline
+		case v == 25:
+			s.pen.Attr &^= AttrBlink
+		case v == 27:
+			s.pen.Attr &^= AttrReverse
+		case v == 28:
+			s.pen.Attr &^= AttrHidden
+		case v >= 30 && v <= 37:
+			s.pen.Fg = Color(v - 30)
+		case v == 39:
+			s.pen.Fg = ColorDefault
+		case v >= 40 && v <= 47:
+			s.pen.Bg = Color(v - 40)
+		case v == 49:
+			s.pen.Bg = ColorDefault
+		case v >= 90 && v <= 97:
+			s.pen.Fg = Color(v - 90 + 8)
+		case v >= 100 && v <= 107:
+			s.pen.Bg = Color(v - 100 + 8)
+		case v == 38 || v == 48:
+			c, n := extendedColor(p[i+1:])
+			i += n
+			if v == 38 {
+				s.pen.Fg = c
+			} else {
+				s.pen.Bg = c
+			}
+		}
+	}
+}
+
+// extendedColor parses the 5;n and 2;r;g;b forms, it returns the color
+// and the number of parameters used.
+func extendedColor(p []int) (Color, int) {
+	if len(p) >= 2 && p[0] == 5 {
+		return Color(p[1] & 0xff), 2
+	}
+	if len(p) >= 4 && p[0] == 2 {
+		return RGB(uint8(p[1]), uint8(p[2]), uint8(p[3])), 4
+	}
+	return ColorDefault, len(p)
+}
+
+// sgrSequence returns the sequence that sets the colors and attributes of the cell.
+func sgrSequence(c Cell) string {
+	var b strings.Builder
+	b.WriteString("\033[0")
+
+	attrs := []struct {
+		a    Attr
+		code string
+	}{
+		{AttrBold, ";1"},
+		{AttrDim, ";2"},
+		{AttrItalic, ";3"},
+		{AttrUnderline, ";4"},
+		{AttrBlink, ";5"},
+		{AttrReverse, ";7"},
+		{AttrHidden, ";8"},
+	}
+	for _, a := range attrs {
+		if c.Attr&a.a != 0 {
+			b.WriteString(a.code)
+		}
+	}
+
+	if c.Fg != ColorDefault {
+		b.WriteString(";" + colorParams(c.Fg, 30))
+	}
+	if c.Bg != ColorDefault {
+		b.WriteString(";" + colorParams(c.Bg, 40))
+	}
+	b.WriteByte('m')
+	return b.String()
+}
+
+// sameStyle reports whether two cells have the same colors and attributes.
+func sameStyle(a, b Cell) bool {
+	return a.Fg == b.Fg && a.Bg == b.Bg && a.Attr == b.Attr
+}
+
+// Diff returns the sequences that update the terminal with the changes
+// made since the last diff and marks the screen as shown.
+func (s *Screen) Diff() string {
+	if s.synced {
+		return ""
+	}
+	if s.altScreen != s.shownAlt {
+		mode := "\033[?1049l"
+		if s.altScreen {
+			mode = "\033[?1049h"
+		}
+		return mode + s.Repaint()
+	}
+	if s.full || len(s.shown) != len(s.cells) {
+		return s.Repaint()
+	}
+
+	var b strings.Builder
+	if s.shownTop != s.top || s.shownBottom != s.bottom {
+		// changing the scroll region moves the cursor, the cursor is set below
+		b.WriteString("\033[" + strconv.Itoa(s.top+1) + ";" + strconv.Itoa(s.bottom+1) + "r")
+	}
+
+	pen := Cell{Fg: -2} // unknown
+	row, col := -1, -1
+	for i, c := range s.cells {
+		if c == s.shown[i] {
+			continue
+		}
+		r, cl := i/s.Width, i%s.Width
+		if r != row || cl != col {
+			b.WriteString("\033[" + strconv.Itoa(r+1) + ";" + strconv.Itoa(cl+1) + "H")
+		}
+		if !sameStyle(c, pen) {
+			b.WriteString(sgrSequence(c))
+			pen = c
+		}
+		b.WriteRune(c.Rune)
+		row, col = r, cl+1
+		if col == s.Width {
+			// the cursor stays at the last column, move it explicitly
+			row = -1
+		}
+	}
+
+	s.writeState(&b)
+	s.markShown()
+	return b.String()
+}
+
+// Repaint returns the sequences that draw the whole screen and marks
+// the screen as shown.
+func (s *Screen) Repaint() string {
+	var b strings.Builder
+	b.WriteString("\033[0m\033[r\033[2J")
+
+	pen := defaultPen
+	for r := 0; r < s.Height; r++ {
+		line := s.cells[r*s.Width : (r+1)*s.Width]
+
+		// the screen is clear, trailing blanks are skipped
+		end := len(line)
+		for end > 0 && line[end-1].Rune == ' ' && sameStyle(line[end-1], defaultPen) {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+
+		b.WriteString("\033[" + strconv.Itoa(r+1) + ";1H")
+		for _, c := range line[:end] {
+			if !sameStyle(c, pen) {
+				b.WriteString(sgrSequence(c))
+				pen = c
+			}
+			b.WriteRune(c.Rune)
+		}
+	}
+
+	if s.top != 0 || s.bottom != s.Height-1 {
+		b.WriteString("\033[" + strconv.Itoa(s.top+1) + ";" + strconv.Itoa(s.bottom+1) + "r")
+	}
+
+	// the reset lost the cursor saved by the application
+	b.WriteString("\033[" + strconv.Itoa(s.savedRow+1) + ";" + strconv.Itoa(s.savedCol+1) + "H")
+	b.WriteString(sgrSequence(s.savedPen) + "\0337")
+
+	s.shownHidden = !s.hidden // always send the cursor visibility
+	s.writeState(&b)
+	s.markShown()
+	return b.String()
+}
+
+// drawRow returns the sequences that draw the row as in the cells, then
+// move the cursor back. The row is marked as shown.
+func (s *Screen) drawRow(r int) string {
+	line := s.cells[r*s.Width : (r+1)*s.Width]
+	if !s.synced && len(s.shown) == len(s.cells) {
+		copy(s.shown[r*s.Width:], line)
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[" + strconv.Itoa(r+1) + ";1H")
+	pen := Cell{Fg: -2} // unknown
+	for _, c := range line {
+		if !sameStyle(c, pen) {
+			b.WriteString(sgrSequence(c))
+			pen = c
+		}
+		b.WriteRune(c.Rune)
+	}
+	b.WriteString(s.cursorSequence())
+	return b.String()
+}
+
+// cursorSequence returns the sequences that move the cursor to the
+// current position with the current pen.
+func (s *Screen) cursorSequence() string {
+	return "\033[" + strconv.Itoa(s.row+1) + ";" + strconv.Itoa(s.col+1) + "H" + sgrSequence(s.pen)
+}
+
+// writeState moves the cursor back to the current position with the
+// current pen after the cells were written.
+func (s *Screen) writeState(b *strings.Builder) {
+	b.WriteString(s.cursorSequence())
+	if s.hidden != s.shownHidden {
+		if s.hidden {
+			b.WriteString("\033[?25l")
+		} else {
+			b.WriteString("\033[?25h")
+		}
+	}
+}
+
+func (s *Screen) markShown() {
+	s.synced = true
+	s.full = false
+	s.shownAlt = s.altScreen
+	s.shown = s.shown[:0]
+}
@@ -0,0 +1,243 @@
+package term
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestScreen_Write(t *testing.T) {
+	s := NewScreen(10, 3)
+
+	s.Write("hello\r\nworld")
+	if s.Line(1) != "hello" || s.Line(2) != "world" {
+		t.Fatalf("Unexpected lines %q %q", s.Line(1), s.Line(2))
+	}
+
+	row, col := s.Cursor()
+	if row != 2 || col != 6 {
+		t.Fatalf("Unexpected cursor %d,%d", row, col)
+	}
+
+	// the last column wraps only when the next character is written
+	s.Write("\033[3;1H0123456789")
+	row, col = s.Cursor()
+	if row != 3 || col != 10 {
+		t.Fatalf("Unexpected cursor %d,%d", row, col)
+	}
+
+	s.Write("x")
+	if s.Line(1) != "world" || s.Line(2) != "0123456789" || s.Line(3) != "x" {
+		t.Fatalf("Unexpected scroll %q %q %q", s.Line(1), s.Line(2), s.Line(3))
+	}
+
+	s.Write("\033[2;3H\033[K")
+	if s.Line(2) != "01" {
+		t.Fatalf("Unexpected erase %q", s.Line(2))
+	}
+
+	s.Write("\033[2J\033[1;1H\033]0;title\a\033[?25lok")
+	if s.Line(1) != "ok" || !s.hidden {
+		t.Fatalf("Unexpected line %q", s.Line(1))
+	}
+}
+
+func TestScreen_SGR(t *testing.T) {
+	s := NewScreen(10, 3)
+
+	s.Write("\033[1;31;44ma\033[0;38;5;200mb\033[48;2;1;2;3mc\033[0m ")
+
+	a := s.Cell(1, 1)
+	if a.Fg != 1 || a.Bg != 4 || a.Attr != AttrBold {
+		t.Fatalf("Unexpected cell %+v", a)
+	}
+
+	b := s.Cell(1, 2)
+	if b.Fg != 200 || b.Bg != ColorDefault || b.Attr != 0 {
+		t.Fatalf("Unexpected cell %+v", b)
+	}
+
+	c := s.Cell(1, 3)
+	if c.Bg != RGB(1, 2, 3) || c.Fg != 200 {
+		t.Fatalf("Unexpected cell %+v", c)
+	}
+
+	if s.Cell(1, 4) != defaultPen {
+		t.Fatalf("Unexpected cell %+v", s.Cell(1, 4))
+	}
+}
+
+func TestScreen_AltScreen(t *testing.T) {
+	s := NewScreen(10, 3)
+
+	s.Write("main")
+	s.Write("\033[?1049h\033[Halt")
+	if s.Line(1) != "alt" {
+		t.Fatalf("Unexpected line %q", s.Line(1))
+	}
+
+	s.Write("\033[?1049l")
+	if s.Line(1) != "main" {
+		t.Fatalf("Unexpected line %q", s.Line(1))
+	}
+
+	row, col := s.Cursor()
+	if row != 1 || col != 5 {
+		t.Fatalf("Unexpected cursor %d,%d", row, col)
+	}
+}
+
+// replay writes the sequences to a new screen of the same size.
+func replay(t *testing.T, s *Screen, out string) *Screen {
+	t.Helper()
+	r := NewScreen(s.Width, s.Height)
+	r.Write(out)
+	for row := 1; row <= s.Height; row++ {
+		for col := 1; col <= s.Width; col++ {
+			if r.Cell(row, col) != s.Cell(row, col) {
+				t.Fatalf("Cell %d,%d: expected %+v, got %+v", row, col, s.Cell(row, col), r.Cell(row, col))
+			}
+		}
+	}
+	return r
+}
+
+func TestScreen_Repaint(t *testing.T) {
+	s := NewScreen(20, 5)
+	s.Write("\033[2;3H\033[7mbox\033[0m\033[5;20Hz\033[3;1H\033[32m")
+
+	r := replay(t, s, s.Repaint())
+
+	row, col := r.Cursor()
+	if row != 3 || col != 1 || r.pen.Fg != 2 {
+		t.Fatalf("Unexpected cursor %d,%d %+v", row, col, r.pen)
+	}
+}
+
+func TestTerm_Flush(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 20, Height: 5}
+
+	term.WriteString("hello\r\nworld")
+	if out.String() != "hello\r\nworld" {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+	shown := NewScreen(20, 5)
+	shown.Write(out.String())
+
+	term.SetBuffered(true)
+	out.Reset()
+
+	term.Print(1, 1, "hello")
+	term.Print(2, 1, "there")
+	if out.Len() != 0 {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+
+	err := term.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the changed cells are sent
+	if strings.Contains(out.String(), "hello") || !strings.Contains(out.String(), "th") {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+
+	shown.Write(out.String())
+	if shown.Line(1) != "hello" || shown.Line(2) != "there" {
+		t.Fatalf("Unexpected screen %q %q", shown.Line(1), shown.Line(2))
+	}
+
+	out.Reset()
+	term.Flush()
+	if out.Len() != 0 {
+		t.Fatalf("Unexpected output %q", out.String())
+	}
+
+	// a new size draws the whole screen
+	term.SetBuffered(false)
+	term.SetSize(30, 6)
+	shown = NewScreen(30, 6)
+	shown.Write(out.String())
+	if shown.Line(1) != "hello" || shown.Line(2) != "there" {
+		t.Fatalf("Unexpected screen %q %q", shown.Line(1), shown.Line(2))
+	}
+}
+
+func TestTerm_SetSizeLimits(t *testing.T) {
+	term := &Term{C: io.Discard}
+	term.Screen()
+
+	term.SetSize(65535, 65535)
+	if w, h := term.GetSize(); w != MaxWidth || h != MaxHeight {
+		t.Fatalf("Expected %vx%v, got %vx%v", MaxWidth, MaxHeight, w, h)
+	}
+	if sc := term.Screen(); sc.Width != MaxWidth || sc.Height != MaxHeight {
+		t.Fatalf("Expected a %vx%v screen, got %vx%v", MaxWidth, MaxHeight, sc.Width, sc.Height)
+	}
+
+	term.SetSize(0, 10)
+	if w, h := term.GetSize(); w != 80 || h != 24 {
+		t.Fatalf("Expected 80x24, got %vx%v", w, h)
+	}
+}
+
+func TestTerm_Notify(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 20, Height: 5}
+
+	// a field on the last line
+	term.WriteString("\033[5;1Hname: ")
+	term.ReadField(true, func(string) {})
+	term.Input("bob")
+
+	term.Notify(" message from alice ")
+	shown := NewScreen(20, 5)
+	shown.Write(out.String())
+	if shown.Line(5) != " message from alice" {
+		t.Fatalf("Expected the message, got %q", shown.Line(5))
+	}
+
+	// the user keeps typing under the message
+	term.Input("by")
+	if sc := term.Screen(); sc.Line(5) != "name: bobby" {
+		t.Fatalf("Expected the field kept, got %q", sc.Line(5))
+	}
+
+	term.outMutex.Lock()
+	term.notice.Stop()
+	term.clearNotice()
+	term.outMutex.Unlock()
+
+	shown = NewScreen(20, 5)
+	shown.Write(out.String())
+	if shown.Line(5) != "name: bobby" {
+		t.Fatalf("Expected the field drawn again, got %q", shown.Line(5))
+	}
+	if string(term.InputField) != "bobby" {
+		t.Fatalf("Unexpected field %q", string(term.InputField))
+	}
+}
+
+func TestTerm_NotifyControl(t *testing.T) {
+	var out bytes.Buffer
+	term := &Term{C: &out, Width: 40, Height: 5}
+
+	// the message can not move the cursor, clear the screen or change
+	// the title of the terminal
+	term.Notify("a\033[2J\033]0;x\007b\x7f\u009b31mc\r\nd")
+	term.outMutex.Lock()
+	term.notice.Stop()
+	term.outMutex.Unlock()
+
+	if s := out.String(); strings.Contains(s, "\033[2J") || strings.ContainsAny(s, "\007\x7f\u009b\n") {
+		t.Fatalf("Expected the control characters removed, got %q", s)
+	}
+	shown := NewScreen(40, 5)
+	shown.Write(out.String())
+	if shown.Line(5) != "a[2J]0;xb31mc  d" {
+		t.Fatalf("Unexpected message %q", shown.Line(5))
+	}
+}
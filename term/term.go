@@ -1,14 +1,13 @@
 package term
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,9 +17,52 @@ const (
 	UTF8 OutputMode = iota
 	CP437
 	CP850
+	CP852
+	CP866
+	ISO8859_1
+	ISO8859_15
+	Amiga
+	PETSCII
 )
 
+var outputModeNames = map[OutputMode]string{
+	UTF8:       "UTF8",
+	CP437:      "CP437",
+	CP850:      "CP850",
+	CP852:      "CP852",
+	CP866:      "CP866",
+	ISO8859_1:  "ISO-8859-1",
+	ISO8859_15: "ISO-8859-15",
+	Amiga:      "AMIGA",
+	PETSCII:    "PETSCII",
+}
+
+func (m OutputMode) String() string {
+	if s, ok := outputModeNames[m]; ok {
+		return s
+	}
+	return "Unknown"
+}
+
+// ParseOutputMode returns the output mode of a name, the case, dashes
+// and underscores are ignored.
+func ParseOutputMode(name string) (OutputMode, bool) {
+	normalize := strings.NewReplacer("-", "", "_", "")
+	name = normalize.Replace(strings.ToUpper(name))
+	for m, s := range outputModeNames {
+		if normalize.Replace(s) == name {
+			return m, true
+		}
+	}
+	return UTF8, false
+}
+
 type Term struct {
+	mutex          sync.RWMutex
+	outMutex       sync.Mutex
+	inMutex        sync.Mutex
+	decoder        Decoder
+	pendingSince   time.Time
 	Width          int
 	Height         int
 	bufferPosition int
@@ -30,9 +72,19 @@ type Term struct {
 	echo           bool
 	replaceInput   bool
 	InputField     []rune
-	InputTrigger   chan struct{}
+	editor         *Editor
+	pager          *Pager
+	screen         *Screen
+	buffered       bool
+	fieldDone      func(string)
+	notice         *time.Timer
 	OutputMode     OutputMode
 	OutputDelay    time.Duration
+	throttle       *Throttle
+	TermType       string
+	ColorDepth     ColorDepth
+	caps           *Capabilities
+	replies        chan string
 }
 
 var (
@@ -88,104 +140,213 @@ func init() {
 	}
 }
 
-func removeLastRune(s []rune) []rune {
-	n := len(s) - 1
-
-	if n < 0 {
-		n = 0
-	}
-	return s[:n]
-}
-
 func (t *Term) Clear() error {
-	_, err := io.WriteString(t.C, "\033[2J\033[0;0H")
-	return err
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+	return t.writeString("\033[2J\033[0;0H")
 }
 
 func (t *Term) GetOutputDisplay() string {
-	switch t.OutputMode {
-	case CP437:
-		return "CP437"
-	case CP850:
-		return "CP850"
-	case UTF8:
-		return "UTF8"
-	}
-	return "Unknown"
+	return t.OutputMode.String()
 }
 
 func (t *Term) WriteString(s string) {
-	if t.OutputMode == CP437 {
-		for _, r := range s {
-			t.WriteByte(UTF8_TO_CP437[r])
-		}
-		return
-	}
+	t.outMutex.Lock()
+	t.writeString(s)
+	t.outMutex.Unlock()
+}
 
-	if t.OutputMode == CP850 {
-		for _, r := range s {
-			t.WriteByte(UTF8_TO_CP850[r])
-		}
-		return
+// writeString updates the screen and sends the text to the terminal,
+// unless the output is buffered.
+func (t *Term) writeString(s string) error {
+	sc := t.getScreen()
+	if t.buffered {
+		sc.buffer()
+		sc.Write(s)
+		return nil
 	}
+	sc.Write(s)
+	return t.emitString(s)
+}
 
+// emitString sends the text to the terminal in the output mode, with
+// the output delay after each character.
+func (t *Term) emitString(s string) error {
 	if t.OutputDelay > 0 {
 		for _, r := range s {
-			t.C.Write([]byte(string(r)))
+			if err := t.emit(t.encode(string(r))); err != nil {
+				return err
+			}
 			time.Sleep(t.OutputDelay)
 		}
-		return
+		return nil
 	}
+	return t.emit(t.encode(s))
+}
 
-	_, err := io.WriteString(t.C, s)
-	if err != nil {
-		log.Println("term error writing string:", err) // TODO: add return error
+// encode converts the text to the output mode.
+func (t *Term) encode(s string) []byte {
+	cp := codePages[t.OutputMode]
+	if cp == nil {
+		return []byte(s)
 	}
+
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		b = cp.appendRune(b, r)
+	}
+	return b
 }
 
 func (t *Term) WriteByte(b byte) {
+	t.outMutex.Lock()
+	if b < 0x80 {
+		t.getScreen().Write(string(rune(b)))
+	}
+	t.emitByte(b)
+	t.outMutex.Unlock()
+}
 
+func (t *Term) emitByte(b byte) {
+	t.emit([]byte{b})
 	if t.OutputDelay > 0 {
-		t.C.Write([]byte{b})
 		time.Sleep(t.OutputDelay)
-		return
 	}
+}
 
-	_, err := t.C.Write([]byte{b})
+// emit writes the bytes to the terminal at the baud rate if set.
+func (t *Term) emit(b []byte) error {
+	var w io.Writer = t.C
+	if t.throttle != nil {
+		w = t.throttle
+	}
+	_, err := w.Write(b)
 	if err != nil {
-		log.Println("term error writing byte:", err)
+		log.Println("term error writing:", err)
 	}
+	return err
 }
 
 func (t *Term) WriteRune(r rune) {
-	if t.OutputMode == CP437 {
-		t.WriteByte(UTF8_TO_CP437[r])
-		return
+	t.outMutex.Lock()
+	t.writeString(string(r))
+	t.outMutex.Unlock()
+}
+
+// getScreen returns the screen, it is created on the first write.
+func (t *Term) getScreen() *Screen {
+	if t.screen == nil {
+		w, h := t.GetSize()
+		t.screen = NewScreen(w, h)
 	}
+	return t.screen
+}
 
-	if t.OutputMode == CP850 {
-		t.WriteByte(UTF8_TO_CP850[r])
-		return
+// Screen returns a copy of the cells, colors and cursor the terminal
+// shows after the last write.
+func (t *Term) Screen() Screen {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	sc := *t.getScreen()
+	sc.cells = append([]Cell(nil), sc.cells...)
+	sc.altCells = nil
+	sc.shown = nil
+	sc.params = nil
+	return sc
+}
+
+// SetBuffered turns on or off the buffered output, while on the writes
+// only change the screen and Flush sends the changed cells. Turning it
+// off flushes the screen.
+func (t *Term) SetBuffered(b bool) {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	t.buffered = b
+	if !b && t.screen != nil {
+		t.emitString(t.screen.Diff())
 	}
+}
 
-	if t.OutputDelay > 0 {
-		t.C.Write([]byte(string(r)))
-		time.Sleep(t.OutputDelay)
+// Flush sends to the terminal the cells changed since the last flush.
+func (t *Term) Flush() error {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	if t.screen == nil {
+		return nil
+	}
+	return t.emitString(t.screen.Diff())
+}
+
+// Update runs f with the output buffered, then sends the cells changed
+// by f. Drawing the whole of a component in f only sends the difference.
+func (t *Term) Update(f func()) {
+	t.outMutex.Lock()
+	buffered := t.buffered
+	t.buffered = true
+	t.outMutex.Unlock()
+
+	f()
+
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	t.buffered = buffered
+	if !buffered {
+		t.emitString(t.getScreen().Diff())
+	}
+}
+
+// updateLocked is Update for the functions that write with the output
+// already locked.
+func (t *Term) updateLocked(f func()) {
+	buffered := t.buffered
+	t.buffered = true
+	f()
+	t.buffered = buffered
+	if !buffered {
+		t.emitString(t.getScreen().Diff())
+	}
+}
+
+// Restore draws again the cells, cursor and colors of a screen returned
+// by Screen, a screen of another size is ignored.
+func (t *Term) Restore(s Screen) {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	sc := t.getScreen()
+	if sc.Width != s.Width || sc.Height != s.Height || sc.altScreen != s.altScreen {
 		return
 	}
 
-	_, err := t.C.Write([]byte(string(r)))
-	if err != nil {
-		log.Println("term error writing rune:", err)
+	sc.buffer()
+	copy(sc.cells, s.cells)
+	sc.row, sc.col, sc.pen = s.row, s.col, s.pen
+	sc.hidden = s.hidden
+	sc.wrapPending = false
+	if !t.buffered {
+		t.emitString(sc.Diff())
 	}
 }
 
+// Repaint draws the whole screen again.
+func (t *Term) Repaint() error {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	return t.emitString(t.getScreen().Repaint())
+}
+
 func (t *Term) SetEcho(b bool) {
 	t.echo = b
 }
 
 func (t *Term) Print(row, col int, s string) error {
-	c := t.Width + 1 - col
+	width, _ := t.GetSize()
+	c := width + 1 - col
 	l := len([]rune(s))
 
 	if c > l {
@@ -196,284 +357,332 @@ func (t *Term) Print(row, col int, s string) error {
 		return nil
 	}
 
-	w := t.C
 	s = string([]rune(s)[:c])
 
-	a := [][]byte{
-		[]byte("\033["),
-		[]byte(strconv.Itoa(row)),
-		{';'},
-		[]byte(strconv.Itoa(col)),
-		{'f'},
-		[]byte(s),
-	}
-
-	var err error
-	for i := 0; i < 6; i++ {
-		_, err = w.Write(a[i])
-		if err != nil {
-			return err
-		}
-	}
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
 
-	return nil
+	return t.writeString("\033[" + strconv.Itoa(row) + ";" + strconv.Itoa(col) + "f" + s)
 }
 
 // Input receives user input and interprets depending on the state of the engine.
 func (t *Term) Input(s string) {
-	for _, c := range s {
-		if t.captureInput {
-			switch c {
-			case '\x1b':
-				if len(s) >= 3 {
-					if s[1] == '[' {
-						switch s[2] {
-						case 'A': // up
-							// t.WriteString("\x1b[1A")
-							return
-						case 'B': // down
-							// t.WriteString("\x1b[1B")
-							return
-						case 'C': // right
-							t.bufferPosition++
-							if t.bufferPosition > len(t.InputField) {
-								t.bufferPosition = len(t.InputField)
-
-								return
-							}
-
-							t.WriteString("\x1b[1C")
-							return
-						case 'D': // left
-							t.bufferPosition--
-
-							if t.bufferPosition < 0 {
-								t.bufferPosition = 0
-
-								return
-							}
-
-							t.WriteString("\x1b[1D")
-							return
-
-						case 'H': // home
-							if t.bufferPosition == 0 {
-								return
-							}
-							t.WriteString("\033[" + strconv.Itoa(t.bufferPosition) + "D")
-							t.bufferPosition = 0
-							return
-						case 'F': // end
-							if t.bufferPosition == len(t.InputField) {
-								return
-							}
-							t.WriteString("\033[" + strconv.Itoa(len(t.InputField)-t.bufferPosition) + "C")
-							t.bufferPosition = len(t.InputField)
-							return
-
-						case '3': // delete
-							if s[3] == '~' {
-								if t.bufferPosition == len(t.InputField) {
-									return
-								}
-								if len(t.InputField) == 0 {
-									return
-								}
-								if t.bufferPosition < len(t.InputField) {
-									if t.bufferPosition == 0 {
-										t.InputField = t.InputField[1:]
-									} else {
-										t.InputField = append(t.InputField[:t.bufferPosition], t.InputField[t.bufferPosition+1:]...)
-									}
-									// save cursor position
-									t.WriteString("\033[s")
-									// print input field from bufferPosition
-									t.WriteString(string(t.InputField[t.bufferPosition:]))
-									// print spaces to clear the rest of the line
-									t.WriteString(" ")
-									// restore cursor position
-									t.WriteString("\033[u")
-
-									if t.bufferPosition == len(t.InputField) {
-										t.bufferPosition--
-									}
-								}
-								return
-							}
-						}
-					}
-				}
-				return
-			case '\uf746': // insert
-				t.replaceInput = !t.replaceInput
-				return
-			case '\u007f', '\b': // backspace
-				if len(t.InputField) == 0 {
-					return
-				}
-				if t.bufferPosition == 0 {
-					return
-				}
-				t.WriteString("\b \b")
-				// remove rune at bufferPosition
-				if t.bufferPosition == len(t.InputField) {
-					t.InputField = removeLastRune(t.InputField)
-				} else {
-					if t.bufferPosition == 1 {
-						t.InputField = t.InputField[1:]
-					} else {
-						t.InputField = append(t.InputField[:t.bufferPosition-1], t.InputField[t.bufferPosition:]...)
-					}
-				}
-				t.bufferPosition--
-				if t.bufferPosition < 0 {
-					t.bufferPosition = 0
-				}
-				// save cursor position
-				t.WriteString("\033[s")
-				// print input field from bufferPosition
-				t.WriteString(string(t.InputField[t.bufferPosition:]))
-				// print spaces to clear the rest of the line
-				t.WriteString(" ")
-				// restore cursor position
-				t.WriteString("\033[u")
-
-				return
-			case '\r':
-				t.captureInput = false
-				t.InputTrigger <- struct{}{}
-				t.bufferPosition = 0
-				return
-			case '\x01': // ctrl + a (home)
-				if t.bufferPosition == 0 {
-					return
-				}
-				t.WriteString("\033[" + strconv.Itoa(t.bufferPosition) + "D")
-				t.bufferPosition = 0
-				return
-			case '\x05': // ctrl + e (end)
-				if t.bufferPosition == len(t.InputField) {
-					return
-				}
-				t.WriteString("\033[" + strconv.Itoa(len(t.InputField)-t.bufferPosition) + "C")
-				t.bufferPosition = len(t.InputField)
-				return
+	for _, ev := range t.Decode(s) {
+		t.InputEvent(ev)
+	}
+}
+
+// Decode turns the raw input in events, a sequence split between reads
+// is kept until the rest arrives or FlushInput is called.
+func (t *Term) Decode(s string) []Event {
+	t.inMutex.Lock()
+	defer t.inMutex.Unlock()
+
+	if cp := codePages[t.OutputMode]; cp != nil {
+		s = cp.decode(s)
+	}
+
+	pending := t.decoder.Pending()
+	events := t.decoder.Feed(s)
+	if !pending || len(events) > 0 {
+		t.pendingSince = time.Now()
+	}
+	return t.takeReplies(events)
+}
 
+// takeReplies removes the replies of the terminal from the events and
+// sends them to the probe waiting for them.
+func (t *Term) takeReplies(events []Event) []Event {
+	n := 0
+	for _, ev := range events {
+		if ev.Type != EventReply {
+			events[n] = ev
+			n++
+			continue
+		}
+		if t.replies != nil {
+			select {
+			case t.replies <- ev.Text:
 			default:
-				if t.MaxInputLength > 0 && len(t.InputField) >= t.MaxInputLength {
-					return
-				}
-
-				if t.replaceInput {
-					if t.bufferPosition == len(t.InputField) {
-						t.InputField = append(t.InputField, c)
-						t.bufferPosition++
-
-						if t.echo {
-							t.WriteString(string(c))
-						}
-						continue
-					}
-
-					raux := t.InputField[t.bufferPosition+1:]
-					t.InputField = append(t.InputField[:t.bufferPosition], c)
-					t.InputField = append(t.InputField, raux...)
-					t.bufferPosition++
-				} else {
-
-					if t.bufferPosition == len(t.InputField) {
-						t.InputField = append(t.InputField, c)
-						t.bufferPosition++
-
-						if t.echo {
-							t.WriteString(string(c))
-						}
-						continue
-					}
-
-					var (
-						end   = make([]rune, len(t.InputField[t.bufferPosition:]))
-						start = make([]rune, len(t.InputField[:t.bufferPosition]))
-					)
-					copy(end, t.InputField[t.bufferPosition:])
-					copy(start, t.InputField)
-					start = append(start, c)
-					start = append(start, end...)
-					t.InputField = start
-
-					t.bufferPosition++
-
-					if t.echo {
-						// save cursor position
-						t.WriteString("\033[s")
-
-						// print input field from buffer position
-						t.WriteString(string(c))
-						t.WriteString(string(t.InputField[t.bufferPosition:]))
-
-						// restore cursor position
-						t.WriteString("\033[u")
-					}
-				}
 			}
 		}
+	}
+	return events[:n]
+}
 
-		if t.echo {
-			t.WriteString(string(c))
-		}
+// InputPending reports whether part of a sequence is waiting for more input.
+func (t *Term) InputPending() bool {
+	t.inMutex.Lock()
+	defer t.inMutex.Unlock()
+	return t.decoder.Pending()
+}
+
+// FlushInput returns the input pending for longer than EscapeTimeout
+// as it is, a lone escape becomes the escape key.
+func (t *Term) FlushInput() []Event {
+	t.inMutex.Lock()
+	defer t.inMutex.Unlock()
+
+	if time.Since(t.pendingSince) < EscapeTimeout {
+		return nil
 	}
+	return t.takeReplies(t.decoder.Flush())
 }
 
-func (t *Term) GetField() string {
+// InputEvent sends an event to the pager, the editor or to the input field.
+func (t *Term) InputEvent(ev Event) {
+	t.outMutex.Lock()
+	if p := t.pager; p != nil {
+		done := p.event(ev)
+		if done {
+			t.pager = nil
+		} else {
+			t.updateLocked(func() { p.draw(t) })
+		}
+		t.outMutex.Unlock()
 
-	// get input from user
+		if done && p.quit != nil {
+			p.quit()
+		}
+		return
+	}
+	if e := t.editor; e != nil {
+		done, saved := e.event(ev)
+		if done {
+			t.editor = nil
+		} else {
+			e.draw(t)
+		}
+		t.outMutex.Unlock()
 
-	t.echo = true
-	t.captureInput = true
-	t.InputField = []rune{}
+		if done && e.quit != nil {
+			e.quit(saved)
+		}
+		return
+	}
 
-	<-t.InputTrigger
+	var (
+		field string
+		done  func(string)
+	)
+	if t.input(ev) {
+		field = string(t.InputField)
+		done = t.fieldDone
+		t.InputField = []rune{}
+		t.fieldDone = nil
+		t.echo = false
+	}
+	t.outMutex.Unlock()
 
-	res := t.InputField
-	t.InputField = []rune{}
-	t.echo = false
-	return string(res)
+	if done != nil {
+		done(field)
+	}
 }
 
-func (t *Term) GetPassword() string {
-	t.echo = false
-	t.captureInput = true
-	t.InputField = []rune{}
+// input edits the input field, it returns true when the user submits the field.
+func (t *Term) input(ev Event) bool {
+	if !t.captureInput {
+		if t.echo && ev.Type == EventKey && ev.Key == KeyRune {
+			t.writeString(string(ev.Rune))
+		}
+		return false
+	}
 
-	<-t.InputTrigger
+	switch ev.Type {
+	case EventMouse:
+		return false
+	case EventPaste:
+		for _, c := range ev.Text {
+			if c < ' ' {
+				c = ' '
+			}
+			t.insertInput(c)
+		}
+		return false
+	}
 
-	res := t.InputField
-	t.InputField = []rune{}
-	return string(res)
+	if ev.Key == KeyRune && ev.Mod&ModCtrl != 0 {
+		switch ev.Rune {
+		case 'a': // ctrl + a (home)
+			ev.Key = KeyHome
+		case 'e': // ctrl + e (end)
+			ev.Key = KeyEnd
+		default:
+			return false
+		}
+	}
+
+	switch ev.Key {
+	case KeyRight:
+		if t.bufferPosition == len(t.InputField) {
+			return false
+		}
+		t.bufferPosition++
+		t.writeString("\x1b[1C")
+	case KeyLeft:
+		if t.bufferPosition == 0 {
+			return false
+		}
+		t.bufferPosition--
+		t.writeString("\x1b[1D")
+	case KeyHome:
+		if t.bufferPosition == 0 {
+			return false
+		}
+		t.writeString("\033[" + strconv.Itoa(t.bufferPosition) + "D")
+		t.bufferPosition = 0
+	case KeyEnd:
+		if t.bufferPosition == len(t.InputField) {
+			return false
+		}
+		t.writeString("\033[" + strconv.Itoa(len(t.InputField)-t.bufferPosition) + "C")
+		t.bufferPosition = len(t.InputField)
+	case KeyDelete:
+		if t.bufferPosition == len(t.InputField) {
+			return false
+		}
+		t.InputField = append(t.InputField[:t.bufferPosition], t.InputField[t.bufferPosition+1:]...)
+		t.redrawInput()
+	case KeyInsert:
+		t.replaceInput = !t.replaceInput
+	case KeyBackspace:
+		if t.bufferPosition == 0 {
+			return false
+		}
+		t.writeString("\b")
+		t.InputField = append(t.InputField[:t.bufferPosition-1], t.InputField[t.bufferPosition:]...)
+		t.bufferPosition--
+		t.redrawInput()
+	case KeyEnter:
+		t.captureInput = false
+		t.bufferPosition = 0
+		return true
+	case KeyRune:
+		if ev.Mod&ModAlt == 0 {
+			t.insertInput(ev.Rune)
+		}
+	}
+	return false
 }
 
-func (t *Term) WriteFromASCII(fileName string) int {
-	var b byte
-	f, err := os.Open(fileName)
-	if err != nil {
-		log.Fatal(err)
+// redrawInput prints the input field from the buffer position and
+// clears the character left after a removal.
+func (t *Term) redrawInput() {
+	if !t.echo {
+		return
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
+	// save cursor position
+	t.writeString("\033[s")
+	// print input field from bufferPosition
+	t.writeString(string(t.InputField[t.bufferPosition:]))
+	// print spaces to clear the rest of the line
+	t.writeString(" ")
+	// restore cursor position
+	t.writeString("\033[u")
+}
 
-	for {
-		b, err = r.ReadByte()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
+// insertInput adds a character to the input field at the buffer position.
+func (t *Term) insertInput(c rune) {
+	if t.MaxInputLength > 0 && len(t.InputField) >= t.MaxInputLength {
+		return
+	}
 
-			log.Fatal(err)
+	if t.replaceInput && t.bufferPosition < len(t.InputField) {
+		t.InputField[t.bufferPosition] = c
+		t.bufferPosition++
+		if t.echo {
+			t.writeString(string(c))
 		}
+		return
+	}
 
-		t.WriteString(string(CP437_TO_UTF8[b]))
+	if t.bufferPosition == len(t.InputField) {
+		t.InputField = append(t.InputField, c)
+		t.bufferPosition++
+
+		if t.echo {
+			t.writeString(string(c))
+		}
+		return
+	}
+
+	var (
+		end   = make([]rune, len(t.InputField[t.bufferPosition:]))
+		start = make([]rune, len(t.InputField[:t.bufferPosition]))
+	)
+	copy(end, t.InputField[t.bufferPosition:])
+	copy(start, t.InputField)
+	start = append(start, c)
+	start = append(start, end...)
+	t.InputField = start
+
+	t.bufferPosition++
+
+	if t.echo {
+		// save cursor position
+		t.writeString("\033[s")
+
+		// print input field from buffer position
+		t.writeString(string(c))
+		t.writeString(string(t.InputField[t.bufferPosition:]))
+
+		// restore cursor position
+		t.writeString("\033[u")
+
+		t.writeString(string(c))
 	}
-	return 0
+}
+
+// GetField reads a line in the input field and blocks until the user
+// presses enter, it returns an empty line if a field is already being
+// read.
+func (t *Term) GetField() string {
+	done := make(chan string, 1)
+	if t.ReadField(true, func(s string) { done <- s }) != nil {
+		return ""
+	}
+	return <-done
+}
+
+// GetPassword reads a line as GetField without showing it.
+func (t *Term) GetPassword() string {
+	done := make(chan string, 1)
+	if t.ReadField(false, func(s string) { done <- s }) != nil {
+		return ""
+	}
+	return <-done
+}
+
+// ErrFieldBusy is returned by ReadField while another field is being
+// read.
+var ErrFieldBusy = errors.New("a field is already being read")
+
+// ReadField starts reading a line in the input field, done is called
+// with the line when the user presses enter. The typed text is shown
+// when echo is true. Only one field is read at a time, it returns
+// ErrFieldBusy while another field is being read.
+func (t *Term) ReadField(echo bool, done func(string)) error {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	if t.fieldDone != nil {
+		return ErrFieldBusy
+	}
+	t.echo = echo
+	t.captureInput = true
+	t.InputField = []rune{}
+	t.fieldDone = done
+	return nil
+}
+
+// WriteFromASCII writes a CP437 ANSI art file, see LoadANSI.
+func (t *Term) WriteFromASCII(fileName string) error {
+	a, err := LoadANSI(fileName)
+	if err != nil {
+		return err
+	}
+	t.WriteANSI(a)
+	return nil
 }
 
 // ResetScreen reset terminal screen.
@@ -511,18 +720,11 @@ func (t *Term) Write(s string) int {
 
 func (t *Term) SetOutputMode(mode string) {
 	log.Println("Setting output mode to: " + mode)
-	mode = strings.ToUpper(mode)
-	switch mode {
-	case "UTF8", "UTF-8":
-		t.OutputMode = UTF8
-	case "CP437":
-		t.OutputMode = CP437
-	case "CP850":
-		t.OutputMode = CP850
-	default:
-		t.OutputMode = UTF8
+	m, ok := ParseOutputMode(mode)
+	if !ok {
 		log.Printf("invalid output mode: %s. Using UTF-8", mode)
 	}
+	t.OutputMode = m
 }
 
 func (t *Term) SetInputLimit(limit int) {
@@ -566,7 +768,113 @@ func (t *Term) DrawBox(row, col, width, height int) {
 	t.WriteRune(border[5])
 }
 
-// GetSize
+// notifyDuration is how long a message of Notify is shown.
+var notifyDuration = 5 * time.Second
+
+// Notify shows a message in the last line of the screen without
+// disturbing what the user is typing. The message is sent only to the
+// terminal, the screen keeps the line and draws it again when the
+// message times out. The control characters of the message are
+// removed, it comes from other users.
+func (t *Term) Notify(msg string) {
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	sc := t.getScreen()
+	r := []rune(printable(msg))
+	if len(r) > sc.Width {
+		r = r[:sc.Width]
+	}
+	t.emitString(fmt.Sprintf("\033[%d;1H\033[0m\033[2K\033[7m%s", sc.Height, string(r)) + sc.cursorSequence())
+
+	if t.notice != nil {
+		t.notice.Stop()
+	}
+	var notice *time.Timer
+	notice = time.AfterFunc(notifyDuration, func() {
+		t.outMutex.Lock()
+		defer t.outMutex.Unlock()
+		if t.notice == notice {
+			t.clearNotice()
+		}
+	})
+	t.notice = notice
+}
+
+// printable returns s without the C0, DEL and C1 control characters,
+// the tabs and line breaks become a space.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t', r == '\n', r == '\r':
+			return ' '
+		case r < 0x20, r >= 0x7f && r < 0xa0:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// clearNotice draws again the line under the message of Notify.
+func (t *Term) clearNotice() {
+	t.notice = nil
+	sc := t.getScreen()
+	t.emitString(sc.drawRow(sc.Height - 1))
+}
+
+// GetSize returns the terminal width and height.
 func (t *Term) GetSize() (int, int) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
 	return t.Width, t.Height
 }
+
+// MaxWidth and MaxHeight are the largest terminal size accepted from
+// the client, larger sizes are clamped.
+const (
+	MaxWidth  = 1000
+	MaxHeight = 500
+)
+
+// SetSize changes the terminal width and height, it is called when the
+// client sends a pty-req or window-change request. An unknown size is
+// taken as 80x24 and the size is limited to MaxWidth and MaxHeight. The
+// screen is drawn again in the new size if something was written to it.
+func (t *Term) SetSize(width, height int) {
+	if width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	width = min(width, MaxWidth)
+	height = min(height, MaxHeight)
+
+	t.mutex.Lock()
+	t.Width, t.Height = width, height
+	t.mutex.Unlock()
+
+	t.outMutex.Lock()
+	defer t.outMutex.Unlock()
+
+	if t.screen == nil {
+		return
+	}
+	t.screen.Resize(width, height)
+
+	// the layout of the editor and the pager changes with the size, they
+	// are drawn only on the screen and sent by the repaint
+	buffered := t.buffered
+	t.buffered = true
+	if t.editor != nil {
+		t.editor.resize(width, height)
+		t.writeString("\033[2J")
+		t.editor.draw(t)
+	}
+	if t.pager != nil {
+		t.pager.resize(width, height)
+		t.pager.draw(t)
+	}
+	t.buffered = buffered
+
+	if t.screen.touched {
+		t.emitString(t.screen.Repaint())
+	}
+}
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"strings"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+// maxDialogWidth limits the width of the message of a dialog.
+const maxDialogWidth = 60
+
+// Dialog is a box with a message and buttons, the arrows and tab move
+// between the buttons and the first letter of a button selects it.
+type Dialog struct {
+	Title    string
+	Message  string
+	Buttons  []string
+	Selected int
+	Canceled bool
+
+	term *term.Term
+}
+
+// NewConfirm returns a dialog with the yes and no buttons.
+func NewConfirm(t *term.Term, title, message string) *Dialog {
+	return &Dialog{
+		Title:   title,
+		Message: message,
+		Buttons: []string{"Yes", "No"},
+		term:    t,
+	}
+}
+
+// NewMessage returns a dialog with the ok button.
+func NewMessage(t *term.Term, title, message string) *Dialog {
+	return &Dialog{
+		Title:   title,
+		Message: message,
+		Buttons: []string{"OK"},
+		term:    t,
+	}
+}
+
+// buttons returns the line of buttons.
+func (d *Dialog) buttons() string {
+	b := make([]string, len(d.Buttons))
+	for i, s := range d.Buttons {
+		b[i] = "[ " + s + " ]"
+	}
+	return strings.Join(b, "  ")
+}
+
+func (d *Dialog) layout() (lines []string, row, col, width, height int) {
+	w, h := screenSize(d.term)
+
+	n := min(maxDialogWidth, w-4)
+	lines = wrap(d.Message, n)
+	lines = lines[:min(len(lines), max(h-6, 1))]
+
+	width = max(textWidth(d.Title)+6, textWidth(d.buttons())+4)
+	for _, l := range lines {
+		width = max(width, textWidth(l)+4)
+	}
+	width = max(min(width, w), minWidth)
+
+	// message, a blank line and the buttons
+	height = len(lines) + 4
+	row, col = place(d.term, 0, 0, width, height)
+	return lines, row, col, width, height
+}
+
+// Draw draws the dialog with the selected button highlighted.
+func (d *Dialog) Draw() {
+	lines, row, col, width, height := d.layout()
+
+	d.term.Update(func() {
+		frame(d.term, row, col, width, height, d.Title)
+		for i, l := range lines {
+			d.term.WriteString(moveTo(row+1+i, col+2) + l)
+		}
+
+		bcol := col + (width-textWidth(d.buttons()))/2
+		d.term.WriteString(moveTo(row+height-2, bcol))
+		for i, s := range d.Buttons {
+			if i > 0 {
+				d.term.WriteString("  ")
+			}
+			style := styleNormal
+			if i == d.Selected {
+				style = styleSelected
+			}
+			d.term.WriteString(style + "[ " + s + " ]" + styleNormal)
+		}
+		d.term.WriteString(moveTo(row+height-2, bcol))
+	})
+}
+
+// Input handles the keys of the dialog, it returns true when a button
+// is selected or the dialog is canceled with esc.
+func (d *Dialog) Input(ev term.Event) bool {
+	if ev.Type != term.EventKey {
+		return false
+	}
+
+	switch ev.Key {
+	case term.KeyLeft:
+		d.Selected = max(d.Selected-1, 0)
+	case term.KeyRight:
+		d.Selected = min(d.Selected+1, len(d.Buttons)-1)
+	case term.KeyTab:
+		d.Selected = (d.Selected + 1) % len(d.Buttons)
+	case term.KeyEnter:
+		return true
+	case term.KeyEscape:
+		d.Canceled = true
+		return true
+	case term.KeyRune:
+		if ev.Mod != 0 {
+			return false
+		}
+		for i, s := range d.Buttons {
+			if strings.HasPrefix(strings.ToLower(s), strings.ToLower(string(ev.Rune))) {
+				d.Selected = i
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+
+	d.Draw()
+	return false
+}
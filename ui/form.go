@@ -0,0 +1,251 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+var ErrRequired = errors.New("required field")
+
+// Field is a labeled input of a form.
+type Field struct {
+	Label     string
+	Value     string
+	Password  bool
+	Required  bool
+	MaxLength int
+	Validate  func(value string) error
+}
+
+// Form is a box with labeled fields, tab and the arrows move between the
+// fields and enter in the last field submits the form. The fields are
+// validated on submit, the first invalid field gets the focus and the
+// error is shown below the fields.
+type Form struct {
+	Title    string
+	Fields   []Field
+	Row, Col int // top left corner, 0 centers the box
+	Width    int // 0 fits the labels and a 30 columns input
+	Focus    int
+	Canceled bool
+	Err      string
+
+	term   *term.Term
+	values [][]rune
+	pos    int
+}
+
+// NewForm returns a form with the fields.
+func NewForm(t *term.Term, title string, fields []Field) *Form {
+	f := &Form{
+		Title:  title,
+		Fields: fields,
+		term:   t,
+	}
+	for _, fd := range fields {
+		f.values = append(f.values, []rune(fd.Value))
+	}
+	if len(f.values) > 0 {
+		f.pos = len(f.values[0])
+	}
+	return f
+}
+
+// Values returns the text of the fields.
+func (f *Form) Values() []string {
+	v := make([]string, len(f.values))
+	for i, r := range f.values {
+		v[i] = string(r)
+	}
+	return v
+}
+
+// SetError moves the focus to the field and shows the message.
+func (f *Form) SetError(field int, msg string) {
+	if field >= 0 && field < len(f.Fields) {
+		f.focus(field)
+	}
+	f.Err = msg
+}
+
+func (f *Form) focus(i int) {
+	f.Focus = i
+	f.pos = len(f.values[i])
+}
+
+func (f *Form) labelWidth() int {
+	n := 0
+	for _, fd := range f.Fields {
+		n = max(n, textWidth(fd.Label))
+	}
+	return n
+}
+
+func (f *Form) layout() (row, col, width, height int) {
+	w, _ := screenSize(f.term)
+
+	width = f.Width
+	if width <= 0 {
+		width = max(f.labelWidth()+36, textWidth(f.Title)+6)
+	}
+	width = max(min(width, w), minWidth)
+
+	// fields, a blank line and the error
+	height = len(f.Fields) + 4
+	row, col = place(f.term, f.Row, f.Col, width, height)
+	return row, col, width, height
+}
+
+// inputWidth is the number of columns of the inputs.
+func (f *Form) inputWidth(width int) int {
+	return max(width-f.labelWidth()-5, 1)
+}
+
+// Draw draws the form with the cursor in the focused field.
+func (f *Form) Draw() {
+	row, col, width, height := f.layout()
+	lw := f.labelWidth()
+	iw := f.inputWidth(width)
+
+	f.term.Update(func() {
+		frame(f.term, row, col, width, height, f.Title)
+
+		cursorRow, cursorCol := row+1, col+lw+3
+		for i, fd := range f.Fields {
+			value := f.values[i]
+			if fd.Password {
+				value = []rune(strings.Repeat("*", len(value)))
+			}
+
+			// long values scroll to keep the cursor visible
+			start := 0
+			if i == f.Focus && f.pos >= iw {
+				start = f.pos - iw + 1
+			}
+			text := string(value[min(start, len(value)):])
+
+			f.term.WriteString(moveTo(row+1+i, col+2) + styleNormal + fit(fd.Label, lw) + " " +
+				styleField + fit(text, iw) + styleNormal)
+
+			if i == f.Focus {
+				cursorRow, cursorCol = row+1+i, col+lw+3+f.pos-start
+			}
+		}
+
+		if f.Err != "" {
+			f.term.WriteString(moveTo(row+height-2, col+2) + styleError + truncate(f.Err, width-4) + styleNormal)
+		}
+		f.term.WriteString(moveTo(cursorRow, cursorCol))
+	})
+}
+
+// Input edits the focused field, it returns true when the form is
+// submitted with valid fields or canceled with esc.
+func (f *Form) Input(ev term.Event) bool {
+	if len(f.Fields) == 0 {
+		return true
+	}
+
+	switch ev.Type {
+	case term.EventMouse, term.EventReply:
+		return false
+	case term.EventPaste:
+		for _, r := range ev.Text {
+			if r >= ' ' {
+				f.insert(r)
+			}
+		}
+		f.Draw()
+		return false
+	}
+
+	value := f.values[f.Focus]
+	key := ev.Key
+	if key == term.KeyRune && ev.Mod&term.ModCtrl != 0 {
+		switch ev.Rune {
+		case 'a':
+			key = term.KeyHome
+		case 'e':
+			key = term.KeyEnd
+		default:
+			return false
+		}
+	}
+
+	switch {
+	case key == term.KeyEscape:
+		f.Canceled = true
+		return true
+	case key == term.KeyEnter && f.Focus == len(f.Fields)-1:
+		if f.validate() {
+			return true
+		}
+	case key == term.KeyEnter, key == term.KeyDown,
+		key == term.KeyTab && ev.Mod&term.ModShift == 0:
+		f.focus((f.Focus + 1) % len(f.Fields))
+	case key == term.KeyUp, key == term.KeyTab:
+		f.focus((f.Focus + len(f.Fields) - 1) % len(f.Fields))
+	case key == term.KeyLeft:
+		f.pos = max(f.pos-1, 0)
+	case key == term.KeyRight:
+		f.pos = min(f.pos+1, len(value))
+	case key == term.KeyHome:
+		f.pos = 0
+	case key == term.KeyEnd:
+		f.pos = len(value)
+	case key == term.KeyBackspace:
+		if f.pos == 0 {
+			return false
+		}
+		f.values[f.Focus] = append(value[:f.pos-1], value[f.pos:]...)
+		f.pos--
+	case key == term.KeyDelete:
+		if f.pos == len(value) {
+			return false
+		}
+		f.values[f.Focus] = append(value[:f.pos], value[f.pos+1:]...)
+	case key == term.KeyRune && ev.Mod&term.ModAlt == 0:
+		f.insert(ev.Rune)
+	default:
+		return false
+	}
+
+	f.Draw()
+	return false
+}
+
+func (f *Form) insert(r rune) {
+	value := f.values[f.Focus]
+	if limit := f.Fields[f.Focus].MaxLength; limit > 0 && len(value) >= limit {
+		return
+	}
+	n := make([]rune, 0, len(value)+1)
+	n = append(n, value[:f.pos]...)
+	n = append(n, r)
+	n = append(n, value[f.pos:]...)
+	f.values[f.Focus] = n
+	f.pos++
+}
+
+// validate checks the fields, it shows the first error and returns false
+// if a field is not valid.
+func (f *Form) validate() bool {
+	f.Err = ""
+	for i, fd := range f.Fields {
+		v := string(f.values[i])
+		if fd.Required && strings.TrimSpace(v) == "" {
+			f.SetError(i, fd.Label+": "+ErrRequired.Error())
+			return false
+		}
+		if fd.Validate == nil {
+			continue
+		}
+		if err := fd.Validate(v); err != nil {
+			f.SetError(i, fd.Label+": "+err.Error())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package ui
+
+import (
+	"strings"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+// MenuItem is an option of a menu, the key selects it directly.
+type MenuItem struct {
+	Key   string
+	Label string
+}
+
+// List is a box with items selected with the arrows, pages scroll when
+// the items do not fit. A menu is a list with hotkeys.
+type List struct {
+	Title    string
+	Items    []string
+	Keys     []string // hotkeys of the items, "" for none
+	Row, Col int      // top left corner, 0 centers the box
+	Width    int      // 0 fits the items
+	Height   int      // 0 fits the items
+	Selected int
+	Canceled bool
+
+	term *term.Term
+	top  int
+}
+
+// NewList returns a list of the items.
+func NewList(t *term.Term, title string, items []string) *List {
+	return &List{
+		Title: title,
+		Items: items,
+		term:  t,
+	}
+}
+
+// NewMenu returns a list of the items with their hotkeys.
+func NewMenu(t *term.Term, title string, items []MenuItem) *List {
+	l := NewList(t, title, nil)
+	for _, it := range items {
+		l.Items = append(l.Items, it.Label)
+		l.Keys = append(l.Keys, it.Key)
+	}
+	return l
+}
+
+func (l *List) key(i int) string {
+	if i < len(l.Keys) {
+		return l.Keys[i]
+	}
+	return ""
+}
+
+// keyWidth is the width of the hotkey column, 0 without hotkeys.
+func (l *List) keyWidth() int {
+	n := 0
+	for _, k := range l.Keys {
+		n = max(n, textWidth(k))
+	}
+	if n == 0 {
+		return 0
+	}
+	return n + 2
+}
+
+// layout returns the position and size of the box.
+func (l *List) layout() (row, col, width, height int) {
+	w, h := screenSize(l.term)
+
+	width = l.Width
+	if width <= 0 {
+		width = textWidth(l.Title) + 6
+		for _, it := range l.Items {
+			width = max(width, textWidth(it)+l.keyWidth()+4)
+		}
+	}
+	width = max(min(max(width, 10), w), minWidth)
+
+	height = l.Height
+	if height <= 0 {
+		height = len(l.Items) + 2
+	}
+	height = min(max(height, 3), h)
+
+	row, col = place(l.term, l.Row, l.Col, width, height)
+	return row, col, width, height
+}
+
+// visible returns the number of items shown.
+func (l *List) visible() int {
+	_, _, _, height := l.layout()
+	return height - 2
+}
+
+// Draw draws the list, only the cells changed since the last draw are sent.
+func (l *List) Draw() {
+	row, col, width, height := l.layout()
+	n := height - 2
+
+	if l.Selected < l.top {
+		l.top = l.Selected
+	}
+	if l.Selected >= l.top+n {
+		l.top = l.Selected - n + 1
+	}
+
+	l.term.Update(func() {
+		frame(l.term, row, col, width, height, l.Title)
+
+		kw := l.keyWidth()
+		for i := 0; i < n && l.top+i < len(l.Items); i++ {
+			item := l.top + i
+			style := styleNormal
+			if item == l.Selected {
+				style = styleSelected
+			}
+
+			var sb strings.Builder
+			sb.WriteString(moveTo(row+1+i, col+1))
+			if kw > 0 {
+				k := l.key(item)
+				if item != l.Selected {
+					sb.WriteString(styleHotkey)
+				} else {
+					sb.WriteString(style)
+				}
+				sb.WriteString(" " + fit(k, kw-1))
+			}
+			sb.WriteString(style)
+			sb.WriteString(" " + fit(l.Items[item], width-kw-3))
+			sb.WriteString(styleNormal)
+			l.term.WriteString(sb.String())
+		}
+
+		// scroll marks
+		if l.top > 0 {
+			l.term.WriteString(moveTo(row, col+width-2) + "↑")
+		}
+		if l.top+n < len(l.Items) {
+			l.term.WriteString(moveTo(row+height-1, col+width-2) + "↓")
+		}
+		l.term.WriteString(moveTo(row+1+l.Selected-l.top, col+1))
+	})
+}
+
+func (l *List) move(n int) {
+	l.Selected = min(max(l.Selected+n, 0), max(len(l.Items)-1, 0))
+}
+
+// Input handles the keys of the list, it returns true when an item is
+// selected or the list is canceled with esc.
+func (l *List) Input(ev term.Event) bool {
+	if len(l.Items) == 0 {
+		l.Canceled = true
+		return true
+	}
+
+	switch ev.Type {
+	case term.EventPaste, term.EventReply:
+		return false
+	case term.EventMouse:
+		return l.mouse(ev)
+	}
+
+	switch ev.Key {
+	case term.KeyUp:
+		l.move(-1)
+	case term.KeyDown:
+		l.move(1)
+	case term.KeyPageUp:
+		l.move(-l.visible())
+	case term.KeyPageDown:
+		l.move(l.visible())
+	case term.KeyHome:
+		l.Selected = 0
+	case term.KeyEnd:
+		l.Selected = len(l.Items) - 1
+	case term.KeyEnter:
+		return true
+	case term.KeyEscape:
+		l.Canceled = true
+		return true
+	default:
+		name := ev.String()
+		for i := range l.Items {
+			if k := l.key(i); k != "" && strings.EqualFold(k, name) {
+				l.Selected = i
+				return true
+			}
+		}
+		return false
+	}
+
+	l.Draw()
+	return false
+}
+
+// mouse selects the item clicked and scrolls with the wheel.
+func (l *List) mouse(ev term.Event) bool {
+	switch ev.Button {
+	case term.MouseWheelUp:
+		l.move(-1)
+	case term.MouseWheelDown:
+		l.move(1)
+	case term.MouseLeft:
+		row, col, width, height := l.layout()
+		if ev.Action != term.MousePress ||
+			ev.Y <= row || ev.Y >= row+height-1 || ev.X <= col || ev.X >= col+width-1 {
+			return false
+		}
+		item := l.top + ev.Y - row - 1
+		if item >= len(l.Items) {
+			return false
+		}
+		l.Selected = item
+		return true
+	default:
+		return false
+	}
+	l.Draw()
+	return false
+}
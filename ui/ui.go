@@ -0,0 +1,122 @@
+// Package ui has the widgets drawn over the terminal: menus, lists,
+// forms and dialogs. A widget is drawn once and then receives the
+// input of the user until it is done.
+package ui
+
+import (
+	"strconv"
+	"strings"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+const (
+	styleNormal   = "\033[0m"
+	styleSelected = "\033[0;7m"
+	styleTitle    = "\033[0;1m"
+	styleError    = "\033[0;1;31m"
+	styleHotkey   = "\033[0;1;33m"
+	styleField    = "\033[0;4m"
+)
+
+// minWidth is the width of the smallest box, the borders and the room
+// around the title. Narrower terminals cut the box.
+const minWidth = 6
+
+// Widget is a component of the screen that handles the input of the
+// user, Input returns true when the widget is done.
+type Widget interface {
+	Draw()
+	Input(ev term.Event) bool
+}
+
+// screenSize returns the size of the terminal, 80x24 when unknown.
+func screenSize(t *term.Term) (int, int) {
+	w, h := t.GetSize()
+	if w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// place returns the top left corner of a box, a zero row or col
+// centers the box in the screen.
+func place(t *term.Term, row, col, width, height int) (int, int) {
+	w, h := screenSize(t)
+	if row <= 0 {
+		row = max((h-height)/2+1, 1)
+	}
+	if col <= 0 {
+		col = max((w-width)/2+1, 1)
+	}
+	return row, col
+}
+
+// truncate cuts the text to n columns.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:max(n, 0)])
+	}
+	return s
+}
+
+// fit truncates or pads the text to n columns.
+func fit(s string, n int) string {
+	s = truncate(s, n)
+	return s + strings.Repeat(" ", max(n-textWidth(s), 0))
+}
+
+// textWidth returns the number of columns of the text.
+func textWidth(s string) int {
+	return len([]rune(s))
+}
+
+// wrap breaks the text in lines of up to n columns at the spaces, n is
+// at least 1.
+func wrap(s string, n int) []string {
+	n = max(n, 1)
+	var lines []string
+	for _, p := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, w := range strings.Fields(p) {
+			for textWidth(w) > n {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				r := []rune(w)
+				lines = append(lines, string(r[:n]))
+				w = string(r[n:])
+			}
+			switch {
+			case line == "":
+				line = w
+			case textWidth(line)+1+textWidth(w) <= n:
+				line += " " + w
+			default:
+				lines = append(lines, line)
+				line = w
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func moveTo(row, col int) string {
+	return "\033[" + strconv.Itoa(row) + ";" + strconv.Itoa(col) + "H"
+}
+
+// frame draws a box with the title on the top border and clears the
+// inside.
+func frame(t *term.Term, row, col, width, height int, title string) {
+	t.WriteString(styleNormal)
+	t.DrawBox(row, col, width, height)
+	for i := 1; i < height-1; i++ {
+		t.WriteString(moveTo(row+i, col+1) + strings.Repeat(" ", max(width-2, 0)))
+	}
+	if title != "" {
+		t.WriteString(moveTo(row, col+2) + styleTitle + " " + truncate(title, width-6) + " " + styleNormal)
+	}
+}
@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"crg.eti.br/go/atomic/term"
+)
+
+func newTerm() *term.Term {
+	return &term.Term{C: &bytes.Buffer{}, Width: 40, Height: 12}
+}
+
+// feed decodes the input and sends the events to the widget, a lone
+// escape at the end is the escape key.
+func feed(w Widget, s string) bool {
+	var d term.Decoder
+	for _, ev := range append(d.Feed(s), d.Flush()...) {
+		if w.Input(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// screenText returns the lines of the screen.
+func screenText(t *term.Term) string {
+	s := t.Screen()
+	lines := make([]string, s.Height)
+	for i := range lines {
+		lines[i] = s.Line(i + 1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestMenu(t *testing.T) {
+	tm := newTerm()
+	m := NewMenu(tm, "main", []MenuItem{
+		{Key: "1", Label: "boards"},
+		{Key: "2", Label: "mail"},
+		{Key: "q", Label: "quit"},
+	})
+	m.Draw()
+
+	text := screenText(tm)
+	if !strings.Contains(text, "main") || !strings.Contains(text, "2  mail") {
+		t.Fatalf("Unexpected screen\n%s", text)
+	}
+
+	if feed(m, "\x1b[B\x1b[B\x1b[A") || m.Selected != 1 {
+		t.Fatalf("Expected the second item, got %d", m.Selected)
+	}
+
+	if !feed(m, "Q") || m.Selected != 2 || m.Canceled {
+		t.Fatalf("Expected quit selected by the hotkey, got %d", m.Selected)
+	}
+
+	m = NewMenu(tm, "main", []MenuItem{{Key: "1", Label: "boards"}})
+	m.Draw()
+	if !feed(m, "\x1b") || !m.Canceled {
+		t.Fatal("Expected canceled")
+	}
+}
+
+func TestList_Scroll(t *testing.T) {
+	tm := newTerm()
+	var items []string
+	for i := 0; i < 30; i++ {
+		items = append(items, "item "+string(rune('a'+i%26)))
+	}
+
+	l := NewList(tm, "items", items)
+	l.Height = 7
+	l.Draw()
+
+	// page down twice and one more
+	feed(l, "\x1b[6~\x1b[6~\x1b[B")
+	if l.Selected != 11 {
+		t.Fatalf("Expected item 11, got %d", l.Selected)
+	}
+
+	text := screenText(tm)
+	if strings.Contains(text, "item a") || !strings.Contains(text, "item l") {
+		t.Fatalf("Expected the list scrolled\n%s", text)
+	}
+
+	if !feed(l, "\x1b[F\r") || l.Selected != 29 {
+		t.Fatalf("Expected the last item, got %d", l.Selected)
+	}
+}
+
+func TestForm(t *testing.T) {
+	tm := newTerm()
+	f := NewForm(tm, "register", []Field{
+		{Label: "nickname", Required: true, MaxLength: 5},
+		{Label: "password", Password: true, Validate: func(v string) error {
+			if len(v) < 4 {
+				return errors.New("too short")
+			}
+			return nil
+		}},
+	})
+	f.Draw()
+
+	// enter in the last field submits, the nickname is required
+	if feed(f, "\t\r") || f.Focus != 0 || !strings.Contains(f.Err, "required") {
+		t.Fatalf("Expected the required error, got %q", f.Err)
+	}
+
+	if feed(f, "alice-long\rab\r") || f.Focus != 1 || !strings.Contains(f.Err, "too short") {
+		t.Fatalf("Expected the validation error, got %q", f.Err)
+	}
+
+	text := screenText(tm)
+	if !strings.Contains(text, "alice") || strings.Contains(text, "alice-") || !strings.Contains(text, "**") {
+		t.Fatalf("Unexpected screen\n%s", text)
+	}
+
+	if !feed(f, "cd\r") {
+		t.Fatal("Expected the form submitted")
+	}
+
+	v := f.Values()
+	if v[0] != "alice" || v[1] != "abcd" {
+		t.Fatalf("Unexpected values %q", v)
+	}
+}
+
+func TestDialog(t *testing.T) {
+	tm := newTerm()
+	before := screenText(tm)
+	saved := tm.Screen()
+
+	d := NewConfirm(tm, "quit", "are you sure you want to leave the board?")
+	d.Draw()
+
+	if !strings.Contains(screenText(tm), "[ Yes ]  [ No ]") {
+		t.Fatalf("Unexpected screen\n%s", screenText(tm))
+	}
+
+	if !feed(d, "\x1b[C\r") || d.Selected != 1 {
+		t.Fatal("Expected no")
+	}
+
+	d = NewConfirm(tm, "quit", "sure?")
+	if !feed(d, "y") || d.Selected != 0 {
+		t.Fatal("Expected yes")
+	}
+
+	tm.Restore(saved)
+	if screenText(tm) != before {
+		t.Fatalf("Expected the screen restored\n%s", screenText(tm))
+	}
+}
+
+func TestWrap(t *testing.T) {
+	lines := wrap("the quick brown fox\njumps", 10)
+	want := []string{"the quick", "brown fox", "jumps"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("Unexpected lines %q", lines)
+	}
+}
+
+func TestNarrowTerminal(t *testing.T) {
+	lines := wrap("ab cd", 0)
+	if strings.Join(lines, "|") != "a|b|c|d" {
+		t.Fatalf("Unexpected lines %q", lines)
+	}
+
+	tm := &term.Term{C: &bytes.Buffer{}, Width: 1, Height: 12}
+	NewConfirm(tm, "quit", "are you sure?").Draw()
+	NewList(tm, "menu", []string{"one", "two"}).Draw()
+
+	f := NewForm(tm, "register", []Field{{Label: "nickname"}})
+	f.Width = 1
+	f.Draw()
+}